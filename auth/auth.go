@@ -0,0 +1,101 @@
+// Package auth 鉴权和授权：Authenticator根据请求中的凭证得到调用方，Authorizer判断调用方能否调用某个方法
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+
+	"github.com/lincx-911/lincxrpc/protocol"
+)
+
+var (
+	ErrMissingCredentials = errors.New("missing credentials")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+// Principal 鉴权通过的调用方
+type Principal struct {
+	Name   string
+	Roles  []string
+	Claims map[string]interface{} // 凭证中的其他信息，比如JWT的claims
+}
+
+// HasRole 是否拥有角色
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// NewContext 将调用方放入ctx，服务方法中可以通过FromContext获取
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, protocol.PrincipalKey, p)
+}
+
+// FromContext 获取ctx中的调用方
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(protocol.PrincipalKey).(*Principal)
+	return p, ok && p != nil
+}
+
+// Authenticator 校验凭证并返回调用方
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*Principal, error)
+}
+
+// AuthenticatorFunc 函数形式的Authenticator
+type AuthenticatorFunc func(ctx context.Context, token string) (*Principal, error)
+
+func (f AuthenticatorFunc) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	return f(ctx, token)
+}
+
+// Chain 依次尝试多个Authenticator，返回第一个成功的结果，都失败时优先返回比较具体的错误
+func Chain(authenticators ...Authenticator) Authenticator {
+	return AuthenticatorFunc(func(ctx context.Context, token string) (*Principal, error) {
+		var err error
+		for _, a := range authenticators {
+			p, e := a.Authenticate(ctx, token)
+			if e == nil {
+				return p, nil
+			}
+			if err == nil || errors.Is(err, ErrInvalidCredentials) || errors.Is(err, ErrMissingCredentials) {
+				err = e
+			}
+		}
+		if err == nil {
+			err = ErrInvalidCredentials
+		}
+		return nil, err
+	})
+}
+
+// APIKeyAuthenticator 静态的api key
+type APIKeyAuthenticator struct {
+	keys map[[sha256.Size]byte]*Principal
+}
+
+// NewAPIKeyAuthenticator keys为api key到调用方的映射
+func NewAPIKeyAuthenticator(keys map[string]*Principal) *APIKeyAuthenticator {
+	a := &APIKeyAuthenticator{keys: make(map[[sha256.Size]byte]*Principal, len(keys))}
+	for key, p := range keys {
+		// 以摘要作为key，查找时间和凭证内容无关
+		a.keys[sha256.Sum256([]byte(key))] = p
+	}
+	return a
+}
+
+func (a *APIKeyAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if token == "" {
+		return nil, ErrMissingCredentials
+	}
+	p, ok := a.keys[sha256.Sum256([]byte(token))]
+	if !ok {
+		return nil, ErrInvalidCredentials
+	}
+	return p, nil
+}
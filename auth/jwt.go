@@ -0,0 +1,200 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// JWTOption JWT鉴权配置项，Secret和PublicKey至少设置一个，只接受和密钥类型对应的算法
+type JWTOption struct {
+	Secret     []byte         // HS256/HS384/HS512的密钥
+	PublicKey  *rsa.PublicKey // RS256/RS384/RS512的公钥
+	Issuer     string         // 不为空时校验iss
+	Audience   string         // 不为空时校验aud
+	Leeway     time.Duration  // 校验exp和nbf时允许的时钟误差
+	RolesClaim string         // 角色所在的claim，可以是字符串数组或者空格分隔的字符串，默认为roles
+	// AllowNoExpiry 是否接受没有exp的JWT，默认拒绝，避免签发的令牌永久有效
+	AllowNoExpiry bool
+}
+
+// JWTAuthenticator 校验JWT，sub作为调用方的名称
+type JWTAuthenticator struct {
+	option JWTOption
+}
+
+// NewJWTAuthenticator 创建JWT鉴权
+func NewJWTAuthenticator(option JWTOption) *JWTAuthenticator {
+	if option.RolesClaim == "" {
+		option.RolesClaim = "roles"
+	}
+	return &JWTAuthenticator{option: option}
+}
+
+var jwtHashes = map[string]crypto.Hash{
+	"HS256": crypto.SHA256, "HS384": crypto.SHA384, "HS512": crypto.SHA512,
+	"RS256": crypto.SHA256, "RS384": crypto.SHA384, "RS512": crypto.SHA512,
+}
+
+func (a *JWTAuthenticator) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	if len(token) > 7 && strings.EqualFold(token[:7], "bearer ") {
+		token = token[7:]
+	}
+	if token == "" {
+		return nil, ErrMissingCredentials
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed jwt")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("malformed jwt header: %w", err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("malformed jwt signature: %w", err)
+	}
+	if err := a.verify(header.Alg, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, err
+	}
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("malformed jwt claims: %w", err)
+	}
+	if err := a.validate(claims, time.Now()); err != nil {
+		return nil, err
+	}
+	p := &Principal{Claims: claims}
+	p.Name, _ = claims["sub"].(string)
+	switch roles := claims[a.option.RolesClaim].(type) {
+	case string:
+		p.Roles = strings.Fields(roles)
+	case []interface{}:
+		for _, r := range roles {
+			if s, ok := r.(string); ok {
+				p.Roles = append(p.Roles, s)
+			}
+		}
+	}
+	return p, nil
+}
+
+// verify 校验签名，算法必须和配置的密钥类型一致，不接受none
+func (a *JWTAuthenticator) verify(alg, signed string, sig []byte) error {
+	hash, ok := jwtHashes[alg]
+	if !ok {
+		return fmt.Errorf("unsupported jwt algorithm %q", alg)
+	}
+	switch {
+	case strings.HasPrefix(alg, "HS") && a.option.Secret != nil:
+		mac := hmac.New(hash.New, a.option.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(mac.Sum(nil), sig) {
+			return errors.New("invalid jwt signature")
+		}
+		return nil
+	case strings.HasPrefix(alg, "RS") && a.option.PublicKey != nil:
+		h := hash.New()
+		h.Write([]byte(signed))
+		if err := rsa.VerifyPKCS1v15(a.option.PublicKey, hash, h.Sum(nil), sig); err != nil {
+			return errors.New("invalid jwt signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("jwt algorithm %q is not allowed", alg)
+}
+
+// validate 校验exp、nbf、iss和aud
+func (a *JWTAuthenticator) validate(claims map[string]interface{}, now time.Time) error {
+	exp, ok := claims["exp"].(float64)
+	if !ok && !a.option.AllowNoExpiry {
+		return errors.New("jwt has no expiry")
+	}
+	if ok && now.After(time.Unix(int64(exp), 0).Add(a.option.Leeway)) {
+		return errors.New("jwt is expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(a.option.Leeway).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("jwt is not valid yet")
+	}
+	if a.option.Issuer != "" {
+		if iss, _ := claims["iss"].(string); iss != a.option.Issuer {
+			return fmt.Errorf("unexpected jwt issuer %q", iss)
+		}
+	}
+	if a.option.Audience != "" && !hasAudience(claims["aud"], a.option.Audience) {
+		return errors.New("jwt audience does not match")
+	}
+	return nil
+}
+
+func hasAudience(aud interface{}, want string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == want
+	case []interface{}:
+		for _, a := range v {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(seg string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// SignJWT 签发JWT，HS算法的key为[]byte，RS算法的key为*rsa.PrivateKey
+func SignJWT(alg string, key interface{}, claims map[string]interface{}) (string, error) {
+	hash, ok := jwtHashes[alg]
+	if !ok {
+		return "", fmt.Errorf("unsupported jwt algorithm %q", alg)
+	}
+	header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	var sig []byte
+	switch k := key.(type) {
+	case []byte:
+		if !strings.HasPrefix(alg, "HS") {
+			return "", fmt.Errorf("jwt algorithm %q requires an rsa private key", alg)
+		}
+		mac := hmac.New(hash.New, k)
+		mac.Write([]byte(signed))
+		sig = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return "", fmt.Errorf("jwt algorithm %q requires a []byte secret", alg)
+		}
+		h := hash.New()
+		h.Write([]byte(signed))
+		sig, err = rsa.SignPKCS1v15(rand.Reader, k, hash, h.Sum(nil))
+		if err != nil {
+			return "", err
+		}
+	default:
+		return "", fmt.Errorf("unsupported jwt key type %T", key)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
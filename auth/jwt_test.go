@@ -0,0 +1,152 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+// unsignedJWT 使用给定的header构造JWT，签名由sign计算
+func unsignedJWT(t *testing.T, header map[string]string, claims map[string]interface{}, sign func(signed string) []byte) string {
+	h, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := json.Marshal(claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signed := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	return signed + "." + base64.RawURLEncoding.EncodeToString(sign(signed))
+}
+
+func TestJWTAlgorithmConfusion(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := NewJWTAuthenticator(JWTOption{PublicKey: &key.PublicKey})
+	claims := map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+
+	token, err := SignJWT("RS256", key, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, err := a.Authenticate(context.Background(), "Bearer "+token); err != nil || p.Name != "alice" {
+		t.Fatalf("Authenticate(RS256) = %v, %v", p, err)
+	}
+
+	// 用公钥作为HMAC密钥伪造的HS256令牌
+	pub, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := unsignedJWT(t, map[string]string{"alg": "HS256", "typ": "JWT"}, claims, func(signed string) []byte {
+		mac := hmac.New(sha256.New, pub)
+		mac.Write([]byte(signed))
+		return mac.Sum(nil)
+	})
+	if _, err := a.Authenticate(context.Background(), forged); err == nil {
+		t.Fatal("HS256 token accepted by an RSA-only authenticator")
+	}
+}
+
+func TestJWTNoneAlgorithm(t *testing.T) {
+	a := NewJWTAuthenticator(JWTOption{Secret: []byte("secret")})
+	claims := map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()}
+	for _, alg := range []string{"none", "None", ""} {
+		token := unsignedJWT(t, map[string]string{"alg": alg}, claims, func(string) []byte { return nil })
+		if _, err := a.Authenticate(context.Background(), token); err == nil {
+			t.Fatalf("token with alg %q accepted", alg)
+		}
+	}
+}
+
+func TestJWTExpiry(t *testing.T) {
+	secret := []byte("secret")
+	now := time.Now()
+	tests := []struct {
+		name   string
+		option JWTOption
+		claims map[string]interface{}
+		ok     bool
+	}{
+		{"valid", JWTOption{}, map[string]interface{}{"exp": now.Add(time.Minute).Unix()}, true},
+		{"expired", JWTOption{}, map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}, false},
+		{"expired within leeway", JWTOption{Leeway: 2 * time.Minute}, map[string]interface{}{"exp": now.Add(-time.Minute).Unix()}, true},
+		{"not valid yet", JWTOption{}, map[string]interface{}{"exp": now.Add(time.Hour).Unix(), "nbf": now.Add(time.Minute).Unix()}, false},
+		{"nbf within leeway", JWTOption{Leeway: 2 * time.Minute}, map[string]interface{}{"exp": now.Add(time.Hour).Unix(), "nbf": now.Add(time.Minute).Unix()}, true},
+		{"missing exp", JWTOption{}, map[string]interface{}{"sub": "alice"}, false},
+		{"missing exp allowed", JWTOption{AllowNoExpiry: true}, map[string]interface{}{"sub": "alice"}, true},
+		{"non-numeric exp", JWTOption{}, map[string]interface{}{"exp": "tomorrow"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.option.Secret = secret
+			token, err := SignJWT("HS256", secret, tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, err = NewJWTAuthenticator(tt.option).Authenticate(context.Background(), token)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Authenticate() error = %v, want ok = %v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestJWTAudienceAndRoles(t *testing.T) {
+	secret := []byte("secret")
+	a := NewJWTAuthenticator(JWTOption{Secret: secret, Audience: "orders", Issuer: "idp"})
+	exp := time.Now().Add(time.Hour).Unix()
+	tests := []struct {
+		name   string
+		claims map[string]interface{}
+		ok     bool
+	}{
+		{"string aud", map[string]interface{}{"aud": "orders", "iss": "idp"}, true},
+		{"array aud", map[string]interface{}{"aud": []string{"billing", "orders"}, "iss": "idp"}, true},
+		{"array aud without match", map[string]interface{}{"aud": []string{"billing"}, "iss": "idp"}, false},
+		{"missing aud", map[string]interface{}{"iss": "idp"}, false},
+		{"wrong issuer", map[string]interface{}{"aud": "orders", "iss": "other"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.claims["exp"] = exp
+			tt.claims["roles"] = "admin reader"
+			token, err := SignJWT("HS256", secret, tt.claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := a.Authenticate(context.Background(), token)
+			if (err == nil) != tt.ok {
+				t.Fatalf("Authenticate() error = %v, want ok = %v", err, tt.ok)
+			}
+			if err == nil && strings.Join(p.Roles, ",") != "admin,reader" {
+				t.Fatalf("roles = %v", p.Roles)
+			}
+		})
+	}
+}
+
+func TestJWTTamperedSignature(t *testing.T) {
+	secret := []byte("secret")
+	token, err := SignJWT("HS256", secret, map[string]interface{}{"sub": "alice", "exp": time.Now().Add(time.Hour).Unix()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewJWTAuthenticator(JWTOption{Secret: []byte("other")}).Authenticate(context.Background(), token); err == nil {
+		t.Fatal("token signed with another secret accepted")
+	}
+	if _, err := NewJWTAuthenticator(JWTOption{Secret: secret}).Authenticate(context.Background(), ""); err != ErrMissingCredentials {
+		t.Fatalf("empty token error = %v, want ErrMissingCredentials", err)
+	}
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"path"
+)
+
+// Authorizer 判断调用方能否调用方法，serviceMethod的格式为Service.Method
+type Authorizer interface {
+	Authorize(ctx context.Context, p *Principal, serviceMethod string) error
+}
+
+// Rule 授权规则，调用方的名称在Principals中或者拥有Roles中的任意角色时，可以调用Methods匹配的方法
+// Principals中的"*"表示任意鉴权通过的调用方，Methods使用path.Match的语法，比如"Arith.*"
+type Rule struct {
+	Principals []string
+	Roles      []string
+	Methods    []string
+}
+
+// Policy 授权策略，没有任何规则允许的调用都会被拒绝
+type Policy struct {
+	Rules []Rule
+}
+
+// NewPolicy 创建授权策略，检查方法模式的语法
+func NewPolicy(rules ...Rule) (*Policy, error) {
+	for _, rule := range rules {
+		for _, pattern := range rule.Methods {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid method pattern %q: %w", pattern, err)
+			}
+		}
+	}
+	return &Policy{Rules: rules}, nil
+}
+
+// Allow 是否允许调用
+func (p *Policy) Allow(principal *Principal, serviceMethod string) bool {
+	for _, rule := range p.Rules {
+		if rule.matchPrincipal(principal) && rule.matchMethod(serviceMethod) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Policy) Authorize(ctx context.Context, principal *Principal, serviceMethod string) error {
+	if !p.Allow(principal, serviceMethod) {
+		return fmt.Errorf("%s is not allowed to call %s", principal.Name, serviceMethod)
+	}
+	return nil
+}
+
+func (r Rule) matchPrincipal(p *Principal) bool {
+	if p == nil {
+		return false
+	}
+	for _, name := range r.Principals {
+		if name == "*" || name == p.Name {
+			return true
+		}
+	}
+	for _, role := range r.Roles {
+		if p.HasRole(role) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r Rule) matchMethod(serviceMethod string) bool {
+	for _, pattern := range r.Methods {
+		if ok, _ := path.Match(pattern, serviceMethod); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// MatchMethod serviceMethod是否匹配任意一个模式
+func MatchMethod(patterns []string, serviceMethod string) bool {
+	return Rule{Methods: patterns}.matchMethod(serviceMethod)
+}
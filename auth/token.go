@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// TokenSource 客户端调用时使用的凭证
+type TokenSource interface {
+	Token(ctx context.Context) (string, error)
+}
+
+type staticTokenSource string
+
+func (s staticTokenSource) Token(ctx context.Context) (string, error) {
+	return string(s), nil
+}
+
+// StaticTokenSource 不会变化的凭证，比如api key
+func StaticTokenSource(token string) TokenSource {
+	return staticTokenSource(token)
+}
+
+// FetchTokenFunc 获取新的凭证以及它的过期时间，过期时间为零值时表示不会过期
+type FetchTokenFunc func(ctx context.Context) (token string, expiry time.Time, err error)
+
+// RefreshingTokenSource 缓存获取到的凭证，在过期前RefreshBefore时重新获取
+// 重新获取失败时，如果旧的凭证还没有过期则继续使用
+type RefreshingTokenSource struct {
+	fetch         FetchTokenFunc
+	refreshBefore time.Duration
+
+	mu     sync.Mutex
+	token  string
+	expiry time.Time
+}
+
+// NewRefreshingTokenSource 创建会自动刷新的凭证
+func NewRefreshingTokenSource(fetch FetchTokenFunc, refreshBefore time.Duration) *RefreshingTokenSource {
+	return &RefreshingTokenSource{fetch: fetch, refreshBefore: refreshBefore}
+}
+
+func (s *RefreshingTokenSource) Token(ctx context.Context) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	if s.token != "" && (s.expiry.IsZero() || now.Before(s.expiry.Add(-s.refreshBefore))) {
+		return s.token, nil
+	}
+	token, expiry, err := s.fetch(ctx)
+	if err != nil {
+		if s.token != "" && (s.expiry.IsZero() || now.Before(s.expiry)) {
+			return s.token, nil
+		}
+		return "", err
+	}
+	s.token, s.expiry = token, expiry
+	return token, nil
+}
+
+// Invalidate 丢弃缓存的凭证，比如服务端返回凭证无效时，下次调用会重新获取
+func (s *RefreshingTokenSource) Invalidate() {
+	s.mu.Lock()
+	s.token, s.expiry = "", time.Time{}
+	s.mu.Unlock()
+}
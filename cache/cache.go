@@ -0,0 +1,166 @@
+// Package cache 带过期时间的LRU缓存，按条目数和字节数限制大小，用于缓存只读方法的响应
+package cache
+
+import (
+	"container/list"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Option 缓存配置项
+type Option struct {
+	MaxEntries int   // 最多保存的条目数，0时不限制
+	MaxBytes   int64 // 键和值的总字节数上限，0时不限制
+}
+
+// DefaultOption 默认配置
+var DefaultOption = Option{
+	MaxEntries: 10000,
+	MaxBytes:   64 << 20,
+}
+
+// Stats 缓存的统计
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64 // 因为超过大小限制被淘汰的条目数，不包括过期和主动删除的
+	Entries   int
+	Bytes     int64
+}
+
+// Cache LRU缓存，并发安全
+type Cache struct {
+	option Option
+
+	mu    sync.Mutex
+	ll    *list.List // 最近使用的在前面
+	items map[string]*list.Element
+	bytes int64
+	stats Stats
+}
+
+type entry struct {
+	key    string
+	value  []byte
+	expire time.Time
+}
+
+func (e *entry) size() int64 {
+	return int64(len(e.key) + len(e.value))
+}
+
+// New 创建缓存
+func New(option Option) *Cache {
+	return &Cache{
+		option: option,
+		ll:     list.New(),
+		items:  make(map[string]*list.Element),
+	}
+}
+
+// Get 读取缓存和剩余的有效时间，不存在或者已经过期时返回false，调用方不能修改返回的值
+func (c *Cache) Get(key string) ([]byte, time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, 0, false
+	}
+	e := el.Value.(*entry)
+	ttl := time.Until(e.expire)
+	if ttl <= 0 {
+		c.removeElement(el)
+		c.stats.Misses++
+		return nil, 0, false
+	}
+	c.ll.MoveToFront(el)
+	c.stats.Hits++
+	return e.value, ttl, true
+}
+
+// Set 写入缓存，保留ttl，超过大小限制时淘汰最久没有使用的条目，单个条目超过MaxBytes时不写入
+func (c *Cache) Set(key string, value []byte, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+	e := &entry{key: key, value: value, expire: time.Now().Add(ttl)}
+	if c.option.MaxBytes > 0 && e.size() > c.option.MaxBytes {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+	c.items[key] = c.ll.PushFront(e)
+	c.bytes += e.size()
+	for c.overflow() {
+		c.removeElement(c.ll.Back())
+		c.stats.Evictions++
+	}
+}
+
+// Delete 删除键
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[key]; ok {
+		c.removeElement(el)
+	}
+}
+
+// DeletePrefix 删除所有以prefix开头的键，返回删除的数量
+func (c *Cache) DeletePrefix(prefix string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for key, el := range c.items {
+		if strings.HasPrefix(key, prefix) {
+			c.removeElement(el)
+			n++
+		}
+	}
+	return n
+}
+
+// Purge 清空缓存
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.ll.Init()
+	c.items = make(map[string]*list.Element)
+	c.bytes = 0
+}
+
+// Len 条目数，包括已经过期还没有清理的
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// Stats 缓存的统计
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s := c.stats
+	s.Entries = c.ll.Len()
+	s.Bytes = c.bytes
+	return s
+}
+
+func (c *Cache) overflow() bool {
+	if c.option.MaxEntries > 0 && c.ll.Len() > c.option.MaxEntries {
+		return true
+	}
+	return c.option.MaxBytes > 0 && c.bytes > c.option.MaxBytes
+}
+
+// removeElement 调用方持有锁
+func (c *Cache) removeElement(el *list.Element) {
+	e := c.ll.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.bytes -= e.size()
+}
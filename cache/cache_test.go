@@ -0,0 +1,96 @@
+package cache
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCacheLRU(t *testing.T) {
+	c := New(Option{MaxEntries: 2})
+	c.Set("a", []byte("1"), time.Minute)
+	c.Set("b", []byte("2"), time.Minute)
+	// 读取a之后b是最久没有使用的
+	if _, _, ok := c.Get("a"); !ok {
+		t.Fatal("a not found")
+	}
+	c.Set("c", []byte("3"), time.Minute)
+	if _, _, ok := c.Get("b"); ok {
+		t.Fatal("b should be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, _, ok := c.Get(key); !ok {
+			t.Fatalf("%s not found", key)
+		}
+	}
+	if s := c.Stats(); s.Evictions != 1 || s.Entries != 2 {
+		t.Fatalf("stats = %+v, want 1 eviction and 2 entries", s)
+	}
+}
+
+func TestCacheMaxBytes(t *testing.T) {
+	c := New(Option{MaxBytes: 10})
+	c.Set("a", []byte("1234"), time.Minute) // 5字节
+	c.Set("b", []byte("1234"), time.Minute) // 10字节
+	if s := c.Stats(); s.Bytes != 10 || s.Entries != 2 {
+		t.Fatalf("stats = %+v, want 10 bytes and 2 entries", s)
+	}
+	c.Set("c", []byte("12"), time.Minute)
+	if _, _, ok := c.Get("a"); ok {
+		t.Fatal("a should be evicted")
+	}
+	if s := c.Stats(); s.Bytes != 8 {
+		t.Fatalf("bytes = %d, want 8", s.Bytes)
+	}
+
+	// 覆盖已有的键时按新的值计算
+	c.Set("b", []byte("1"), time.Minute)
+	if s := c.Stats(); s.Bytes != 5 || s.Entries != 2 {
+		t.Fatalf("stats = %+v, want 5 bytes and 2 entries", s)
+	}
+	// 单个条目超过上限时不写入
+	c.Set("d", make([]byte, 10), time.Minute)
+	if _, _, ok := c.Get("d"); ok {
+		t.Fatal("oversized entry was stored")
+	}
+	c.Delete("b")
+	c.Purge()
+	if s := c.Stats(); s.Bytes != 0 || s.Entries != 0 {
+		t.Fatalf("stats after purge = %+v", s)
+	}
+}
+
+func TestCacheTTL(t *testing.T) {
+	c := New(Option{})
+	c.Set("a", []byte("1"), 50*time.Millisecond)
+	c.Set("zero", []byte("1"), 0)
+	if c.Len() != 1 {
+		t.Fatalf("len = %d, want 1", c.Len())
+	}
+	_, ttl, ok := c.Get("a")
+	if !ok || ttl <= 0 || ttl > 50*time.Millisecond {
+		t.Fatalf("Get = %v, %v, want remaining ttl within 50ms", ttl, ok)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, _, ok := c.Get("a"); ok {
+		t.Fatal("expired entry returned")
+	}
+	if s := c.Stats(); s.Entries != 0 || s.Hits != 1 || s.Misses != 1 {
+		t.Fatalf("stats = %+v, want 1 hit, 1 miss and no entries", s)
+	}
+}
+
+func TestCacheDeletePrefix(t *testing.T) {
+	c := New(Option{})
+	for _, key := range []string{"Arith.Add\x00a", "Arith.Add\x00b", "Arith.Mul\x00a", "Echo.Say\x00a"} {
+		c.Set(key, []byte("1"), time.Minute)
+	}
+	if n := c.DeletePrefix("Arith.Add\x00"); n != 2 {
+		t.Fatalf("DeletePrefix(method) = %d, want 2", n)
+	}
+	if n := c.DeletePrefix("Arith."); n != 1 {
+		t.Fatalf("DeletePrefix(service) = %d, want 1", n)
+	}
+	if _, _, ok := c.Get("Echo.Say\x00a"); !ok {
+		t.Fatal("unrelated key deleted")
+	}
+}
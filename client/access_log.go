@@ -0,0 +1,96 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lincx-911/lincxrpc/common/stats"
+	"github.com/lincx-911/lincxrpc/logger"
+	"github.com/lincx-911/lincxrpc/status"
+)
+
+// AccessLogOption 访问日志配置项
+type AccessLogOption struct {
+	Logger        logger.Logger // 为空时使用客户端的日志
+	SampleRate    float64       // 成功调用的采样率，小于等于0时记录所有调用，出错和慢调用总是记录
+	SlowThreshold time.Duration // 超过这个耗时的调用以warn级别记录并输出截断的参数，0时不判断
+	MaxArgLength  int           // 慢调用输出参数的最大长度
+}
+
+// DefaultAccessLogOption 默认记录所有调用
+var DefaultAccessLogOption = AccessLogOption{
+	SampleRate:   1,
+	MaxArgLength: 256,
+}
+
+// AccessLogWrapper 每次调用(包括每次重试)输出一行日志
+type AccessLogWrapper struct {
+	defaultClientInterceptor
+	option AccessLogOption
+}
+
+// NewAccessLogWrapper 创建访问日志拦截器
+func NewAccessLogWrapper(option AccessLogOption) *AccessLogWrapper {
+	if option.MaxArgLength <= 0 {
+		option.MaxArgLength = DefaultAccessLogOption.MaxArgLength
+	}
+	if option.SampleRate <= 0 {
+		option.SampleRate = 1
+	}
+	return &AccessLogWrapper{option: option}
+}
+
+func (w *AccessLogWrapper) WrapCall(option *SGOption, callFunc CallFunc) CallFunc {
+	return func(ctx context.Context, serviceMethod string, arg interface{}, reply interface{}) error {
+		ctx, st := stats.EnsureClient(ctx)
+		start := time.Now()
+		err := callFunc(ctx, serviceMethod, arg, reply)
+		latency := time.Since(start)
+
+		slow := w.option.SlowThreshold > 0 && latency >= w.option.SlowThreshold
+		if err == nil && !slow && rand.Float64() >= w.option.SampleRate {
+			return err
+		}
+		l := w.option.Logger
+		if l == nil {
+			l = option.log()
+		}
+		fields := []logger.Field{
+			logger.F("peer", st.Peer()),
+			logger.F("service_method", serviceMethod),
+			logger.F("status", status.Code(err).String()),
+			logger.F("latency", latency),
+			logger.F("request_bytes", st.RequestBytes()),
+			logger.F("response_bytes", st.ResponseBytes()),
+		}
+		if err != nil {
+			fields = append(fields, logger.Err(err))
+		}
+		if slow {
+			fields = append(fields, logger.F("arg", truncate(fmt.Sprintf("%+v", arg), w.option.MaxArgLength)))
+		}
+		switch {
+		case err != nil && !status.IsCallerError(err):
+			l.Error("call", fields...)
+		case err != nil || slow:
+			l.Warn("call", fields...)
+		default:
+			l.Info("call", fields...)
+		}
+		return err
+	}
+}
+
+// truncate 截断过长的字符串，截断位置落在多字节字符中间时退回到字符的开始
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + "...(truncated)"
+}
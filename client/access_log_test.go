@@ -0,0 +1,48 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/logger"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"hello", 5, "hello"},
+		{"hello", 3, "hel...(truncated)"},
+		{"a你好", 2, "a...(truncated)"},
+		{"a你好", 4, "a你...(truncated)"},
+	}
+	for _, tt := range tests {
+		if got := truncate(tt.s, tt.max); got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+	}
+}
+
+func TestAccessLogZeroSampleRateLogsAll(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewAccessLogWrapper(AccessLogOption{
+		Logger:        logger.NewTextLogger(&buf, logger.InfoLevel),
+		SlowThreshold: time.Hour,
+	})
+	call := w.WrapCall(&SGOption{}, func(ctx context.Context, serviceMethod string, arg interface{}, reply interface{}) error {
+		return nil
+	})
+	for i := 0; i < 3; i++ {
+		if err := call(context.Background(), "Arith.Add", 1, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := strings.Count(buf.String(), "call"); n != 3 {
+		t.Fatalf("logged %d calls, want 3:\n%s", n, buf.String())
+	}
+}
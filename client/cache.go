@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/lincx-911/lincxrpc/cache"
+	"github.com/lincx-911/lincxrpc/codec"
+	"github.com/lincx-911/lincxrpc/common/metadata"
+	"github.com/lincx-911/lincxrpc/common/stats"
+	"github.com/lincx-911/lincxrpc/protocol"
+)
+
+// CacheWrapper 按服务端返回的rpc_cache_ttl缓存同步调用的结果，命中时不发送请求
+// 只有服务端通过server.CacheMethod标记的方法会被缓存，收到过服务端返回的ttl之后才会编码参数和查找缓存，
+// 键由目标应用、服务方法、凭证和业务元数据的摘要以及参数的编码组成
+// 服务端的Invalidate不会通知客户端，客户端的缓存最多保留服务端设置的ttl
+type CacheWrapper struct {
+	defaultClientInterceptor
+	cache *cache.Cache
+
+	mu        sync.RWMutex
+	cacheable map[string]bool // 服务端返回过ttl的"Service.Method\x00RemoteAppKey"
+}
+
+// NewCacheWrapper 创建客户端的响应缓存拦截器，c为空时使用cache.DefaultOption创建
+func NewCacheWrapper(c *cache.Cache) *CacheWrapper {
+	if c == nil {
+		c = cache.New(cache.DefaultOption)
+	}
+	return &CacheWrapper{cache: c, cacheable: make(map[string]bool)}
+}
+
+// Cache 拦截器使用的缓存，可以用于观察命中率
+func (w *CacheWrapper) Cache() *cache.Cache {
+	return w.cache
+}
+
+// Invalidate 删除服务方法的所有缓存，serviceMethod为"Service.Method"，只有服务名时删除整个服务的缓存
+func (w *CacheWrapper) Invalidate(serviceMethod string) int {
+	if strings.Contains(serviceMethod, ".") {
+		return w.cache.DeletePrefix(serviceMethod + "\x00")
+	}
+	return w.cache.DeletePrefix(serviceMethod + ".")
+}
+
+// Purge 清空所有缓存
+func (w *CacheWrapper) Purge() {
+	w.cache.Purge()
+}
+
+func (w *CacheWrapper) WrapCall(option *SGOption, callFunc CallFunc) CallFunc {
+	cc := codec.GetCodec(option.SerializeType)
+	return func(ctx context.Context, serviceMethod string, arg interface{}, reply interface{}) error {
+		remoteAppKey := option.RemoteAppkey
+		if appKey, ok := ctx.Value(protocol.RemoteAppKey).(string); ok && appKey != "" {
+			remoteAppKey = appKey
+		}
+		method := serviceMethod + "\x00" + remoteAppKey
+		var key string
+		if w.isCacheable(method) {
+			if argData, err := cc.Encode(arg); err == nil {
+				key = method + "\x00" + callIdentity(ctx) + "\x00" + string(argData)
+				if data, _, ok := w.cache.Get(key); ok && cc.Decode(data, reply) == nil {
+					return nil
+				}
+			}
+		}
+
+		ctx, st := stats.EnsureClient(ctx)
+		if err := callFunc(ctx, serviceMethod, arg, reply); err != nil {
+			return err
+		}
+		ttl := st.CacheTTL()
+		w.setCacheable(method, ttl > 0)
+		if ttl <= 0 {
+			return nil
+		}
+		if key == "" {
+			// 第一次收到ttl，之前没有编码参数
+			argData, err := cc.Encode(arg)
+			if err != nil {
+				return nil
+			}
+			key = method + "\x00" + callIdentity(ctx) + "\x00" + string(argData)
+		}
+		if data, err := cc.Encode(reply); err == nil {
+			w.cache.Set(key, data, ttl)
+		}
+		return nil
+	}
+}
+
+func (w *CacheWrapper) isCacheable(method string) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.cacheable[method]
+}
+
+// setCacheable 记录服务端是否为方法返回了ttl，服务端不再缓存该方法时客户端也不再查找
+func (w *CacheWrapper) setCacheable(method string, cacheable bool) {
+	if w.isCacheable(method) == cacheable {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if cacheable {
+		w.cacheable[method] = true
+	} else {
+		delete(w.cacheable, method)
+	}
+}
+
+// callIdentity 本次调用发送的凭证、调用方和业务元数据的摘要，不同的凭证或者元数据不会共用缓存
+// 实际发送的元数据由最外层的MetaDataWrapper生成，截止时间、优先级等每次调用不同的保留键不参与计算
+func callIdentity(ctx context.Context) string {
+	wire, _ := metadata.WireFromContext(ctx)
+	keys := make([]string, 0, len(wire))
+	for k := range wire {
+		if !metadata.IsReserved(k) || k == protocol.AuthKey || k == protocol.CallerAppKey {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%v\x00", k, wire[k])
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
@@ -3,6 +3,8 @@ package client
 import (
 	"sync/atomic"
 	"time"
+
+	"github.com/lincx-911/lincxrpc/status"
 )
 
 // CircuitBreaker 熔断器 基于时间窗口
@@ -28,11 +30,20 @@ func (cb *DefaultCircuitBreaker) AllowRequest() bool {
 	return failures < cb.threshold
 }
 
+// IsOpen 熔断器是否打开，不会重置状态
+func (cb *DefaultCircuitBreaker) IsOpen() bool {
+	return time.Since(cb.lastFail) <= cb.window && atomic.LoadUint64(&cb.fails) >= cb.threshold
+}
+
 func (cb *DefaultCircuitBreaker) Success() {
 	cb.reset()
 }
 
-func (cb *DefaultCircuitBreaker) Fail() {
+// Fail 记录失败，调用方导致的错误说明服务端是正常的，不计入失败次数
+func (cb *DefaultCircuitBreaker) Fail(err error) {
+	if status.IsCallerError(err) {
+		return
+	}
 	atomic.AddUint64(&cb.fails, 1)
 	cb.lastFail = time.Now()
 }
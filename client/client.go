@@ -3,15 +3,21 @@ package client
 import (
 	"context"
 	"errors"
-	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/lincx-911/lincxrpc/codec"
+	"github.com/lincx-911/lincxrpc/common/stats"
+	"github.com/lincx-911/lincxrpc/loadshed"
+	"github.com/lincx-911/lincxrpc/logger"
 	"github.com/lincx-911/lincxrpc/protocol"
 	"github.com/lincx-911/lincxrpc/registry"
 	"github.com/lincx-911/lincxrpc/selector"
+	"github.com/lincx-911/lincxrpc/status"
 	"github.com/lincx-911/lincxrpc/transport"
+
+	"github.com/google/uuid"
 )
 
 var ErrorShutDown = errors.New("client is shut down")
@@ -22,6 +28,7 @@ type RPCClient interface {
 	Close() error
 	IsShutDown() bool
 	IsDegrade() bool
+	IsDraining() bool
 }
 
 type SGClient interface {
@@ -36,6 +43,7 @@ type Call struct {
 	Reply         interface{} //返回值
 	Error         error       //错误信息
 	Done          chan *Call  //在调用结束时调用
+	stats         *stats.RPCStats
 }
 
 func (c *Call) done() {
@@ -43,14 +51,14 @@ func (c *Call) done() {
 }
 
 type sgClient struct {
-	shutdown             bool
-	option               SGOption
-	clients              sync.Map //map[string]RPCClient
-	clientsHeartbeatFail map[string]int
-	breakers             sync.Map //map[string]CircuitBreaker
-	watcher              registry.Watcher
+	shutdown  int32 //Close后为1，通过isShutdown读取
+	option    SGOption
+	clients   sync.Map //map[string]RPCClient
+	breakers  sync.Map //map[string]CircuitBreaker
+	health    *healthChecker
 	serversMu sync.RWMutex
-	servers   []registry.Provider
+	servers   map[string][]registry.Provider //appKey -> providers
+	watchers  map[string]registry.Watcher    //appKey -> watcher
 	mu        sync.Mutex
 }
 
@@ -62,7 +70,7 @@ func NewRPCClient(network, addr string, option Option) (RPCClient, error) {
 	client.codec = codec.GetCodec(option.SerializeType)
 
 	tr := transport.NewTransport(option.TransportType)
-	err := tr.Dial(network, addr, transport.DialOption{Timeout: option.DialTimeout})
+	err := tr.Dial(network, addr, transport.DialOption{Timeout: option.DialTimeout, TLSConfig: option.TLSConfig})
 	if err != nil {
 
 		return nil, err
@@ -72,7 +80,7 @@ func NewRPCClient(network, addr string, option Option) (RPCClient, error) {
 	if client.option.Heartbeat && client.option.HeartbeatInterval > 0 {
 		go client.heartbeat()
 	}
-	log.Printf("successfully conneted to %s@%s\n", network, addr)
+	client.option.log().Debug("successfully connected", logger.F("network", network), logger.F("addr", addr))
 	return client, nil
 }
 
@@ -80,18 +88,33 @@ func NewSGClient(option SGOption) SGClient {
 	s := new(sgClient)
 	s.option = option
 	AddWrapper(&s.option, &MetaDataWrapper{})
-	providers := s.option.Registry.GetServiceList()
-
-	s.watcher = s.option.Registry.Watch()
-	go s.watchService(s.watcher)
-	s.serversMu.Lock()
-	defer s.serversMu.Unlock()
-	s.servers = append(s.servers, providers...)
-
-	if s.option.Heartbeat {
+	s.servers = make(map[string][]registry.Provider)
+	s.watchers = make(map[string]registry.Watcher)
+	// 预先获取默认应用的服务列表，其他应用在第一次调用时再获取
+	s.discover(s.option.RemoteAppkey)
+
+	if s.option.HealthCheck.Interval > 0 {
+		// 主动检查所有发现的提供者
+		s.health = newHealthChecker(s.option.HealthCheck, s.option.Option)
+		go s.healthCheck()
+	} else if s.option.Heartbeat {
+		// 只对已经建立连接的提供者发送心跳，失败次数超过阈值则不再选择
+		s.health = newHealthChecker(HealthCheckOption{
+			UnhealthyThreshold: s.option.HeartbeatDegradeThreshold + 1,
+			HealthyThreshold:   1,
+		}, s.option.Option)
 		go s.heartbeat()
+	}
+	if s.health != nil {
 		s.option.SelectOption.Filters = append(s.option.SelectOption.Filters,
-			selector.DegradeProviderFilter())
+			selector.HealthyProviderFilter(s.health))
+	}
+	// 正在下线的提供者不再选择
+	s.option.SelectOption.Filters = append(s.option.SelectOption.Filters, selector.DrainingProviderFilter())
+	for _, w := range s.option.Wrappers {
+		if a, ok := w.(clientAttacher); ok {
+			a.attach(s)
+		}
 	}
 	if s.option.Tagged && s.option.Tags != nil {
 		s.option.SelectOption.Filters = append(s.option.SelectOption.Filters,
@@ -101,7 +124,7 @@ func NewSGClient(option SGOption) SGClient {
 }
 
 func (c *sgClient) Go(ctx context.Context, serviceMethod string, arg interface{}, reply interface{}, done chan *Call) (*Call, error) {
-	if c.shutdown {
+	if c.isShutdown() {
 		return nil, ErrorShutDown
 	}
 	_, client, err := c.selectClient(ctx, serviceMethod, arg)
@@ -121,121 +144,109 @@ func (c *sgClient) wrapGo(goFunc GoFunc) GoFunc {
 func (c *sgClient) Call(ctx context.Context, serviceMethod string, arg interface{}, reply interface{}) error {
 	provider, rpcClient, err := c.selectClient(ctx, serviceMethod, arg)
 	if err != nil && c.option.FailMode == FailFast {
-
 		return err
 	}
-	var connectErr error
 
 	switch c.option.FailMode {
-	case FailRetry:
+	case FailRetry, FailOver:
+		// 第一次调用之外最多重试Retries次，只有传输层错误或者可重试的状态码才会重试
 		retries := c.option.Retries
-		for retries > 0 {
-			retries--
-
-			if rpcClient != nil {
-
+		for {
+			if err == nil {
 				err = c.wrapCall(rpcClient.Call)(ctx, serviceMethod, arg, reply)
-				if err == nil {
-					// TODO circuit
-					if breaker, ok := c.breakers.Load(provider.ProviderKey); ok {
-						breaker.(CircuitBreaker).Success()
-					}
-				} else {
-					if _, ok := err.(ServiceError); ok {
-						// TODO circuit
-						if breaker, ok := c.breakers.Load(provider.ProviderKey); ok {
-							breaker.(CircuitBreaker).Fail(err)
-						}
-					}
+				c.report(provider, rpcClient, err)
+				if err == nil || !retryable(err) {
+					return err
 				}
-				return err
-			}
-			c.removeClient(provider.ProviderKey, rpcClient)
-			rpcClient, connectErr = c.getclient(provider)
-
-		}
-		if err == nil {
-			err = connectErr
-		}
-		if err == nil {
-			// TODO circuit
-			if breaker, ok := c.breakers.Load(provider.ProviderKey); ok {
-				breaker.(CircuitBreaker).Success()
 			}
-		} else {
-			// TODO circuit
-			if breaker, ok := c.breakers.Load(provider.ProviderKey); ok {
-				breaker.(CircuitBreaker).Fail(err)
+			if retries <= 0 || ctx.Err() != nil {
+				return err
 			}
-		}
-		return err
-	case FailOver:
-		retries := c.option.Retries
-		for retries > 0 {
 			retries--
-
-			if rpcClient != nil {
-				err = c.wrapCall(rpcClient.Call)(ctx, serviceMethod, arg, reply)
-				if err == nil {
-					// TODO circuit
-					if breaker, ok := c.breakers.Load(provider.ProviderKey); ok {
-						breaker.(CircuitBreaker).Success()
-					}
-				} else {
-					if _, ok := err.(ServiceError); ok {
-						// TODO circuit
-						if breaker, ok := c.breakers.Load(provider.ProviderKey); ok {
-							breaker.(CircuitBreaker).Fail(err)
-						}
-					}
-				}
-				return err
+			callErr, last := err, provider.ProviderKey
+			if c.option.FailMode == FailRetry && provider.ProviderKey != "" {
+				rpcClient, err = c.getclient(provider)
+			} else {
+				provider, rpcClient, err = c.selectClient(ctx, serviceMethod, arg)
 			}
-			c.removeClient(provider.ProviderKey, rpcClient)
-			provider, rpcClient, connectErr = c.selectClient(ctx, serviceMethod, arg)
-		}
-		if err == nil {
-			err = connectErr
-		}
-		if err == nil {
-			// TODO circuit
-			if breaker, ok := c.breakers.Load(provider.ProviderKey); ok {
-				breaker.(CircuitBreaker).Success()
-			}
-		} else {
-			// TODO circuit
-			if breaker, ok := c.breakers.Load(provider.ProviderKey); ok {
-				breaker.(CircuitBreaker).Fail(err)
+			// 重试同一个提供者时等待服务端建议的时间，换到其他提供者时立即重试
+			if err == nil && provider.ProviderKey == last && !c.waitRetryAfter(ctx, callErr) {
+				return callErr
 			}
 		}
-		return err
 	default:
-
-		err = c.wrapCall(rpcClient.Call)(ctx, serviceMethod, arg, reply)
-		if err != nil {
-			if _, ok := err.(ServiceError); !ok {
-				c.removeClient(provider.ProviderKey, rpcClient)
-			}
+		if err == nil {
+			err = c.wrapCall(rpcClient.Call)(ctx, serviceMethod, arg, reply)
+			c.report(provider, rpcClient, err)
 		}
-
 		if c.option.FailMode == FailSafe {
 			err = nil
 		}
+		return err
+	}
+}
 
-		if err == nil {
-			// TODO circuit
-			if breaker, ok := c.breakers.Load(provider.ProviderKey); ok {
-				breaker.(CircuitBreaker).Success()
-			}
-		} else {
-			// TODO circuit
-			if breaker, ok := c.breakers.Load(provider.ProviderKey); ok {
-				breaker.(CircuitBreaker).Fail(err)
-			}
+// waitRetryAfter 重试前等待服务端建议的时间(status.RetryAfter)，比如被限流时
+// 等待时间超过ctx的截止时间，或者ctx没有截止时间时超过RequestTimeout，返回false，不再重试
+func (c *sgClient) waitRetryAfter(ctx context.Context, err error) bool {
+	wait, ok := status.RetryAfter(err)
+	if !ok || wait <= 0 {
+		return true
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if time.Until(deadline) < wait {
+			return false
 		}
+	} else if c.option.RequestTimeout > 0 && wait > c.option.RequestTimeout {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
 
-		return err
+// report 记录调用结果，传输层错误时移除连接
+func (c *sgClient) report(provider registry.Provider, rpcClient RPCClient, err error) {
+	if err != nil && !isServiceError(err) && !isContextError(err) {
+		c.removeClient(provider.ProviderKey, rpcClient)
+	}
+	breaker, ok := c.breakers.Load(provider.ProviderKey)
+	if !ok {
+		return
 	}
+	if err == nil {
+		breaker.(CircuitBreaker).Success()
+	} else {
+		breaker.(CircuitBreaker).Fail(err)
+	}
+}
+
+// ServiceError 服务端返回的错误
+//
+// Deprecated: 服务端返回的错误是*status.Error，使用status.FromError或者status.Code获取
+type ServiceError = status.Error
+
+// isServiceError 是否是服务端返回的错误
+func isServiceError(err error) bool {
+	_, ok := status.FromError(err)
+	return ok
+}
+
+func isContextError(err error) bool {
+	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
+}
+
+// retryable 传输层错误可以重试，服务端返回的错误根据状态码判断
+func retryable(err error) bool {
+	if isServiceError(err) {
+		return status.IsRetryable(err)
+	}
+	return !isContextError(err)
 }
 
 func (c *sgClient) wrapCall(callFunc CallFunc) CallFunc {
@@ -245,9 +256,18 @@ func (c *sgClient) wrapCall(callFunc CallFunc) CallFunc {
 	return callFunc
 }
 
-func (c *sgClient) Close() error {
+// isShutdown 是否已经调用了Close
+func (c *sgClient) isShutdown() bool {
+	return atomic.LoadInt32(&c.shutdown) == 1
+}
 
-	c.shutdown = true
+func (c *sgClient) Close() error {
+	atomic.StoreInt32(&c.shutdown, 1)
+	for _, w := range c.option.Wrappers {
+		if a, ok := w.(clientAttacher); ok {
+			a.detach(c)
+		}
+	}
 	c.mu.Lock()
 
 	c.clients.Range(func(key, value interface{}) bool {
@@ -257,40 +277,72 @@ func (c *sgClient) Close() error {
 		return true
 	})
 	c.mu.Unlock()
+	c.serversMu.RLock()
+	watchers := make([]registry.Watcher, 0, len(c.watchers))
+	for _, watcher := range c.watchers {
+		watchers = append(watchers, watcher)
+	}
+	c.serversMu.RUnlock()
 	go func() {
-		c.option.Registry.Unwatch(c.watcher)
-		c.watcher.Close()
+		for _, watcher := range watchers {
+			c.option.Registry.Unwatch(watcher)
+			watcher.Close()
+		}
 	}()
 
 	return nil
 }
 
-// ServiceError is an error from server.
-type ServiceError string
-
-func (e ServiceError) Error() string {
-	return string(e)
-}
-func (c *sgClient) watchService(watcher registry.Watcher) {
+func (c *sgClient) watchService(appKey string, watcher registry.Watcher) {
 	if watcher == nil {
 		return
 	}
 	for {
 		event, err := watcher.Next()
 		if err != nil {
-			log.Println("watch service error:" + err.Error())
+			c.option.log().Warn("watch service error", logger.F("app", appKey), logger.Err(err))
 			break
 		}
 
 		c.serversMu.Lock()
-		c.servers = event.Providers
+		c.servers[appKey] = selector.LocalizeWarmUp(event.Providers, c.servers[appKey], time.Now())
 		c.serversMu.Unlock()
 	}
 }
 
+// WithPriority 指定本次调用的优先级，服务端过载时低优先级的请求先被拒绝
+func WithPriority(ctx context.Context, priority loadshed.Priority) context.Context {
+	return context.WithValue(ctx, protocol.PriorityKey, priority)
+}
+
+// WithIdempotencyKey 为本次调用指定幂等key，FailRetry和FailOver的重试使用同一个key
+// 服务端使用IdempotencyWrapper时同一个key的请求只会执行一次，重复的请求得到第一次的结果
+func WithIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, protocol.IdempotencyKey, key)
+}
+
+// NewIdempotencyKey 生成随机的幂等key，同一个业务操作的所有重试需要使用同一个key
+func NewIdempotencyKey() string {
+	return uuid.New().String()
+}
+
+// WithRemoteAppKey 指定本次调用的目标应用，覆盖SGOption.RemoteAppkey
+func WithRemoteAppKey(ctx context.Context, appKey string) context.Context {
+	return context.WithValue(ctx, protocol.RemoteAppKey, appKey)
+}
+
+// remoteAppKey 获取本次调用的目标应用，ctx中指定的优先
+func (c *sgClient) remoteAppKey(ctx context.Context) string {
+	if appKey, ok := ctx.Value(protocol.RemoteAppKey).(string); ok && appKey != "" {
+		return appKey
+	}
+	return c.option.RemoteAppkey
+}
+
 func (c *sgClient) selectClient(ctx context.Context, serviceMethod string, arg interface{}) (provider registry.Provider, client RPCClient, err error) {
 
-	provider, err = c.option.Selector.Next(ctx, c.providers(), serviceMethod, arg, c.option.SelectOption)
+	providers := c.excludeDraining(c.providers(c.remoteAppKey(ctx)))
+	provider, err = c.option.Selector.Next(ctx, providers, serviceMethod, arg, c.option.SelectOption)
 	if err != nil {
 		return
 	}
@@ -299,6 +351,28 @@ func (c *sgClient) selectClient(ctx context.Context, serviceMethod string, arg i
 	return
 }
 
+// excludeDraining 排除连接收到了GOAWAY的提供者
+func (c *sgClient) excludeDraining(providers []registry.Provider) []registry.Provider {
+	var res []registry.Provider
+	for i, p := range providers {
+		rc, ok := c.clients.Load(p.ProviderKey)
+		if !ok || !rc.(RPCClient).IsDraining() {
+			if res != nil {
+				res = append(res, p)
+			}
+			continue
+		}
+		if res == nil {
+			res = make([]registry.Provider, i, len(providers))
+			copy(res, providers[:i])
+		}
+	}
+	if res == nil {
+		return providers
+	}
+	return res
+}
+
 var ErrBreakerOpen = errors.New("breaker open")
 
 func (c *sgClient) getclient(provider registry.Provider) (client RPCClient, err error) {
@@ -311,7 +385,10 @@ func (c *sgClient) getclient(provider registry.Provider) (client RPCClient, err
 
 	if ok {
 		client = rc.(RPCClient)
-		if !client.IsShutDown() {
+		if client.IsDraining() {
+			// 连接会在请求完成后自行关闭，这里只移除，下次重新建立连接
+			c.clients.Delete(key)
+		} else if !client.IsShutDown() {
 			return
 		} else {
 			c.removeClient(key, client)
@@ -344,64 +421,89 @@ func (c *sgClient) removeClient(clientKey string, client RPCClient) {
 	c.breakers.Delete(clientKey)
 }
 
-func (c *sgClient) providers() []registry.Provider {
+// providers 获取应用的服务列表，第一次访问的应用会从注册中心获取并开始监听
+func (c *sgClient) providers(appKey string) []registry.Provider {
 	c.serversMu.RLock()
-	defer c.serversMu.RUnlock()
-	return c.servers
+	providers, ok := c.servers[appKey]
+	c.serversMu.RUnlock()
+	if ok {
+		return providers
+	}
+	return c.discover(appKey)
 }
 
-func (c *sgClient) heartbeat() {
-	c.mu.Lock()
-	if c.clientsHeartbeatFail == nil {
-		c.clientsHeartbeatFail = make(map[string]int)
+// discover 从注册中心获取应用的服务列表并监听变化
+// 访问注册中心时不持有serversMu，注册中心的网络延迟不会阻塞其他应用的调用
+func (c *sgClient) discover(appKey string) []registry.Provider {
+	providers := selector.LocalizeWarmUp(c.option.Registry.GetServiceList(appKey), nil, time.Now())
+	watcher := c.option.Registry.Watch(appKey)
+
+	c.serversMu.Lock()
+	if existing, ok := c.servers[appKey]; ok {
+		// 并发的discover已经完成，放弃这次的结果
+		c.serversMu.Unlock()
+		if watcher != nil {
+			c.option.Registry.Unwatch(watcher)
+			watcher.Close()
+		}
+		return existing
 	}
-	c.mu.Unlock()
+	c.servers[appKey] = providers
+	if watcher != nil {
+		c.watchers[appKey] = watcher
+		go c.watchService(appKey, watcher)
+	}
+	c.serversMu.Unlock()
+	return providers
+}
+
+func (c *sgClient) heartbeat() {
 	if c.option.HeartbeatInterval <= 0 {
 		return
 	}
 	//根据指定的时间间隔发送心跳
 	t := time.NewTicker(c.option.HeartbeatInterval)
 	for range t.C {
-		if c.shutdown {
+		if c.isShutdown() {
 			t.Stop()
 			return
 		}
-		//遍历每个RPCClient进行心跳检查
+		//遍历每个RPCClient进行心跳检查，结果记录在健康状态中
 		c.clients.Range(func(key, value interface{}) bool {
 			err := value.(RPCClient).Call(context.Background(), "", "", nil)
-			c.mu.Lock()
-			if err != nil {
-				//心跳失败进行计数
-				if fail, ok := c.clientsHeartbeatFail[key.(string)]; ok {
-					fail++
-					c.clientsHeartbeatFail[key.(string)] = fail
-				} else {
-					c.clientsHeartbeatFail[key.(string)] = 1
-				}
-			} else {
-				// 心跳成功则进行恢复
-				c.clientsHeartbeatFail[key.(string)] = 0
-				c.serversMu.Lock()
-				for i, p := range c.servers {
-					if p.ProviderKey == key {
-						delete(c.servers[i].Meta, protocol.ProviderDegradeKey)
-					}
-				}
-				c.serversMu.Unlock()
-			}
-			c.mu.Unlock()
-
-			//心跳失败次数超过阈值则进行降级
-			if c.clientsHeartbeatFail[key.(string)] > c.option.HeartbeatDegradeThreshold {
-				c.serversMu.Lock()
-				for i, p := range c.servers {
-					if p.ProviderKey == key {
-						c.servers[i].Meta[protocol.ProviderDegradeKey] = true
-					}
-				}
-				c.serversMu.Unlock()
-			}
+			c.health.report(key.(string), err)
 			return true
 		})
 	}
 }
+
+// healthCheck 定时检查所有应用的提供者
+func (c *sgClient) healthCheck() {
+	t := time.NewTicker(c.option.HealthCheck.Interval)
+	defer t.Stop()
+	for range t.C {
+		if c.isShutdown() {
+			c.health.close()
+			return
+		}
+		c.health.check(c.allProviders())
+	}
+}
+
+// allProviders 所有应用的提供者，按ProviderKey去重
+func (c *sgClient) allProviders() []registry.Provider {
+	c.serversMu.RLock()
+	defer c.serversMu.RUnlock()
+	seen := make(map[string]bool)
+	var providers []registry.Provider
+	for _, servers := range c.servers {
+		for _, p := range servers {
+			if seen[p.ProviderKey] {
+				continue
+			}
+			seen[p.ProviderKey] = true
+			providers = append(providers, p)
+		}
+	}
+	return providers
+}
@@ -1,10 +1,13 @@
 package client
 
 import (
+	"crypto/tls"
 	"math"
 	"time"
 
+	"github.com/lincx-911/lincxrpc/auth"
 	"github.com/lincx-911/lincxrpc/codec"
+	"github.com/lincx-911/lincxrpc/logger"
 	"github.com/lincx-911/lincxrpc/protocol"
 	"github.com/lincx-911/lincxrpc/registry"
 	"github.com/lincx-911/lincxrpc/selector"
@@ -20,6 +23,7 @@ type Option struct {
 
 	DialTimeout    time.Duration
 	RequestTimeout time.Duration
+	TLSConfig      *tls.Config // 不为空时使用TLS连接服务端
 
 	Heartbeat                 bool
 	HeartbeatInterval         time.Duration
@@ -27,6 +31,16 @@ type Option struct {
 
 	Tagged bool
 	Tags   map[string]string
+
+	Logger logger.Logger // 客户端的日志，为空时使用全局日志
+}
+
+// log 客户端的日志，没有设置Logger时使用全局日志
+func (o *Option) log() logger.Logger {
+	if o.Logger != nil {
+		return o.Logger
+	}
+	return logger.Default()
 }
 
 var DefaultOption = Option{
@@ -53,18 +67,21 @@ const (
 
 type SGOption struct {
 	AppKey       string
-	RemoteAppkey string
+	RemoteAppkey string //默认调用的应用，为空时使用注册中心的默认应用，可以通过WithRemoteAppKey按次指定
 	FailMode     FailMode
-	Retries      int
+	Retries      int //FailRetry和FailOver时第一次调用失败后的最大重试次数
 	Registry     registry.Registry
 	Selector     selector.Selector
 	SelectOption selector.SelectOption
 	Wrappers     []Wrapper
 	Option
-	Auth                    string
+	Auth                    string           //静态的凭证，需要刷新时使用TokenSource
+	TokenSource             auth.TokenSource //每次调用时获取凭证，设置后代替Auth
 	CircuitBreakerThreshold uint64
 	CircuitBreakerWindow    time.Duration
 	Meta                    map[string]string
+	HealthCheck             HealthCheckOption //主动健康检查，Interval为0时不开启
+	DeadlineMargin          time.Duration     //继承ctx中的截止时间时预留的时间，用于网络传输和返回响应
 }
 
 func AddWrapper(o *SGOption, w ...Wrapper) *SGOption {
@@ -0,0 +1,203 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/health"
+	"github.com/lincx-911/lincxrpc/logger"
+	"github.com/lincx-911/lincxrpc/registry"
+)
+
+// HealthCheckOption 主动健康检查配置
+type HealthCheckOption struct {
+	Interval           time.Duration //检查间隔，为0则不开启主动健康检查
+	Timeout            time.Duration //单次检查的超时时间
+	UnhealthyThreshold int           //连续失败达到该次数标记为不健康
+	HealthyThreshold   int           //不健康的提供者连续成功达到该次数恢复为健康
+	UseHealthService   bool          //为true时调用标准的Health.Check，否则发送心跳帧
+	Service            string        //调用Health.Check时检查的服务，为空检查整个服务端
+}
+
+// DefaultHealthCheckOption 默认的健康检查配置
+var DefaultHealthCheckOption = HealthCheckOption{
+	Interval:           time.Second * 5,
+	Timeout:            time.Second,
+	UnhealthyThreshold: 3,
+	HealthyThreshold:   2,
+}
+
+// providerHealth 提供者的健康状态
+type providerHealth struct {
+	unhealthy bool
+	fails     int //连续失败次数
+	successes int //连续成功次数
+}
+
+// healthChecker 维护提供者的健康状态，实现selector.HealthChecker
+type healthChecker struct {
+	option       HealthCheckOption
+	clientOption Option
+
+	mu     sync.RWMutex
+	states map[string]*providerHealth //providerKey -> 健康状态
+
+	probesMu sync.Mutex
+	probes   map[string]RPCClient //providerKey -> 健康检查使用的连接
+}
+
+func newHealthChecker(option HealthCheckOption, clientOption Option) *healthChecker {
+	if option.UnhealthyThreshold <= 0 {
+		option.UnhealthyThreshold = 1
+	}
+	if option.HealthyThreshold <= 0 {
+		option.HealthyThreshold = 1
+	}
+	clientOption.Heartbeat = false
+	if option.Timeout > 0 {
+		clientOption.DialTimeout = option.Timeout
+	}
+	return &healthChecker{
+		option:       option,
+		clientOption: clientOption,
+		states:       make(map[string]*providerHealth),
+		probes:       make(map[string]RPCClient),
+	}
+}
+
+// Healthy 提供者是否健康，还没有检查过的提供者视为健康
+func (h *healthChecker) Healthy(providerKey string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	state, ok := h.states[providerKey]
+	return !ok || !state.unhealthy
+}
+
+// report 记录一次检查结果
+func (h *healthChecker) report(providerKey string, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	state, ok := h.states[providerKey]
+	if !ok {
+		state = &providerHealth{}
+		h.states[providerKey] = state
+	}
+	if err != nil {
+		state.fails++
+		state.successes = 0
+		if !state.unhealthy && state.fails >= h.option.UnhealthyThreshold {
+			state.unhealthy = true
+			h.clientOption.log().Warn("provider is unhealthy", logger.F("provider", providerKey), logger.Err(err))
+		}
+		return
+	}
+	state.successes++
+	state.fails = 0
+	if state.unhealthy && state.successes >= h.option.HealthyThreshold {
+		state.unhealthy = false
+		h.clientOption.log().Info("provider is healthy again", logger.F("provider", providerKey))
+	}
+}
+
+// check 并发检查所有提供者，并清理已经下线的提供者
+func (h *healthChecker) check(providers []registry.Provider) {
+	var wg sync.WaitGroup
+	for _, p := range providers {
+		wg.Add(1)
+		go func(p registry.Provider) {
+			defer wg.Done()
+			h.report(p.ProviderKey, h.probe(p))
+		}(p)
+	}
+	wg.Wait()
+	h.retain(providers)
+}
+
+// probe 检查单个提供者
+func (h *healthChecker) probe(provider registry.Provider) error {
+	rc, err := h.probeClient(provider)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if h.option.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, h.option.Timeout)
+		defer cancel()
+	}
+	if h.option.UseHealthService {
+		resp := &health.CheckResponse{}
+		err = rc.Call(ctx, health.ServiceName+"."+health.CheckMethod, health.CheckRequest{Service: h.option.Service}, resp)
+		if err == nil && resp.Status != health.StatusServing {
+			err = fmt.Errorf("health check status %s", resp.Status)
+		}
+	} else {
+		err = rc.Call(ctx, "", "", nil)
+	}
+	if err != nil {
+		h.closeProbe(provider.ProviderKey)
+	}
+	return err
+}
+
+// probeClient 获取健康检查使用的连接，连接断开后重新建立
+func (h *healthChecker) probeClient(provider registry.Provider) (RPCClient, error) {
+	h.probesMu.Lock()
+	defer h.probesMu.Unlock()
+	if rc, ok := h.probes[provider.ProviderKey]; ok && !rc.IsShutDown() {
+		return rc, nil
+	}
+	rc, err := NewRPCClient(provider.Network, provider.Addr, h.clientOption)
+	if err != nil {
+		return nil, err
+	}
+	h.probes[provider.ProviderKey] = rc
+	return rc, nil
+}
+
+func (h *healthChecker) closeProbe(providerKey string) {
+	h.probesMu.Lock()
+	defer h.probesMu.Unlock()
+	if rc, ok := h.probes[providerKey]; ok {
+		rc.Close()
+		delete(h.probes, providerKey)
+	}
+}
+
+// retain 只保留仍然存在的提供者的状态
+func (h *healthChecker) retain(providers []registry.Provider) {
+	keys := make(map[string]bool, len(providers))
+	for _, p := range providers {
+		keys[p.ProviderKey] = true
+	}
+	h.mu.Lock()
+	for key := range h.states {
+		if !keys[key] {
+			delete(h.states, key)
+		}
+	}
+	h.mu.Unlock()
+	h.probesMu.Lock()
+	var stale []string
+	for key := range h.probes {
+		if !keys[key] {
+			stale = append(stale, key)
+		}
+	}
+	h.probesMu.Unlock()
+	for _, key := range stale {
+		h.closeProbe(key)
+	}
+}
+
+// close 关闭所有健康检查的连接
+func (h *healthChecker) close() {
+	h.probesMu.Lock()
+	defer h.probesMu.Unlock()
+	for key, rc := range h.probes {
+		rc.Close()
+		delete(h.probes, key)
+	}
+}
@@ -5,7 +5,9 @@ import (
 	"time"
 
 	"github.com/lincx-911/lincxrpc/common/metadata"
+	"github.com/lincx-911/lincxrpc/loadshed"
 	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/status"
 )
 
 // MetaDataWrapper meta拦截器
@@ -15,54 +17,102 @@ type MetaDataWrapper struct {
 
 func (w *MetaDataWrapper) WrapCall(option *SGOption, callFunc CallFunc) CallFunc {
 	return func(ctx context.Context, ServiceMethod string, arg interface{}, reply interface{}) error {
-		ctx = wrapContext(ctx, option)
-		return callFunc(ctx, ServiceMethod, arg, reply)
+		ctx, cancel, err := wrapContext(ctx, option)
+		if err != nil {
+			return err
+		}
+		defer cancel()
+		err = callFunc(ctx, ServiceMethod, arg, reply)
+		if status.Code(err) == protocol.StatusUnauthenticated {
+			// 服务端不认可凭证，下次调用重新获取
+			if inv, ok := option.TokenSource.(interface{ Invalidate() }); ok {
+				inv.Invalidate()
+			}
+		}
+		return err
 	}
 }
 
 func (w *MetaDataWrapper) WrapGo(option *SGOption, goFunc GoFunc) GoFunc {
 	return func(ctx context.Context, ServiceMethod string, arg interface{}, reply interface{}, done chan *Call) *Call {
-		ctx = wrapContext(ctx, option)
-
+		ctx, cancel, err := wrapContext(ctx, option)
+		if err != nil {
+			return failedCall(ServiceMethod, arg, reply, done, err)
+		}
+		// Go在发送请求后就返回，之后不再使用ctx
+		defer cancel()
 		return goFunc(ctx, ServiceMethod, arg, reply, done)
 	}
 }
-// wrapContext 设置上下文ctx参数
-func wrapContext(ctx context.Context, option *SGOption) context.Context {
 
-	timeout := time.Duration(0)
-	deadline, ok := ctx.Deadline()
-	if ok {
-		//已经有了deadline了，此次请求覆盖原始的超时时间
-		timeout = time.Until(deadline)
-	}
-	if timeout == time.Duration(0) && option.RequestTimeout != time.Duration(0) {
-		//ctx里没有设置超时时间，用option中设置的超时时间
-		timeout = option.RequestTimeout
+// failedCall 还没有发送就失败的异步调用
+func failedCall(serviceMethod string, arg interface{}, reply interface{}, done chan *Call, err error) *Call {
+	if done == nil {
+		done = make(chan *Call, 1)
 	}
-	ctx, _ = context.WithTimeout(ctx, timeout)
+	call := &Call{ServiceMethod: serviceMethod, Args: arg, Reply: reply, Error: err, Done: done}
+	call.done()
+	return call
+}
 
-	metaData := metadata.FromContext(ctx)
-	metaData[protocol.RequestTimeoutKey] = uint64(timeout)
-	
-	if len(option.Meta)!=0{
-		
-		for k,v:=range option.Meta{
-			metaData[k]=v
+// callDeadline 本次调用的截止时间
+// ctx中有截止时间时(比如服务方法中发起的调用)继承它并减去DeadlineMargin，留出返回响应的时间，否则使用RequestTimeout
+func callDeadline(ctx context.Context, option *SGOption) (time.Time, bool, error) {
+	if deadline, ok := ctx.Deadline(); ok {
+		deadline = deadline.Add(-option.DeadlineMargin)
+		if !time.Now().Before(deadline) {
+			return deadline, true, status.New(protocol.StatusDeadlineExceeded, "not enough time left before the deadline")
 		}
+		return deadline, true, nil
+	}
+	if option.RequestTimeout > 0 {
+		return time.Now().Add(option.RequestTimeout), true, nil
 	}
+	return time.Time{}, false, nil
+}
 
-	if option.Auth != "" {
-		metaData[protocol.AuthKey] = option.Auth
+// wrapContext 设置上下文ctx参数，返回的cancel在调用结束后调用
+func wrapContext(ctx context.Context, option *SGOption) (context.Context, context.CancelFunc, error) {
+	deadline, hasDeadline, err := callDeadline(ctx, option)
+	if err != nil {
+		return ctx, nil, err
 	}
-	// 如果ctx中有设置auth 则 用ctx中的
+	cancel := context.CancelFunc(func() {})
+	// 每次调用生成新的map，不会修改ctx中收到的或者业务设置的元数据
+	metaData := metadata.ToWire(ctx)
+	for k, v := range option.Meta {
+		metadata.SetWire(metaData, k, v)
+	}
+	if hasDeadline {
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		// 截止时间以unix纳秒传递，任何序列化方式都能保留
+		metaData[protocol.RequestDeadlineKey] = deadline.UnixNano()
+		metaData[protocol.RequestTimeoutKey] = uint64(time.Until(deadline))
+	}
+
+	if priority, ok := ctx.Value(protocol.PriorityKey).(loadshed.Priority); ok {
+		metaData[protocol.PriorityKey] = int64(priority)
+	}
+	if key, ok := ctx.Value(protocol.IdempotencyKey).(string); ok && key != "" {
+		metaData[protocol.IdempotencyKey] = key
+	}
+	if option.AppKey != "" {
+		// 服务端据此识别调用方，比如按调用方限流
+		metaData[protocol.CallerAppKey] = option.AppKey
+	}
+	// 凭证的优先级：ctx中设置的auth > TokenSource > 静态的Auth
 	if auth, ok := ctx.Value(protocol.AuthKey).(string); ok {
 		metaData[protocol.AuthKey] = auth
+	} else if option.TokenSource != nil {
+		token, err := option.TokenSource.Token(ctx)
+		if err != nil {
+			cancel()
+			return ctx, nil, status.Errorf(protocol.StatusUnauthenticated, "get token error: %v", err)
+		}
+		metaData[protocol.AuthKey] = token
+	} else if option.Auth != "" {
+		metaData[protocol.AuthKey] = option.Auth
 	}
-	deadline, ok = ctx.Deadline()
-	if ok {
-		metaData[protocol.RequestDeadlineKey] = deadline
-	}
-	ctx = metadata.WithMeta(ctx, metaData)
-	return ctx
+	ctx = metadata.NewWireContext(ctx, metaData)
+	return ctx, cancel, nil
 }
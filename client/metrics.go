@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/common/stats"
+	"github.com/lincx-911/lincxrpc/metrics"
+	"github.com/lincx-911/lincxrpc/status"
+)
+
+// clientAttacher 需要访问sgClient状态的拦截器，创建SGClient时调用attach，关闭时调用detach
+type clientAttacher interface {
+	attach(c *sgClient)
+	detach(c *sgClient)
+}
+
+// MetricsWrapper 记录Call的请求数、耗时、处理中的请求数、请求和响应的大小，以及每个提供者的连接数和熔断状态
+type MetricsWrapper struct {
+	defaultClientInterceptor
+	requests      *metrics.CounterVec
+	duration      *metrics.HistogramVec
+	inFlight      *metrics.GaugeVec
+	requestBytes  *metrics.HistogramVec
+	responseBytes *metrics.HistogramVec
+	clients       *clientSet
+}
+
+// NewMetricsWrapper 创建指标拦截器，r为空时使用metrics.DefaultRegistry
+// 同一个注册表上的多个拦截器共用同一组指标，连接数和熔断状态汇总所有拦截器关联的客户端
+func NewMetricsWrapper(r *metrics.Registry) *MetricsWrapper {
+	if r == nil {
+		r = metrics.DefaultRegistry
+	}
+	return &MetricsWrapper{
+		requests: r.GetOrRegister(metrics.NewCounterVec("lincxrpc_client_requests_total",
+			"Total number of calls made by the client.", "service", "method", "status")).(*metrics.CounterVec),
+		duration: r.GetOrRegister(metrics.NewHistogramVec("lincxrpc_client_request_duration_seconds",
+			"Time spent on calls, including retries.", metrics.DefBuckets, "service", "method")).(*metrics.HistogramVec),
+		inFlight: r.GetOrRegister(metrics.NewGaugeVec("lincxrpc_client_in_flight_requests",
+			"Number of calls currently in flight.", "service", "method")).(*metrics.GaugeVec),
+		requestBytes: r.GetOrRegister(metrics.NewHistogramVec("lincxrpc_client_request_bytes",
+			"Size of request payloads.", metrics.SizeBuckets, "service", "method")).(*metrics.HistogramVec),
+		responseBytes: r.GetOrRegister(metrics.NewHistogramVec("lincxrpc_client_response_bytes",
+			"Size of response payloads.", metrics.SizeBuckets, "service", "method")).(*metrics.HistogramVec),
+		clients: clientSetOf(r),
+	}
+}
+
+func (w *MetricsWrapper) WrapCall(option *SGOption, callFunc CallFunc) CallFunc {
+	return func(ctx context.Context, serviceMethod string, arg interface{}, reply interface{}) error {
+		service, method := serviceMethod, ""
+		if i := strings.LastIndex(serviceMethod, "."); i >= 0 {
+			service, method = serviceMethod[:i], serviceMethod[i+1:]
+		}
+		ctx, st := stats.EnsureClient(ctx)
+		inFlight := w.inFlight.With(service, method)
+		inFlight.Inc()
+		start := time.Now()
+		err := callFunc(ctx, serviceMethod, arg, reply)
+		inFlight.Dec()
+		w.duration.With(service, method).Observe(time.Since(start).Seconds())
+		w.requests.With(service, method, status.Code(err).String()).Inc()
+		w.requestBytes.With(service, method).Observe(float64(st.RequestBytes()))
+		w.responseBytes.With(service, method).Observe(float64(st.ResponseBytes()))
+		return err
+	}
+}
+
+func (w *MetricsWrapper) attach(c *sgClient) {
+	w.clients.add(c, 1)
+}
+
+func (w *MetricsWrapper) detach(c *sgClient) {
+	w.clients.add(c, -1)
+}
+
+// registryClients 每个注册表对应的客户端集合
+var registryClients = struct {
+	sync.Mutex
+	sets map[*metrics.Registry]*clientSet
+}{sets: make(map[*metrics.Registry]*clientSet)}
+
+// clientSet 注册表上所有MetricsWrapper关联的客户端，连接数和熔断状态的指标只注册一次，输出时汇总集合中的客户端
+type clientSet struct {
+	mu      sync.Mutex
+	clients map[*sgClient]int // 同一个客户端可能关联了多个拦截器，引用计数降为0时移除
+}
+
+// clientSetOf 获取注册表对应的客户端集合，第一次获取时注册连接数和熔断状态的指标
+func clientSetOf(r *metrics.Registry) *clientSet {
+	registryClients.Lock()
+	defer registryClients.Unlock()
+	if set, ok := registryClients.sets[r]; ok {
+		return set
+	}
+	set := &clientSet{clients: make(map[*sgClient]int)}
+	registryClients.sets[r] = set
+	r.GetOrRegister(metrics.NewGaugeFunc("lincxrpc_client_connections",
+		"Number of open connections per provider.", []string{"provider"}, set.collectConnections))
+	r.GetOrRegister(metrics.NewGaugeFunc("lincxrpc_client_breaker_open",
+		"Whether the circuit breaker of a provider is open.", []string{"provider"}, set.collectBreakers))
+	return set
+}
+
+func (cs *clientSet) add(c *sgClient, delta int) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	if n := cs.clients[c] + delta; n > 0 {
+		cs.clients[c] = n
+	} else {
+		delete(cs.clients, c)
+	}
+}
+
+func (cs *clientSet) each(fn func(c *sgClient)) {
+	cs.mu.Lock()
+	clients := make([]*sgClient, 0, len(cs.clients))
+	for c := range cs.clients {
+		clients = append(clients, c)
+	}
+	cs.mu.Unlock()
+	for _, c := range clients {
+		fn(c)
+	}
+}
+
+func (cs *clientSet) collectConnections(emit func(value float64, labelValues ...string)) {
+	counts := make(map[string]float64)
+	cs.each(func(c *sgClient) {
+		c.clients.Range(func(key, value interface{}) bool {
+			if rc, ok := value.(RPCClient); ok && !rc.IsShutDown() {
+				counts[key.(string)]++
+			}
+			return true
+		})
+	})
+	for provider, n := range counts {
+		emit(n, provider)
+	}
+}
+
+func (cs *clientSet) collectBreakers(emit func(value float64, labelValues ...string)) {
+	states := make(map[string]float64)
+	cs.each(func(c *sgClient) {
+		c.breakers.Range(func(key, value interface{}) bool {
+			if b, ok := value.(interface{ IsOpen() bool }); ok {
+				if b.IsOpen() {
+					states[key.(string)] = 1
+				} else if _, exist := states[key.(string)]; !exist {
+					states[key.(string)] = 0
+				}
+			}
+			return true
+		})
+	})
+	for provider, v := range states {
+		emit(v, provider)
+	}
+}
@@ -0,0 +1,85 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/lincx-911/lincxrpc/common/stats"
+	"github.com/lincx-911/lincxrpc/metrics"
+)
+
+// fakeRPCClient 只用于统计连接数
+type fakeRPCClient struct {
+	RPCClient
+	shutdown bool
+}
+
+func (c *fakeRPCClient) IsShutDown() bool {
+	return c.shutdown
+}
+
+func TestMetricsWrappersShareClients(t *testing.T) {
+	r := metrics.NewRegistry()
+	first, second := NewMetricsWrapper(r), NewMetricsWrapper(r)
+
+	a, b := new(sgClient), new(sgClient)
+	a.clients.Store("tcp@a", &fakeRPCClient{})
+	b.clients.Store("tcp@b", &fakeRPCClient{})
+	b.clients.Store("tcp@c", &fakeRPCClient{shutdown: true})
+	first.attach(a)
+	second.attach(b)
+	// 同一个客户端关联两个拦截器时只统计一次
+	second.attach(a)
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	text := buf.String()
+	for _, want := range []string{
+		`lincxrpc_client_connections{provider="tcp@a"} 1`,
+		`lincxrpc_client_connections{provider="tcp@b"} 1`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("missing %q in\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "tcp@c") {
+		t.Fatalf("closed connection reported in\n%s", text)
+	}
+
+	first.detach(a)
+	second.detach(b)
+	buf.Reset()
+	_ = r.WriteText(&buf)
+	if !strings.Contains(buf.String(), `provider="tcp@a"`) || strings.Contains(buf.String(), `provider="tcp@b"`) {
+		t.Fatalf("unexpected connections after detach\n%s", buf.String())
+	}
+}
+
+func TestMetricsWrapperPayloadSizes(t *testing.T) {
+	r := metrics.NewRegistry()
+	w := NewMetricsWrapper(r)
+	call := w.WrapCall(&SGOption{}, func(ctx context.Context, serviceMethod string, arg interface{}, reply interface{}) error {
+		st := stats.ClientFromContext(ctx)
+		st.SetRequestBytes(100)
+		st.SetResponseBytes(300)
+		return nil
+	})
+	if err := call(context.Background(), "Arith.Add", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	_ = r.WriteText(&buf)
+	for _, want := range []string{
+		`lincxrpc_client_request_bytes_sum{service="Arith",method="Add"} 100`,
+		`lincxrpc_client_response_bytes_sum{service="Arith",method="Add"} 300`,
+		`lincxrpc_client_requests_total{service="Arith",method="Add",status="ok"} 1`,
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Fatalf("missing %q in\n%s", want, buf.String())
+		}
+	}
+}
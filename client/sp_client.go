@@ -3,8 +3,8 @@ package client
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
-	"log"
 	"strings"
 	"sync"
 	"sync/atomic"
@@ -12,7 +12,10 @@ import (
 
 	"github.com/lincx-911/lincxrpc/codec"
 	"github.com/lincx-911/lincxrpc/common/metadata"
+	"github.com/lincx-911/lincxrpc/common/stats"
+	"github.com/lincx-911/lincxrpc/logger"
 	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/status"
 )
 
 type simpleClient struct {
@@ -24,12 +27,15 @@ type simpleClient struct {
 	mutex           sync.Mutex
 	degraded        bool
 	shutdown        bool
+	draining        bool //收到了服务端的GOAWAY，处理完当前的请求后关闭
 	option          Option
 	seq             uint64
 	heatbeatFailNum int
 }
 
 func (c *simpleClient) IsShutDown() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	return c.shutdown
 }
 
@@ -37,6 +43,37 @@ func (c *simpleClient) IsDegrade() bool {
 	return c.degraded
 }
 
+// IsDraining 服务端是否正在关闭，不应该再发送新的请求
+func (c *simpleClient) IsDraining() bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.draining
+}
+
+// drain 收到GOAWAY后不再发送新的请求，没有等待中的请求时关闭连接
+func (c *simpleClient) drain() {
+	c.mutex.Lock()
+	c.draining = true
+	c.mutex.Unlock()
+	c.option.log().Info("server is going away", logger.F("network", c.network), logger.F("addr", c.addr))
+	c.closeIfDrained()
+}
+
+// closeIfDrained draining状态下所有请求都完成后关闭连接
+func (c *simpleClient) closeIfDrained() {
+	if !c.IsDraining() {
+		return
+	}
+	pending := false
+	c.pendingCalls.Range(func(key, value interface{}) bool {
+		pending = true
+		return false
+	})
+	if !pending {
+		c.Close()
+	}
+}
+
 func (c *simpleClient) Go(ctx context.Context, serviceMethod string, args interface{}, reply interface{}, done chan *Call) *Call {
 	call := new(Call)
 	call.ServiceMethod = serviceMethod
@@ -47,7 +84,7 @@ func (c *simpleClient) Go(ctx context.Context, serviceMethod string, args interf
 		done = make(chan *Call, 10) // buffered.
 	} else {
 		if cap(done) == 0 {
-			log.Panic("rpc: done channel is unbuffered")
+			panic("rpc: done channel is unbuffered")
 		}
 	}
 	call.Done = done
@@ -62,37 +99,47 @@ func (c *simpleClient) Go(ctx context.Context, serviceMethod string, args interf
 // 同时将请求缓存到pendingCalls中
 func (c *simpleClient) send(ctx context.Context, call *Call) {
 	seq := ctx.Value(protocol.RequestSeqKey).(uint64)
+	call.stats = stats.ClientFromContext(ctx)
+	call.stats.SetPeer(c.addr)
 	c.pendingCalls.Store(seq, call)
 
 	request := protocol.NewMessage(c.option.ProtocolType)
 	request.Seq = seq
 	if call.ServiceMethod != "" {
 		request.MessageType = protocol.MessageTypeRequest
-		serviceMethod := strings.SplitN(call.ServiceMethod, ".", 2)
-		request.ServiceName = serviceMethod[0]
-		request.MethodName = serviceMethod[1]
+		// 服务名可能是带包名的全名，方法名不会包含"."
+		i := strings.LastIndex(call.ServiceMethod, ".")
+		request.ServiceName = call.ServiceMethod[:i]
+		request.MethodName = call.ServiceMethod[i+1:]
 	} else {
 		request.MessageType = protocol.MessageTypeHeartbeat
 	}
 	request.SerializeType = c.option.SerializeType
 	request.CompressType = c.option.CompressType
-	if meta := metadata.FromContext(ctx); meta != nil {
+	if meta, ok := metadata.WireFromContext(ctx); ok {
 		request.MetaData = meta
+	} else {
+		// 没有经过SGClient的拦截器，只发送业务元数据
+		request.MetaData = metadata.ToWire(ctx)
 	}
+	call.stats.Mark(stats.EncodeStart)
 	requestData, err := c.codec.Encode(call.Args)
+	call.stats.Mark(stats.EncodeEnd)
 	if err != nil {
-		log.Println("client encode error:" + err.Error())
+		c.callLogger(seq, call).Warn("client encode error", logger.Err(err))
 		c.pendingCalls.Delete(seq)
 		call.Error = err
 		call.done()
 		return
 	}
 	request.Data = requestData
+	call.stats.SetRequestBytes(len(requestData))
 	data := protocol.EncodeMessage(c.option.ProtocolType, request)
 
 	_, err = c.rwc.Write(data)
+	call.stats.Mark(stats.RequestSent)
 	if err != nil {
-		log.Println("client write error:" + err.Error())
+		c.callLogger(seq, call).Warn("client write error", logger.Err(err))
 		c.pendingCalls.Delete(seq)
 		call.Error = err
 		call.done()
@@ -110,7 +157,8 @@ func (c *simpleClient) Call(ctx context.Context, serviceMethod string, args inte
 	select {
 	case <-ctx.Done():
 		c.pendingCalls.Delete(seq)
-		call.Error = errors.New("client request time out")
+		call.Error = fmt.Errorf("client request time out: %w", ctx.Err())
+		c.closeIfDrained()
 	case <-call.Done:
 	}
 	return call.Error
@@ -119,7 +167,12 @@ func (c *simpleClient) Call(ctx context.Context, serviceMethod string, args inte
 func (c *simpleClient) Close() error {
 	c.mutex.Lock()
 	defer c.mutex.Unlock()
+	if c.shutdown {
+		return nil
+	}
 	c.shutdown = true
+	// 关闭连接后input会因为读取失败而退出
+	err := c.rwc.Close()
 
 	c.pendingCalls.Range(func(key, value interface{}) bool {
 		call, ok := value.(*Call)
@@ -130,7 +183,7 @@ func (c *simpleClient) Close() error {
 		c.pendingCalls.Delete(key)
 		return true
 	})
-	return nil
+	return err
 }
 
 func (c *simpleClient) input() {
@@ -141,6 +194,10 @@ func (c *simpleClient) input() {
 		if err != nil {
 			break
 		}
+		if response.MessageType == protocol.MessageTypeGoAway {
+			c.drain()
+			continue
+		}
 		seq := response.Seq
 		callInreface, ok := c.pendingCalls.Load(seq)
 		if !ok {
@@ -148,41 +205,72 @@ func (c *simpleClient) input() {
 			continue
 		}
 		call := callInreface.(*Call)
-		if response.MessageType != protocol.MessageTypeHeartbeat {
-			have := response.ServiceName + "." + response.MethodName
-			want := call.ServiceMethod
-			if have != want {
-				log.Fatalf("servicmethod not equal have:%s,want:%s", have, want)
-			}
+		call.stats.Mark(stats.ResponseReceived)
+		if response.MessageType == protocol.MessageTypeHeartbeat {
+			// 心跳响应没有返回值
 			c.pendingCalls.Delete(seq)
-			switch {
-			case response.Error != "":
-				call.Error = ServiceError(response.Error)
-				call.done()
-			default:
-				err = c.codec.Decode(response.Data, call.Reply)
-				if err != nil {
-					call.Error = errors.New("reading body " + err.Error())
-				}
-				call.done()
+			call.done()
+			continue
+		}
+		c.pendingCalls.Delete(seq)
+		have := response.ServiceName + "." + response.MethodName
+		if have != call.ServiceMethod {
+			// 响应和请求对不上说明服务端有问题，只让本次调用失败
+			c.callLogger(seq, call).Error("response does not match the request", logger.F("response", have))
+			call.Error = status.Errorf(protocol.StatusInternal, "response %s does not match request %s", have, call.ServiceMethod)
+			call.done()
+			continue
+		}
+		if d, ok := metadata.Int(response.MetaData, protocol.ServerTimeKey); ok {
+			call.stats.SetServerTime(time.Duration(d))
+		}
+		if d, ok := metadata.Int(response.MetaData, protocol.CacheTTLKey); ok {
+			call.stats.SetCacheTTL(time.Duration(d))
+		}
+		call.stats.SetResponseBytes(len(response.Data))
+		if se := status.FromMessage(response); se != nil {
+			call.Error = se
+		} else {
+			call.stats.Mark(stats.DecodeStart)
+			decodeErr := c.codec.Decode(response.Data, call.Reply)
+			call.stats.Mark(stats.DecodeEnd)
+			if decodeErr != nil {
+				// 返回值解析失败只影响本次调用
+				call.Error = errors.New("reading body " + decodeErr.Error())
 			}
 		}
+		call.done()
+		c.closeIfDrained()
 	}
-	log.Println("input error, closing client, error: " + err.Error())
+	c.option.log().Debug("input error, closing client", logger.F("addr", c.addr), logger.Err(err))
 	c.Close()
 }
 
+// callLogger 附加了本次调用信息的日志
+func (c *simpleClient) callLogger(seq uint64, call *Call) logger.Logger {
+	service, method := call.ServiceMethod, ""
+	if i := strings.LastIndex(service, "."); i >= 0 {
+		service, method = service[:i], service[i+1:]
+	}
+	return c.option.log().With(
+		logger.F("seq", seq),
+		logger.F("service", service),
+		logger.F("method", method),
+		logger.F("peer", c.addr),
+	)
+}
+
 func (c *simpleClient) heartbeat() {
 	t := time.NewTicker(c.option.HeartbeatInterval)
 
 	for range t.C {
-		if c.shutdown {
+		if c.IsShutDown() {
 			t.Stop()
 			return
 		}
 		err := c.Call(context.Background(), "", nil, nil)
 		if err != nil {
-			log.Printf("failed to heartbeat to %s@%s\n", c.network, c.addr)
+			c.option.log().Warn("failed to heartbeat", logger.F("network", c.network), logger.F("addr", c.addr), logger.Err(err))
 			c.mutex.Lock()
 			c.heatbeatFailNum++
 			c.mutex.Unlock()
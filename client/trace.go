@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/common/metadata"
+	"github.com/lincx-911/lincxrpc/common/stats"
+	"github.com/lincx-911/lincxrpc/status"
+	"github.com/lincx-911/lincxrpc/trace"
+)
+
+// TraceWrapper 为每次调用(包括每次重试)创建client span，并通过元数据把span上下文传给服务端
+// 序列化、网络和反序列化的耗时记录为子span，网络耗时已经扣除了服务端返回的处理时间
+type TraceWrapper struct {
+	defaultClientInterceptor
+	tracer *trace.Tracer
+}
+
+// NewTraceWrapper 创建追踪拦截器
+func NewTraceWrapper(tracer *trace.Tracer) *TraceWrapper {
+	return &TraceWrapper{tracer: tracer}
+}
+
+func (w *TraceWrapper) WrapCall(option *SGOption, callFunc CallFunc) CallFunc {
+	return func(ctx context.Context, serviceMethod string, arg interface{}, reply interface{}) error {
+		ctx, span := w.tracer.Start(ctx, serviceMethod, trace.SpanKindClient)
+		setRPCAttributes(span, serviceMethod)
+		ctx = injectSpan(ctx, span.Context)
+		ctx, st := stats.EnsureClient(ctx)
+
+		err := callFunc(ctx, serviceMethod, arg, reply)
+		end := time.Now()
+		w.recordPhases(ctx, span, st)
+		if err != nil {
+			span.SetError(err, status.Code(err))
+		}
+		span.SetAttribute("rpc.status_code", status.Code(err).String())
+		span.FinishAt(end)
+		return err
+	}
+}
+
+// WrapGo 异步调用无法得知结束的时间，只传递当前的span上下文
+func (w *TraceWrapper) WrapGo(option *SGOption, goFunc GoFunc) GoFunc {
+	return func(ctx context.Context, serviceMethod string, arg interface{}, reply interface{}, done chan *Call) *Call {
+		if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+			ctx = injectSpan(ctx, sc)
+		}
+		return goFunc(ctx, serviceMethod, arg, reply, done)
+	}
+}
+
+// recordPhases 根据调用中记录的时间点创建序列化、网络和反序列化的子span
+func (w *TraceWrapper) recordPhases(ctx context.Context, span *trace.Span, st *stats.RPCStats) {
+	w.phase(ctx, "encode", st, stats.EncodeStart, stats.EncodeEnd, nil)
+	if sent, ok := st.Time(stats.RequestSent); ok {
+		if received, ok := st.Time(stats.ResponseReceived); ok {
+			serverTime := st.ServerTime()
+			w.phase(ctx, "network", st, stats.RequestSent, stats.ResponseReceived, map[string]interface{}{
+				"rpc.server_time_ns":  int64(serverTime),
+				"rpc.network_time_ns": int64(received.Sub(sent) - serverTime),
+			})
+		}
+	}
+	w.phase(ctx, "decode", st, stats.DecodeStart, stats.DecodeEnd, nil)
+	span.SetAttribute("rpc.request_bytes", st.RequestBytes())
+	span.SetAttribute("rpc.response_bytes", st.ResponseBytes())
+}
+
+func (w *TraceWrapper) phase(ctx context.Context, name string, st *stats.RPCStats, from, to stats.Mark, attrs map[string]interface{}) {
+	start, ok := st.Time(from)
+	if !ok {
+		return
+	}
+	end, ok := st.Time(to)
+	if !ok {
+		return
+	}
+	_, span := w.tracer.StartAt(ctx, name, trace.SpanKindInternal, start)
+	for k, v := range attrs {
+		span.SetAttribute(k, v)
+	}
+	span.FinishAt(end)
+}
+
+// setRPCAttributes 设置rpc相关的通用属性
+func setRPCAttributes(span *trace.Span, serviceMethod string) {
+	service, method := serviceMethod, ""
+	if i := strings.LastIndex(serviceMethod, "."); i >= 0 {
+		service, method = serviceMethod[:i], serviceMethod[i+1:]
+	}
+	span.SetAttribute("rpc.system", "lincxrpc")
+	span.SetAttribute("rpc.service", service)
+	span.SetAttribute("rpc.method", method)
+}
+
+// injectSpan 将span上下文写入请求的元数据，复制一份元数据以免修改调用方的map
+func injectSpan(ctx context.Context, sc trace.SpanContext) context.Context {
+	src, _ := metadata.WireFromContext(ctx)
+	meta := make(map[string]interface{}, len(src)+1)
+	for k, v := range src {
+		meta[k] = v
+	}
+	trace.Inject(sc, meta)
+	return metadata.NewWireContext(ctx, meta)
+}
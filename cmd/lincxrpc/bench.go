@@ -0,0 +1,265 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/client"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/status"
+)
+
+const benchUsage = `usage: lincxrpc bench [flags] Service.Method [json-arg]
+
+Drives Service.Method through client.SGClient and reports throughput,
+latency percentiles and errors. With -rate 0 every worker sends the next
+request as soon as the previous one returns (closed loop); with -rate > 0
+requests are started on a fixed schedule (open loop) and latency is
+measured from the scheduled start, so queueing delay is included.
+
+flags:
+`
+
+// benchResult 单个worker的统计结果
+type benchResult struct {
+	latency *histogram //微秒
+	success int64
+	errors  map[string]map[string]int64 //错误类型 -> 错误信息 -> 次数
+}
+
+func newBenchResult() *benchResult {
+	return &benchResult{latency: newHistogram(), errors: make(map[string]map[string]int64)}
+}
+
+func (r *benchResult) recordError(err error) {
+	class := errorClass(err)
+	if r.errors[class] == nil {
+		r.errors[class] = make(map[string]int64)
+	}
+	r.errors[class][err.Error()]++
+}
+
+func (r *benchResult) merge(o *benchResult) {
+	r.latency.merge(o.latency)
+	r.success += o.success
+	for class, msgs := range o.errors {
+		if r.errors[class] == nil {
+			r.errors[class] = make(map[string]int64)
+		}
+		for msg, n := range msgs {
+			r.errors[class][msg] += n
+		}
+	}
+}
+
+// errorClass 区分服务端返回的错误(按状态码)、超时和传输层等客户端的错误
+func errorClass(err error) string {
+	if se, ok := status.FromError(err); ok {
+		return "service error: " + se.Code.String()
+	}
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "timeout"
+	}
+	return "transport error"
+}
+
+func runBench(args []string) error {
+	fs := flag.NewFlagSet("bench", flag.ExitOnError)
+	var cf clientFlags
+	cf.register(fs)
+	concurrency := fs.Int("c", 10, "number of concurrent workers")
+	rate := fs.Float64("rate", 0, "requests per second for open loop mode, 0 for closed loop")
+	duration := fs.Duration("d", 10*time.Second, "test duration")
+	total := fs.Int64("n", 0, "stop after this many requests, 0 for no limit")
+	payload := fs.String("payload", "", "file containing the JSON argument")
+	compress := fs.String("compress", protocol.CompressTypeNone.String(), "compress type")
+	failMode := fs.String("fail-mode", "failfast", "failfast, failover, failretry or failsafe")
+	retries := fs.Int("retries", 0, "retries for failover and failretry")
+	noReflect := fs.Bool("no-reflect", false, "do not query the reflection service, send the JSON as is")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), benchUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errors.New("missing Service.Method")
+	}
+	if *concurrency <= 0 {
+		return errors.New("-c must be positive")
+	}
+	serviceMethod := fs.Arg(0)
+	service, method, err := splitServiceMethod(serviceMethod)
+	if err != nil {
+		return err
+	}
+	var raw []byte
+	if *payload != "" {
+		raw, err = ioutil.ReadFile(*payload)
+	} else {
+		raw, err = readArg("", fs.Arg(1))
+	}
+	if err != nil {
+		return err
+	}
+
+	op, err := cf.option()
+	if err != nil {
+		return err
+	}
+	if op.CompressType, err = protocol.ParseCompressType(*compress); err != nil {
+		return err
+	}
+	if op.FailMode, err = parseFailMode(*failMode); err != nil {
+		return err
+	}
+	op.Retries = *retries
+	c := client.NewSGClient(op)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cf.timeout)
+	arg, err := cf.prepareArg(ctx, c, service, method, raw, *noReflect)
+	cancel()
+	if err != nil {
+		return err
+	}
+
+	// 每个worker发送请求前先领取一个序号，超过-n时停止
+	var issued int64
+	next := func() bool {
+		return *total <= 0 || atomic.AddInt64(&issued, 1) <= *total
+	}
+	call := func(res *benchResult, start time.Time) {
+		reply := new(interface{})
+		err := c.Call(context.Background(), serviceMethod, arg, reply)
+		res.latency.record(int64(time.Since(start) / time.Microsecond))
+		if err != nil {
+			res.recordError(err)
+			return
+		}
+		res.success++
+	}
+
+	deadline := time.Now().Add(*duration)
+	results := make([]*benchResult, *concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	if *rate > 0 {
+		// 开环：按照固定的时间表发出请求，延迟从计划的开始时间算起
+		schedule := make(chan time.Time, *concurrency*100)
+		go func() {
+			defer close(schedule)
+			interval := time.Duration(float64(time.Second) / *rate)
+			for i := 0; ; i++ {
+				t := start.Add(time.Duration(i) * interval)
+				if !t.Before(deadline) || !next() {
+					return
+				}
+				time.Sleep(time.Until(t))
+				schedule <- t
+			}
+		}()
+		for i := range results {
+			results[i] = newBenchResult()
+			wg.Add(1)
+			go func(res *benchResult) {
+				defer wg.Done()
+				for t := range schedule {
+					call(res, t)
+				}
+			}(results[i])
+		}
+	} else {
+		// 闭环：每个worker收到响应后立刻发送下一个请求
+		for i := range results {
+			results[i] = newBenchResult()
+			wg.Add(1)
+			go func(res *benchResult) {
+				defer wg.Done()
+				for time.Now().Before(deadline) && next() {
+					call(res, time.Now())
+				}
+			}(results[i])
+		}
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	summary := newBenchResult()
+	for _, res := range results {
+		summary.merge(res)
+	}
+	mode := "closed loop"
+	if *rate > 0 {
+		mode = fmt.Sprintf("open loop %.0f req/s", *rate)
+	}
+	fmt.Printf("target: %s  codec: %s  concurrency: %d  mode: %s  duration: %s\n",
+		serviceMethod, cf.codec, *concurrency, mode, elapsed.Round(time.Millisecond))
+	printReport(os.Stdout, summary, elapsed)
+	return nil
+}
+
+func printReport(w io.Writer, res *benchResult, elapsed time.Duration) {
+	h := res.latency
+	fmt.Fprintf(w, "requests: %d  success: %d  errors: %d\n", h.total, res.success, h.total-res.success)
+	fmt.Fprintf(w, "throughput: %.1f req/s\n", float64(h.total)/elapsed.Seconds())
+	if h.total > 0 {
+		ms := func(us int64) string { return fmt.Sprintf("%.3f", float64(us)/1000) }
+		fmt.Fprintf(w, "latency (ms): min %s  mean %.3f  p50 %s  p90 %s  p99 %s  p99.9 %s  max %s\n",
+			ms(h.min), h.mean()/1000, ms(h.quantile(0.5)), ms(h.quantile(0.9)),
+			ms(h.quantile(0.99)), ms(h.quantile(0.999)), ms(h.max))
+	}
+	if len(res.errors) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "errors:")
+	classes := make([]string, 0, len(res.errors))
+	for class := range res.errors {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	for _, class := range classes {
+		msgs := res.errors[class]
+		var sum int64
+		list := make([]string, 0, len(msgs))
+		for msg, n := range msgs {
+			sum += n
+			list = append(list, msg)
+		}
+		sort.Slice(list, func(i, j int) bool { return msgs[list[i]] > msgs[list[j]] })
+		fmt.Fprintf(w, "  %s: %d\n", class, sum)
+		for i, msg := range list {
+			if i == 5 {
+				fmt.Fprintf(w, "    ... %d more\n", len(list)-5)
+				break
+			}
+			fmt.Fprintf(w, "    %d\t%s\n", msgs[msg], msg)
+		}
+	}
+}
+
+// parseFailMode 解析容错模式
+func parseFailMode(name string) (client.FailMode, error) {
+	switch strings.ToLower(name) {
+	case "failfast":
+		return client.FailFast, nil
+	case "failover":
+		return client.FailOver, nil
+	case "failretry":
+		return client.FailRetry, nil
+	case "failsafe":
+		return client.FailSafe, nil
+	default:
+		return client.FailFast, fmt.Errorf("unknown fail mode %s", name)
+	}
+}
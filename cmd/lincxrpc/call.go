@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/lincx-911/lincxrpc/client"
+	"github.com/lincx-911/lincxrpc/reflection"
+)
+
+const callUsage = `usage: lincxrpc call [flags] Service.Method [json-arg]
+
+The argument is read from json-arg, -data, or stdin when neither is given.
+It is converted to the provider's types using the reflection service.
+
+flags:
+`
+
+func runCall(args []string) error {
+	fs := flag.NewFlagSet("call", flag.ExitOnError)
+	var cf clientFlags
+	cf.register(fs)
+	data := fs.String("data", "", "JSON argument, or @file to read it from a file")
+	noReflect := fs.Bool("no-reflect", false, "do not query the reflection service, send the JSON as is")
+	pretty := fs.Bool("pretty", true, "indent the JSON reply")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), callUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return errors.New("missing Service.Method")
+	}
+	serviceMethod := fs.Arg(0)
+	service, method, err := splitServiceMethod(serviceMethod)
+	if err != nil {
+		return err
+	}
+	raw, err := readArg(*data, fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	op, err := cf.option()
+	if err != nil {
+		return err
+	}
+	c := client.NewSGClient(op)
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), cf.timeout)
+	defer cancel()
+
+	converted, err := cf.prepareArg(ctx, c, service, method, raw, *noReflect)
+	if err != nil {
+		return err
+	}
+
+	reply := new(interface{})
+	if err = c.Call(ctx, serviceMethod, converted, reply); err != nil {
+		return err
+	}
+	var out []byte
+	if *pretty {
+		out, err = json.MarshalIndent(reflection.JSONValue(*reply), "", "  ")
+	} else {
+		out, err = json.Marshal(reflection.JSONValue(*reply))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
+
+// readArg 读取json参数，-data以@开头时从文件读取，都没有指定时从标准输入读取
+func readArg(data, positional string) ([]byte, error) {
+	switch {
+	case positional != "":
+		return []byte(positional), nil
+	case strings.HasPrefix(data, "@"):
+		return ioutil.ReadFile(data[1:])
+	case data != "":
+		return []byte(data), nil
+	default:
+		return ioutil.ReadAll(os.Stdin)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/client"
+	"github.com/lincx-911/lincxrpc/codec"
+	"github.com/lincx-911/lincxrpc/reflection"
+	"github.com/lincx-911/lincxrpc/registry"
+	"github.com/lincx-911/lincxrpc/registry/kvregistry"
+)
+
+// multiFlag 可以重复指定的参数
+type multiFlag []string
+
+func (m *multiFlag) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *multiFlag) Set(v string) error {
+	*m = append(*m, v)
+	return nil
+}
+
+// clientFlags 创建客户端所需的参数，call和bench共用
+type clientFlags struct {
+	addr         string
+	network      string
+	registry     string
+	registryAddr string
+	basePath     string
+	app          string
+	codec        string
+	timeout      time.Duration
+	auth         string
+	meta         multiFlag
+}
+
+func (f *clientFlags) register(fs *flag.FlagSet) {
+	fs.StringVar(&f.addr, "addr", "", "connect to this provider address directly, e.g. 127.0.0.1:8880")
+	fs.StringVar(&f.network, "network", "tcp", "network of -addr")
+	fs.StringVar(&f.registry, "registry", "", "registry backend used to discover providers: zk, consul or boltdb")
+	fs.StringVar(&f.registryAddr, "registry-addr", "", "comma separated registry addresses")
+	fs.StringVar(&f.basePath, "base-path", "/lincxrpc/service", "service path in the registry")
+	fs.StringVar(&f.app, "app", "", "AppKey of the application to call")
+	fs.StringVar(&f.codec, "codec", codec.MessagePackType.String(), "serialize type: messagepack or json")
+	fs.DurationVar(&f.timeout, "timeout", 5*time.Second, "request timeout")
+	fs.StringVar(&f.auth, "auth", "", "auth token sent with every request")
+	fs.Var(&f.meta, "meta", "metadata key=value sent with every request, can be repeated")
+}
+
+// serializeType 解析-codec
+func (f *clientFlags) serializeType() (codec.SerializeType, error) {
+	return codec.ParseSerializeType(f.codec)
+}
+
+// option 根据参数生成客户端配置
+func (f *clientFlags) option() (client.SGOption, error) {
+	op := client.DefaultSGOption
+	st, err := f.serializeType()
+	if err != nil {
+		return op, err
+	}
+	op.SerializeType = st
+	op.RequestTimeout = f.timeout
+	op.DialTimeout = f.timeout
+	op.RemoteAppkey = f.app
+	op.Auth = f.auth
+	op.Meta = make(map[string]string)
+	for _, kv := range f.meta {
+		pair := strings.SplitN(kv, "=", 2)
+		if len(pair) != 2 {
+			return op, fmt.Errorf("invalid -meta %q, want key=value", kv)
+		}
+		op.Meta[pair[0]] = pair[1]
+	}
+
+	switch {
+	case f.addr != "":
+		op.Registry = registry.NewPeer2PeerRegistry().WithProvider(registry.Provider{
+			ProviderKey: f.network + "@" + f.addr,
+			Network:     f.network,
+			Addr:        f.addr,
+		})
+	case f.registry != "":
+		if f.registryAddr == "" {
+			return op, errors.New("-registry-addr is required with -registry")
+		}
+		op.Registry = kvregistry.NewKVRegistryWithOption(kvregistry.Option{
+			Backend:        kvregistry.Backend(f.registry),
+			Addrs:          strings.Split(f.registryAddr, ","),
+			AppKey:         f.app,
+			ServicePath:    f.basePath,
+			UpdateInterval: 10 * time.Second,
+		})
+	default:
+		return op, errors.New("either -addr or -registry is required")
+	}
+	return op, nil
+}
+
+// splitServiceMethod 解析Service.Method
+func splitServiceMethod(serviceMethod string) (string, string, error) {
+	i := strings.LastIndex(serviceMethod, ".")
+	if i <= 0 || i == len(serviceMethod)-1 {
+		return "", "", fmt.Errorf("invalid method %q, want Service.Method", serviceMethod)
+	}
+	return serviceMethod[:i], serviceMethod[i+1:], nil
+}
+
+// describeMethod 通过反射服务查询方法的描述
+func describeMethod(ctx context.Context, c client.SGClient, service, method string) (*reflection.MethodDescriptor, error) {
+	resp := &reflection.DescribeResponse{}
+	err := c.Call(ctx, reflection.ServiceName+"."+reflection.DescribeMethod, reflection.DescribeRequest{Service: service}, resp)
+	if err != nil {
+		return nil, err
+	}
+	for _, sd := range resp.Services {
+		if sd.Name != service {
+			continue
+		}
+		if md, ok := sd.Method(method); ok {
+			return md, nil
+		}
+	}
+	return nil, fmt.Errorf("can not find method %s.%s", service, method)
+}
+
+// prepareArg 解析json参数，并通过反射服务转换为服务端参数类型对应的编码
+func (f *clientFlags) prepareArg(ctx context.Context, c client.SGClient, service, method string, raw []byte, noReflect bool) (interface{}, error) {
+	var arg interface{}
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&arg); err != nil {
+		return nil, fmt.Errorf("invalid JSON argument: %v", err)
+	}
+	st, err := f.serializeType()
+	if err != nil {
+		return nil, err
+	}
+	var argType *reflection.TypeDescriptor
+	if !noReflect {
+		md, err := describeMethod(ctx, c, service, method)
+		if err != nil {
+			return nil, fmt.Errorf("describe %s.%s: %v (use -no-reflect to skip)", service, method, err)
+		}
+		argType = md.ArgType
+	}
+	return reflection.Convert(arg, argType, st)
+}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const genUsage = `usage: lincxrpc gen [flags] -type Type[,Type...]
+
+Reads the Go package in -dir and, for every listed service type, writes a
+typed client wrapping client.SGClient, a server interface and a
+registration helper. Methods must look like
+	func (T) Method(ctx context.Context, arg A, reply *R) error
+
+The code is generated into its own package (default <package>rpc under
+-dir), so the package declaring the types does not depend on client or
+server.
+
+flags:
+`
+
+// genMethod 生成代码用到的方法信息
+type genMethod struct {
+	Name      string
+	ArgType   string
+	ReplyType string //去掉指针后的返回值类型
+}
+
+// genService 生成代码用到的服务信息
+type genService struct {
+	Type    string
+	Name    string
+	Methods []genMethod
+}
+
+func runGen(args []string) error {
+	fs := flag.NewFlagSet("gen", flag.ExitOnError)
+	typeNames := fs.String("type", "", "comma separated service type names")
+	dir := fs.String("dir", ".", "directory of the package that declares the types")
+	output := fs.String("o", "", "output file, default <package>rpc/<type>_lincxrpc.go in -dir")
+	outPkg := fs.String("pkg", "", "package name of the generated code, default <package>rpc")
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), genUsage)
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if *typeNames == "" {
+		fs.Usage()
+		return errors.New("missing -type")
+	}
+
+	fset := token.NewFileSet()
+	pkgs, err := parser.ParseDir(fset, *dir, func(fi os.FileInfo) bool {
+		return !strings.HasSuffix(fi.Name(), "_test.go") && !strings.HasSuffix(fi.Name(), "_lincxrpc.go")
+	}, 0)
+	if err != nil {
+		return err
+	}
+	if len(pkgs) != 1 {
+		return fmt.Errorf("expect one package in %s, found %d", *dir, len(pkgs))
+	}
+	var pkg *ast.Package
+	for _, p := range pkgs {
+		pkg = p
+	}
+
+	importPath, err := packageImportPath(*dir)
+	if err != nil {
+		return err
+	}
+	if *outPkg == "" {
+		*outPkg = pkg.Name + "rpc"
+	}
+
+	types := strings.Split(*typeNames, ",")
+	imports := make(map[string]string) //包名 -> import语句
+	// 生成的代码在单独的包中，类型所在的包需要导入
+	imports[pkg.Name] = strconv.Quote(importPath)
+	if path.Base(importPath) != pkg.Name {
+		imports[pkg.Name] = pkg.Name + " " + strconv.Quote(importPath)
+	}
+	q := &qualifier{pkg: pkg.Name, local: localTypes(pkg)}
+	var services []genService
+	for _, typ := range types {
+		srv, err := collectService(fset, pkg, strings.TrimSpace(typ), imports, q)
+		if err != nil {
+			return err
+		}
+		services = append(services, srv)
+	}
+
+	importList := make([]string, 0, len(imports))
+	for _, spec := range imports {
+		importList = append(importList, spec)
+	}
+	sort.Strings(importList)
+	var buf bytes.Buffer
+	err = genTemplate.Execute(&buf, map[string]interface{}{
+		"Package":  *outPkg,
+		"Imports":  importList,
+		"Services": services,
+	})
+	if err != nil {
+		return err
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("format generated code: %v", err)
+	}
+	out := *output
+	if out == "" {
+		out = filepath.Join(*dir, *outPkg, strings.ToLower(types[0])+"_lincxrpc.go")
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(out, src, 0644)
+}
+
+// packageImportPath 目录中的包的导入路径
+func packageImportPath(dir string) (string, error) {
+	cmd := exec.Command("go", "list", "-f", "{{.ImportPath}}")
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("resolve import path of %s: %v", dir, err)
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// localTypes 包中声明的类型名
+func localTypes(pkg *ast.Package) map[string]bool {
+	types := make(map[string]bool)
+	for _, file := range pkg.Files {
+		for _, decl := range file.Decls {
+			gen, ok := decl.(*ast.GenDecl)
+			if !ok || gen.Tok != token.TYPE {
+				continue
+			}
+			for _, spec := range gen.Specs {
+				types[spec.(*ast.TypeSpec).Name.Name] = true
+			}
+		}
+	}
+	return types
+}
+
+// qualifier 将类型表达式中引用的本包类型加上包名
+type qualifier struct {
+	pkg        string
+	local      map[string]bool
+	unexported []string //引用到的未导出类型，生成的包中无法使用
+}
+
+func (q *qualifier) typeString(fset *token.FileSet, expr ast.Expr) string {
+	switch expr := expr.(type) {
+	case *ast.Ident:
+		if q.local[expr.Name] {
+			if !expr.IsExported() {
+				q.unexported = append(q.unexported, expr.Name)
+			}
+			return q.pkg + "." + expr.Name
+		}
+		return expr.Name
+	case *ast.StarExpr:
+		return "*" + q.typeString(fset, expr.X)
+	case *ast.ArrayType:
+		if expr.Len == nil {
+			return "[]" + q.typeString(fset, expr.Elt)
+		}
+		return "[" + exprString(fset, expr.Len) + "]" + q.typeString(fset, expr.Elt)
+	case *ast.MapType:
+		return "map[" + q.typeString(fset, expr.Key) + "]" + q.typeString(fset, expr.Value)
+	case *ast.ChanType:
+		switch expr.Dir {
+		case ast.SEND:
+			return "chan<- " + q.typeString(fset, expr.Value)
+		case ast.RECV:
+			return "<-chan " + q.typeString(fset, expr.Value)
+		}
+		return "chan " + q.typeString(fset, expr.Value)
+	default:
+		//其他包的类型以及字面量类型原样输出
+		return exprString(fset, expr)
+	}
+}
+
+// collectService 收集类型上符合rpc规则的方法，参数类型引用的包记录到imports
+func collectService(fset *token.FileSet, pkg *ast.Package, typ string, imports map[string]string, q *qualifier) (genService, error) {
+	srv := genService{Type: typ, Name: typ}
+	found := false
+	for _, file := range pkg.Files {
+		fileImports := importsOf(file)
+		for _, decl := range file.Decls {
+			switch decl := decl.(type) {
+			case *ast.GenDecl:
+				for _, spec := range decl.Specs {
+					if ts, ok := spec.(*ast.TypeSpec); ok && ts.Name.Name == typ {
+						found = true
+					}
+				}
+			case *ast.FuncDecl:
+				if decl.Recv == nil || receiverName(decl.Recv) != typ || !decl.Name.IsExported() {
+					continue
+				}
+				m, ok := rpcMethod(fset, decl, q)
+				if !ok {
+					continue
+				}
+				if len(q.unexported) > 0 {
+					return srv, fmt.Errorf("%s.%s: unexported type %s can not be used by the generated package", typ, m.Name, q.unexported[0])
+				}
+				for _, name := range referencedPackages(decl.Type.Params.List[1:]) {
+					spec, ok := fileImports[name]
+					if !ok {
+						return srv, fmt.Errorf("%s.%s: can not resolve package %s", typ, m.Name, name)
+					}
+					imports[name] = spec
+				}
+				srv.Methods = append(srv.Methods, m)
+			}
+		}
+	}
+	if !found {
+		return srv, fmt.Errorf("type %s not found in package %s", typ, pkg.Name)
+	}
+	if len(srv.Methods) == 0 {
+		return srv, fmt.Errorf("type %s has no exported methods of suitable type", typ)
+	}
+	sort.Slice(srv.Methods, func(i, j int) bool {
+		return srv.Methods[i].Name < srv.Methods[j].Name
+	})
+	return srv, nil
+}
+
+// receiverName 接收者的类型名，去掉指针
+func receiverName(recv *ast.FieldList) string {
+	if len(recv.List) == 0 {
+		return ""
+	}
+	expr := recv.List[0].Type
+	if star, ok := expr.(*ast.StarExpr); ok {
+		expr = star.X
+	}
+	if ident, ok := expr.(*ast.Ident); ok {
+		return ident.Name
+	}
+	return ""
+}
+
+// rpcMethod 判断方法是否符合 func(ctx context.Context, arg A, reply *R) error
+func rpcMethod(fset *token.FileSet, decl *ast.FuncDecl, q *qualifier) (genMethod, bool) {
+	var params []ast.Expr
+	for _, field := range decl.Type.Params.List {
+		n := len(field.Names)
+		if n == 0 {
+			n = 1
+		}
+		for i := 0; i < n; i++ {
+			params = append(params, field.Type)
+		}
+	}
+	if len(params) != 3 {
+		return genMethod{}, false
+	}
+	if sel, ok := params[0].(*ast.SelectorExpr); !ok || sel.Sel.Name != "Context" {
+		return genMethod{}, false
+	}
+	reply, ok := params[2].(*ast.StarExpr)
+	if !ok {
+		return genMethod{}, false
+	}
+	results := decl.Type.Results
+	if results == nil || len(results.List) != 1 || len(results.List[0].Names) > 1 {
+		return genMethod{}, false
+	}
+	if ident, ok := results.List[0].Type.(*ast.Ident); !ok || ident.Name != "error" {
+		return genMethod{}, false
+	}
+	return genMethod{
+		Name:      decl.Name.Name,
+		ArgType:   q.typeString(fset, params[1]),
+		ReplyType: q.typeString(fset, reply.X),
+	}, true
+}
+
+// importsOf 文件中的import，包名 -> import语句
+func importsOf(file *ast.File) map[string]string {
+	imports := make(map[string]string)
+	for _, spec := range file.Imports {
+		path, _ := strconv.Unquote(spec.Path.Value)
+		name := path[strings.LastIndex(path, "/")+1:]
+		line := spec.Path.Value
+		if spec.Name != nil {
+			name = spec.Name.Name
+			line = name + " " + line
+		}
+		imports[name] = line
+	}
+	return imports
+}
+
+// referencedPackages 参数类型中引用的包名
+func referencedPackages(fields []*ast.Field) []string {
+	var names []string
+	for _, field := range fields {
+		ast.Inspect(field.Type, func(n ast.Node) bool {
+			if sel, ok := n.(*ast.SelectorExpr); ok {
+				if ident, ok := sel.X.(*ast.Ident); ok {
+					names = append(names, ident.Name)
+				}
+				return false
+			}
+			return true
+		})
+	}
+	return names
+}
+
+func exprString(fset *token.FileSet, expr ast.Expr) string {
+	var buf bytes.Buffer
+	printer.Fprint(&buf, fset, expr)
+	return buf.String()
+}
+
+var genTemplate = template.Must(template.New("gen").Parse(`// Code generated by lincxrpc gen. DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"context"
+
+	"github.com/lincx-911/lincxrpc/client"
+	"github.com/lincx-911/lincxrpc/server"
+{{- range .Imports}}
+	{{.}}
+{{- end}}
+)
+{{range .Services}}{{$svc := .}}
+// {{.Type}}ServiceName {{.Type}}的服务名
+const {{.Type}}ServiceName = "{{.Name}}"
+
+// {{.Type}}Client {{.Type}}服务的客户端
+type {{.Type}}Client struct {
+	c client.SGClient
+}
+
+// New{{.Type}}Client 使用SGClient创建{{.Type}}服务的客户端
+func New{{.Type}}Client(c client.SGClient) *{{.Type}}Client {
+	return &{{.Type}}Client{c: c}
+}
+{{range .Methods}}
+// {{.Name}} 调用{{$svc.Name}}.{{.Name}}
+func (c *{{$svc.Type}}Client) {{.Name}}(ctx context.Context, arg {{.ArgType}}) (*{{.ReplyType}}, error) {
+	reply := new({{.ReplyType}})
+	if err := c.c.Call(ctx, {{$svc.Type}}ServiceName+".{{.Name}}", arg, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+{{end}}
+// {{.Type}}Server {{.Type}}服务需要实现的方法
+type {{.Type}}Server interface {
+{{- range .Methods}}
+	{{.Name}}(ctx context.Context, arg {{.ArgType}}, reply *{{.ReplyType}}) error
+{{- end}}
+}
+
+// Register{{.Type}}Server 以{{.Type}}ServiceName注册{{.Type}}服务
+func Register{{.Type}}Server(s server.RPCServer, srv {{.Type}}Server) error {
+	return s.RegisterName({{.Type}}ServiceName, srv)
+}
+{{end}}`))
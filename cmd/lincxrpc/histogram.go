@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math"
+	"math/bits"
+)
+
+// subBucketBits 每个2的幂区间内的子桶数为2^subBucketBits，相对误差小于1/128
+const subBucketBits = 7
+
+// histogram HDR风格的直方图，按对数-线性分桶记录整数值，内存固定并且保持相对精度
+type histogram struct {
+	counts []int64
+	total  int64
+	min    int64
+	max    int64
+	sum    float64
+}
+
+func newHistogram() *histogram {
+	return &histogram{
+		counts: make([]int64, (1<<subBucketBits)*(64-subBucketBits+1)),
+		min:    math.MaxInt64,
+	}
+}
+
+// bucketIndex 值所在的桶，小于2^subBucketBits的值精确记录
+func bucketIndex(v int64) int {
+	if v < 1<<subBucketBits {
+		return int(v)
+	}
+	magnitude := bits.Len64(uint64(v)) - 1
+	shift := uint(magnitude - subBucketBits)
+	sub := int(uint64(v)>>shift) - 1<<subBucketBits
+	return (1 << subBucketBits) + (magnitude-subBucketBits)*(1<<subBucketBits) + sub
+}
+
+// bucketValue 桶内的最大值
+func bucketValue(idx int) int64 {
+	if idx < 1<<subBucketBits {
+		return int64(idx)
+	}
+	magnitude := idx>>subBucketBits - 1 + subBucketBits
+	sub := idx & (1<<subBucketBits - 1)
+	shift := uint(magnitude - subBucketBits)
+	lowest := int64(1<<subBucketBits+sub) << shift
+	return lowest + int64(1)<<shift - 1
+}
+
+// record 记录一个值，负数按0记录
+func (h *histogram) record(v int64) {
+	if v < 0 {
+		v = 0
+	}
+	h.counts[bucketIndex(v)]++
+	h.total++
+	h.sum += float64(v)
+	if v < h.min {
+		h.min = v
+	}
+	if v > h.max {
+		h.max = v
+	}
+}
+
+// merge 合并另一个直方图
+func (h *histogram) merge(o *histogram) {
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.total += o.total
+	h.sum += o.sum
+	if o.min < h.min {
+		h.min = o.min
+	}
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+// quantile 获取分位数，q的范围为[0,1]
+func (h *histogram) quantile(q float64) int64 {
+	if h.total == 0 {
+		return 0
+	}
+	target := int64(math.Ceil(q * float64(h.total)))
+	if target < 1 {
+		target = 1
+	}
+	var count int64
+	for i, c := range h.counts {
+		count += c
+		if count >= target {
+			v := bucketValue(i)
+			if v > h.max {
+				v = h.max
+			}
+			return v
+		}
+	}
+	return h.max
+}
+
+func (h *histogram) mean() float64 {
+	if h.total == 0 {
+		return 0
+	}
+	return h.sum / float64(h.total)
+}
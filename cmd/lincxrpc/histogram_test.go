@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestHistogramSmallValuesExact(t *testing.T) {
+	h := newHistogram()
+	for v := int64(1); v <= 100; v++ {
+		h.record(v)
+	}
+	tests := []struct {
+		q    float64
+		want int64
+	}{{0, 1}, {0.5, 50}, {0.9, 90}, {0.99, 99}, {1, 100}}
+	for _, tt := range tests {
+		if got := h.quantile(tt.q); got != tt.want {
+			t.Fatalf("quantile(%v) = %d, want %d", tt.q, got, tt.want)
+		}
+	}
+	if h.mean() != 50.5 || h.min != 1 || h.max != 100 {
+		t.Fatalf("mean = %v, min = %d, max = %d", h.mean(), h.min, h.max)
+	}
+}
+
+func TestHistogramRelativeError(t *testing.T) {
+	h := newHistogram()
+	r := rand.New(rand.NewSource(1))
+	values := make([]int64, 100000)
+	for i := range values {
+		// 1us到10s的纳秒值，跨越多个数量级
+		values[i] = int64(math.Exp(r.Float64()*math.Log(1e7))) * 1000
+		h.record(values[i])
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i] < values[j] })
+	for _, q := range []float64{0.5, 0.9, 0.99, 0.999} {
+		want := values[int(math.Ceil(q*float64(len(values))))-1]
+		got := h.quantile(q)
+		if got < want || float64(got-want) > float64(want)/(1<<subBucketBits) {
+			t.Fatalf("quantile(%v) = %d, want %d within 1/%d", q, got, want, 1<<subBucketBits)
+		}
+	}
+	if h.quantile(1) != values[len(values)-1] {
+		t.Fatalf("quantile(1) = %d, want max %d", h.quantile(1), values[len(values)-1])
+	}
+}
+
+func TestHistogramBuckets(t *testing.T) {
+	for _, v := range []int64{0, 127, 128, 255, 256, 1 << 20, 1<<20 + 12345, math.MaxInt64} {
+		idx := bucketIndex(v)
+		if idx >= len(newHistogram().counts) {
+			t.Fatalf("bucketIndex(%d) = %d out of range", v, idx)
+		}
+		if upper := bucketValue(idx); upper < v {
+			t.Fatalf("bucketValue(%d) = %d, below %d", idx, upper, v)
+		}
+		if idx > 0 && bucketValue(idx-1) >= v {
+			t.Fatalf("value %d also fits bucket %d", v, idx-1)
+		}
+	}
+}
+
+func TestHistogramMergeAndEmpty(t *testing.T) {
+	a, b := newHistogram(), newHistogram()
+	if a.quantile(0.5) != 0 || a.mean() != 0 {
+		t.Fatal("empty histogram should report 0")
+	}
+	a.record(-5)
+	b.record(1000)
+	b.record(2000)
+	a.merge(b)
+	if a.total != 3 || a.min != 0 || a.max != 2000 {
+		t.Fatalf("total = %d, min = %d, max = %d", a.total, a.min, a.max)
+	}
+	if got := a.quantile(1); got != 2000 {
+		t.Fatalf("quantile(1) = %d, want 2000", got)
+	}
+}
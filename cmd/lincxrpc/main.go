@@ -0,0 +1,47 @@
+// lincxrpc 命令行工具
+//
+//	lincxrpc call [flags] Service.Method '{"A":1,"B":2}'
+//	lincxrpc bench [flags] Service.Method '{"A":1,"B":2}'
+//	lincxrpc gen -type Arith
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+const usage = `usage: lincxrpc <command> [flags] [args]
+
+commands:
+  call    invoke Service.Method with a JSON argument and print the reply as JSON
+  bench   drive Service.Method with load and report throughput and latency
+  gen     generate a typed client and server helpers from Go service types
+
+run "lincxrpc <command> -h" for the flags of a command
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+	var err error
+	switch os.Args[1] {
+	case "call":
+		err = runCall(os.Args[2:])
+	case "bench":
+		err = runBench(os.Args[2:])
+	case "gen":
+		err = runGen(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error: "+err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,143 @@
+// protoc-gen-lincxrpc 根据.proto中的service生成lincxrpc的服务端接口和客户端
+//
+//	protoc --go_out=. --lincxrpc_out=. greeter.proto
+//
+// 每个service生成：
+//   - <Service>ServiceName 服务名常量
+//   - <Service>Server 服务端接口，方法签名为 (ctx, *Req, *Resp) error，可直接用于SGServer.Register
+//   - Register<Service>Server 以服务名注册服务
+//   - <Service>Client 包装client.SGClient的客户端，New<Service>SGClient默认使用ProtoBufType序列化
+//
+// lincxrpc只支持一元调用，streaming方法会被跳过
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+const version = "0.1.0"
+
+const (
+	contextPackage = protogen.GoImportPath("context")
+	clientPackage  = protogen.GoImportPath("github.com/lincx-911/lincxrpc/client")
+	serverPackage  = protogen.GoImportPath("github.com/lincx-911/lincxrpc/server")
+	codecPackage   = protogen.GoImportPath("github.com/lincx-911/lincxrpc/codec")
+)
+
+func main() {
+	showVersion := flag.Bool("version", false, "print the version and exit")
+	flag.Parse()
+	if *showVersion {
+		fmt.Printf("protoc-gen-lincxrpc %v\n", version)
+		return
+	}
+
+	var flags flag.FlagSet
+	protogen.Options{ParamFunc: flags.Set}.Run(func(gen *protogen.Plugin) error {
+		gen.SupportedFeatures = uint64(pluginpb.CodeGeneratorResponse_FEATURE_PROTO3_OPTIONAL)
+		for _, f := range gen.Files {
+			if f.Generate && len(f.Services) > 0 {
+				generateFile(gen, f)
+			}
+		}
+		return nil
+	})
+}
+
+// generateFile 为proto文件生成 <name>_lincxrpc.pb.go
+func generateFile(gen *protogen.Plugin, file *protogen.File) {
+	filename := file.GeneratedFilenamePrefix + "_lincxrpc.pb.go"
+	g := gen.NewGeneratedFile(filename, file.GoImportPath)
+	g.P("// Code generated by protoc-gen-lincxrpc. DO NOT EDIT.")
+	g.P("// versions:")
+	g.P("// \tprotoc-gen-lincxrpc v", version)
+	if file.Proto.GetOptions().GetDeprecated() {
+		g.P("// ", file.Desc.Path(), " is a deprecated file.")
+	} else {
+		g.P("// source: ", file.Desc.Path())
+	}
+	g.P()
+	g.P("package ", file.GoPackageName)
+	g.P()
+	for _, service := range file.Services {
+		generateService(g, service)
+	}
+}
+
+// unaryMethods 过滤掉lincxrpc不支持的streaming方法
+func unaryMethods(service *protogen.Service) []*protogen.Method {
+	var methods []*protogen.Method
+	for _, method := range service.Methods {
+		if method.Desc.IsStreamingClient() || method.Desc.IsStreamingServer() {
+			continue
+		}
+		methods = append(methods, method)
+	}
+	return methods
+}
+
+func generateService(g *protogen.GeneratedFile, service *protogen.Service) {
+	name := service.GoName
+	methods := unaryMethods(service)
+	ctx := g.QualifiedGoIdent(contextPackage.Ident("Context"))
+
+	g.P("// ", name, "ServiceName ", service.Desc.FullName(), "的服务名")
+	g.P("const ", name, "ServiceName = ", fmt.Sprintf("%q", service.Desc.FullName()))
+	g.P()
+
+	// 服务端接口
+	g.Annotate(name+"Server", service.Location)
+	g.P("// ", name, "Server ", name, "服务需要实现的方法")
+	if service.Comments.Leading != "" {
+		g.P("//")
+	}
+	g.P(service.Comments.Leading, "type ", name, "Server interface {")
+	for _, method := range methods {
+		g.Annotate(name+"Server."+method.GoName, method.Location)
+		g.P(method.Comments.Leading, method.GoName, "(ctx ", ctx, ", arg *", g.QualifiedGoIdent(method.Input.GoIdent),
+			", reply *", g.QualifiedGoIdent(method.Output.GoIdent), ") error")
+	}
+	g.P("}")
+	g.P()
+
+	g.P("// Register", name, "Server 以", name, "ServiceName注册", name, "服务")
+	g.P("func Register", name, "Server(s ", g.QualifiedGoIdent(serverPackage.Ident("RPCServer")), ", srv ", name, "Server) error {")
+	g.P("return s.RegisterName(", name, "ServiceName, srv)")
+	g.P("}")
+	g.P()
+
+	// 客户端
+	sgClient := g.QualifiedGoIdent(clientPackage.Ident("SGClient"))
+	g.P("// ", name, "Client ", name, "服务的客户端")
+	g.P("type ", name, "Client struct {")
+	g.P("c ", sgClient)
+	g.P("}")
+	g.P()
+	g.P("// New", name, "Client 使用SGClient创建", name, "服务的客户端，SGClient需要使用ProtoBufType序列化")
+	g.P("func New", name, "Client(c ", sgClient, ") *", name, "Client {")
+	g.P("return &", name, "Client{c: c}")
+	g.P("}")
+	g.P()
+	g.P("// New", name, "SGClient 使用ProtoBufType序列化创建", name, "服务的客户端")
+	g.P("func New", name, "SGClient(option ", g.QualifiedGoIdent(clientPackage.Ident("SGOption")), ") *", name, "Client {")
+	g.P("option.SerializeType = ", g.QualifiedGoIdent(codecPackage.Ident("ProtoBufType")))
+	g.P("return New", name, "Client(", g.QualifiedGoIdent(clientPackage.Ident("NewSGClient")), "(option))")
+	g.P("}")
+	g.P()
+	for _, method := range methods {
+		output := g.QualifiedGoIdent(method.Output.GoIdent)
+		g.P("// ", method.GoName, " 调用", name, ".", method.GoName)
+		g.P("func (c *", name, "Client) ", method.GoName, "(ctx ", ctx, ", arg *", g.QualifiedGoIdent(method.Input.GoIdent), ") (*", output, ", error) {")
+		g.P("reply := new(", output, ")")
+		g.P("if err := c.c.Call(ctx, ", name, "ServiceName+", fmt.Sprintf("%q", "."+method.GoName), ", arg, reply); err != nil {")
+		g.P("return nil, err")
+		g.P("}")
+		g.P("return reply, nil")
+		g.P("}")
+		g.P()
+	}
+}
@@ -2,21 +2,208 @@ package metadata
 
 import (
 	"context"
+	"fmt"
+	"strings"
 
+	"github.com/lincx-911/lincxrpc/internal/convert"
 	"github.com/lincx-911/lincxrpc/protocol"
 )
 
-// FromContext 从ctx中读取meta数据 格式为map[string]interface{}
-func FromContext(ctx context.Context) map[string]interface{} {
-	mateData, ok := ctx.Value(protocol.MetaDataKey).(map[string]interface{})
+// ReservedPrefix 框架使用的元数据键的前缀，业务设置的这类键不会被发送
+const ReservedPrefix = "rpc_"
+
+// BinarySuffix 以该后缀结尾的键的值为二进制数据，传输时使用二进制类型
+const BinarySuffix = "-bin"
+
+// MD 业务元数据，值为字符串，键以BinarySuffix结尾时值可以是任意字节
+type MD map[string]string
+
+// New 由map创建MD，忽略保留键
+func New(m map[string]string) MD {
+	md := make(MD, len(m))
+	for k, v := range m {
+		md.Set(k, v)
+	}
+	return md
+}
+
+// Pairs 由键值对创建MD，参数个数为奇数时panic
+func Pairs(kv ...string) MD {
+	if len(kv)%2 == 1 {
+		panic(fmt.Sprintf("metadata: Pairs got an odd number of arguments: %d", len(kv)))
+	}
+	md := make(MD, len(kv)/2)
+	for i := 0; i < len(kv); i += 2 {
+		md.Set(kv[i], kv[i+1])
+	}
+	return md
+}
+
+// Get 读取键对应的值
+func (md MD) Get(key string) (string, bool) {
+	v, ok := md[key]
+	return v, ok
+}
+
+// Set 设置键值，保留键会被忽略
+func (md MD) Set(key, value string) {
+	if IsReserved(key) {
+		return
+	}
+	md[key] = value
+}
+
+// Delete 删除键
+func (md MD) Delete(key string) {
+	delete(md, key)
+}
+
+// Copy 复制一份MD
+func (md MD) Copy() MD {
+	res := make(MD, len(md))
+	for k, v := range md {
+		res[k] = v
+	}
+	return res
+}
+
+// Join 合并多个MD，相同的键后面的覆盖前面的
+func Join(mds ...MD) MD {
+	res := make(MD)
+	for _, md := range mds {
+		for k, v := range md {
+			res.Set(k, v)
+		}
+	}
+	return res
+}
+
+// IsReserved 是否为框架保留的键
+func IsReserved(key string) bool {
+	return strings.HasPrefix(key, ReservedPrefix)
+}
+
+// isBinary 键对应的值是否为二进制数据
+func isBinary(key string) bool {
+	return strings.HasSuffix(key, BinarySuffix)
+}
+
+// NewIncomingContext 将收到的请求的元数据设置在ctx中，由服务端调用，raw不会被修改
+func NewIncomingContext(ctx context.Context, raw map[string]interface{}) context.Context {
+	return context.WithValue(ctx, protocol.IncomingMetaDataKey, raw)
+}
 
-	if !ok || mateData == nil {
-		mateData = make(map[string]interface{})
+// FromIncoming 读取收到的请求中的业务元数据，不包含保留键，返回的是副本
+func FromIncoming(ctx context.Context) MD {
+	raw, _ := ctx.Value(protocol.IncomingMetaDataKey).(map[string]interface{})
+	md := make(MD, len(raw))
+	for k, v := range raw {
+		if IsReserved(k) {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			md[k] = v
+		case []byte:
+			md[k] = string(v)
+		case nil:
+		default:
+			md[k] = fmt.Sprint(v)
+		}
+	}
+	return md
+}
+
+// NewOutgoingContext 设置调用下游时发送的元数据，会替换ctx中已有的outgoing元数据
+func NewOutgoingContext(ctx context.Context, md MD) context.Context {
+	return context.WithValue(ctx, protocol.OutgoingMetaDataKey, New(md))
+}
+
+// AppendToOutgoing 在ctx已有的outgoing元数据上追加键值对，不会修改原来的ctx，参数个数为奇数时panic
+func AppendToOutgoing(ctx context.Context, kv ...string) context.Context {
+	md := Join(outgoing(ctx), Pairs(kv...))
+	return context.WithValue(ctx, protocol.OutgoingMetaDataKey, md)
+}
+
+// FromOutgoing 读取调用下游时发送的元数据，返回的是副本
+func FromOutgoing(ctx context.Context) MD {
+	return outgoing(ctx).Copy()
+}
+
+func outgoing(ctx context.Context) MD {
+	md, _ := ctx.Value(protocol.OutgoingMetaDataKey).(MD)
+	return md
+}
+
+// ToWire 生成ctx中待发送的业务元数据(outgoing元数据以及旧的WithMeta设置的map)，不包含保留键，返回新的map
+func ToWire(ctx context.Context) map[string]interface{} {
+	legacy, _ := ctx.Value(protocol.MetaDataKey).(map[string]interface{})
+	md := outgoing(ctx)
+	wire := make(map[string]interface{}, len(legacy)+len(md))
+	for k, v := range legacy {
+		if !IsReserved(k) {
+			wire[k] = v
+		}
+	}
+	for k, v := range md {
+		SetWire(wire, k, v)
+	}
+	return wire
+}
+
+// SetWire 按传输格式设置一个业务元数据，保留键会被忽略
+func SetWire(wire map[string]interface{}, key, value string) {
+	if IsReserved(key) {
+		return
+	}
+	if isBinary(key) {
+		wire[key] = []byte(value)
+	} else {
+		wire[key] = value
+	}
+}
+
+// NewWireContext 设置本次调用实际发送的元数据，包含框架的保留键，由客户端拦截器调用
+func NewWireContext(ctx context.Context, wire map[string]interface{}) context.Context {
+	return context.WithValue(ctx, protocol.WireMetaDataKey, wire)
+}
+
+// WireFromContext 读取本次调用实际发送的元数据，调用方不能修改返回的map
+func WireFromContext(ctx context.Context) (map[string]interface{}, bool) {
+	wire, ok := ctx.Value(protocol.WireMetaDataKey).(map[string]interface{})
+	return wire, ok
+}
+
+// FromContext 从ctx中读取meta数据 格式为map[string]interface{}，返回的是副本
+// 有WithMeta设置的map时返回它，否则返回收到的请求的元数据
+//
+// Deprecated: 读取收到的元数据使用FromIncoming，发送元数据使用NewOutgoingContext或AppendToOutgoing
+func FromContext(ctx context.Context) map[string]interface{} {
+	src, ok := ctx.Value(protocol.MetaDataKey).(map[string]interface{})
+	if !ok {
+		src, _ = ctx.Value(protocol.IncomingMetaDataKey).(map[string]interface{})
+	}
+	mateData := make(map[string]interface{}, len(src))
+	for k, v := range src {
+		mateData[k] = v
 	}
 	return mateData
 }
 
-// WithMeta 将meta数据设置在ctx中
+// WithMeta 将调用下游时发送的meta数据设置在ctx中，保留键不会被发送
+//
+// Deprecated: 使用NewOutgoingContext或AppendToOutgoing
 func WithMeta(ctx context.Context, meta map[string]interface{}) context.Context {
 	return context.WithValue(ctx, protocol.MetaDataKey, meta)
 }
+
+// Int 读取整数类型的元数据，值的类型见ToInt
+func Int(meta map[string]interface{}, key string) (int64, bool) {
+	return ToInt(meta[key])
+}
+
+// ToInt 将元数据中的数字转换为int64，经过msgpack或者json编解码后数字的具体类型不固定，
+// 也可能是json.Number或者十进制字符串，浮点数会被截断
+func ToInt(v interface{}) (int64, bool) {
+	return convert.ToInt64(v)
+}
@@ -0,0 +1,82 @@
+package metadata
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/lincx-911/lincxrpc/protocol"
+)
+
+func TestIncomingIsNotForwarded(t *testing.T) {
+	raw := map[string]interface{}{
+		"tenant":                   "a",
+		"trace-bin":                []byte{0xff, 0x00},
+		"retry":                    int64(2),
+		protocol.RequestTimeoutKey: int64(1000),
+	}
+	ctx := NewIncomingContext(context.Background(), raw)
+
+	want := MD{"tenant": "a", "trace-bin": "\xff\x00", "retry": "2"}
+	if got := FromIncoming(ctx); !reflect.DeepEqual(got, want) {
+		t.Fatalf("FromIncoming() = %v, want %v", got, want)
+	}
+	// 收到的元数据不会自动发送给下游
+	if wire := ToWire(ctx); len(wire) != 0 {
+		t.Fatalf("ToWire() = %v, want empty", wire)
+	}
+	if md := FromOutgoing(ctx); len(md) != 0 {
+		t.Fatalf("FromOutgoing() = %v, want empty", md)
+	}
+	// 修改返回的副本不影响收到的元数据
+	FromIncoming(ctx).Set("tenant", "b")
+	if raw["tenant"] != "a" {
+		t.Fatal("FromIncoming returned the raw metadata")
+	}
+}
+
+func TestOutgoing(t *testing.T) {
+	base := NewOutgoingContext(context.Background(), MD{"tenant": "a", protocol.AuthKey: "token"})
+	ctx := AppendToOutgoing(base, "tenant", "b", "image-bin", "\x01\x02")
+
+	if got, want := FromOutgoing(base), (MD{"tenant": "a"}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("AppendToOutgoing modified the parent: %v", got)
+	}
+	if md := FromIncoming(ctx); len(md) != 0 {
+		t.Fatalf("outgoing metadata visible as incoming: %v", md)
+	}
+	want := map[string]interface{}{"tenant": "b", "image-bin": []byte{0x01, 0x02}}
+	if got := ToWire(ctx); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ToWire() = %v, want %v", got, want)
+	}
+}
+
+func TestReservedKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		md   MD
+	}{
+		{"New", New(map[string]string{protocol.AuthKey: "x", "k": "v"})},
+		{"Pairs", Pairs(protocol.RequestTimeoutKey, "1", "k", "v")},
+		{"Join", Join(MD{"k": "v"}, Pairs(protocol.AuthKey, "x"))},
+	}
+	for _, tt := range tests {
+		if !reflect.DeepEqual(tt.md, MD{"k": "v"}) {
+			t.Errorf("%s: md = %v, want reserved keys dropped", tt.name, tt.md)
+		}
+	}
+
+	legacy := WithMeta(context.Background(), map[string]interface{}{protocol.AuthKey: "x", "k": 1})
+	if got, want := ToWire(legacy), (map[string]interface{}{"k": 1}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("ToWire() = %v, want %v", got, want)
+	}
+}
+
+func TestPairsOddArguments(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("Pairs did not panic")
+		}
+	}()
+	Pairs("k")
+}
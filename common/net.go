@@ -2,14 +2,19 @@ package common
 
 import (
 	"errors"
-	"log"
 	"math"
 	"net"
 	"net/http"
 	"strings"
+	"sync"
+
+	"github.com/lincx-911/lincxrpc/logger"
 )
 
-var localIPV4 string
+var (
+	localIPV4     string
+	localIPV4Once sync.Once
+)
 
 type IpType byte
 const(
@@ -17,13 +22,6 @@ const(
 	IPV6
 )
 
-func init() {
-	addr,err:=ExternalIPV4()
-	if err!=nil{
-		log.Fatalf("check net interface error:%v\n", err.Error())
-	}
-	localIPV4 = addr
-}
 
 // ExternalIPV4 获取本机的ipv4地址
 func ExternalIPV4()(string,error){
@@ -75,8 +73,16 @@ func getExternalIp(t IpType)(string,error){
 	return "",errors.New("not connect to the network")
 }
 
-// LocalIPV4 获取主机ipv4地址
+// LocalIPV4 获取主机ipv4地址，第一次调用时检查网卡，找不到可用的地址时使用127.0.0.1
 func LocalIPV4() string {
+	localIPV4Once.Do(func() {
+		addr, err := ExternalIPV4()
+		if err != nil {
+			logger.Warn("check net interface error, using 127.0.0.1", logger.Err(err))
+			addr = "127.0.0.1"
+		}
+		localIPV4 = addr
+	})
 	return localIPV4
 }
 
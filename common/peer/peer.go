@@ -0,0 +1,36 @@
+// Package peer 请求对端的信息，服务端为每个连接在ctx中保存对端信息
+package peer
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/lincx-911/lincxrpc/protocol"
+)
+
+// Peer 对端信息
+type Peer struct {
+	Addr      net.Addr             // 对端地址
+	LocalAddr net.Addr             // 本端地址
+	TLSState  *tls.ConnectionState // TLS连接状态，非TLS连接为nil
+}
+
+// Identity TLS客户端证书的CommonName，没有证书时返回空字符串
+func (p *Peer) Identity() string {
+	if p.TLSState == nil || len(p.TLSState.PeerCertificates) == 0 {
+		return ""
+	}
+	return p.TLSState.PeerCertificates[0].Subject.CommonName
+}
+
+// NewContext 将对端信息设置在ctx中
+func NewContext(ctx context.Context, p *Peer) context.Context {
+	return context.WithValue(ctx, protocol.PeerKey, p)
+}
+
+// FromContext 从ctx中读取对端信息
+func FromContext(ctx context.Context) (*Peer, bool) {
+	p, ok := ctx.Value(protocol.PeerKey).(*Peer)
+	return p, ok && p != nil
+}
@@ -0,0 +1,179 @@
+// Package stats 记录一次rpc调用中各个阶段的时间点和大小，由拦截器放入ctx，客户端和服务端在处理过程中填写
+package stats
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/protocol"
+)
+
+// Mark 调用中的时间点
+type Mark int
+
+const (
+	RequestReceived  Mark = iota // 收到请求，服务端
+	EncodeStart                  // 开始序列化
+	EncodeEnd                    // 序列化完成
+	RequestSent                  // 请求已经发送，客户端
+	ResponseReceived             // 收到响应，客户端
+	DecodeStart                  // 开始反序列化
+	DecodeEnd                    // 反序列化完成
+	numMarks
+)
+
+// RPCStats 一次调用的统计和记录，字段都通过原子操作读写，方法对nil安全
+// 服务端和客户端使用不同的key，服务方法中发起的调用不会修改服务端的记录
+type RPCStats struct {
+	marks         [numMarks]int64
+	requestBytes  int64
+	responseBytes int64
+	serverTime    int64        // 客户端：服务端返回的处理时间
+	cacheTTL      int64        // 响应可以缓存的时间，服务端由CacheWrapper设置，客户端为服务端返回的值
+	principal     atomic.Value // 服务端：鉴权通过的调用方
+	peer          atomic.Value // 客户端：本次调用的提供者地址
+}
+
+// NewServerContext 将服务端的统计放入ctx
+func NewServerContext(ctx context.Context, s *RPCStats) context.Context {
+	return context.WithValue(ctx, protocol.ServerStatsKey, s)
+}
+
+// ServerFromContext 从ctx中获取服务端的统计，没有时返回nil
+func ServerFromContext(ctx context.Context) *RPCStats {
+	s, _ := ctx.Value(protocol.ServerStatsKey).(*RPCStats)
+	return s
+}
+
+// NewClientContext 将客户端的统计放入ctx
+func NewClientContext(ctx context.Context, s *RPCStats) context.Context {
+	return context.WithValue(ctx, protocol.ClientStatsKey, s)
+}
+
+// ClientFromContext 从ctx中获取客户端的统计，没有时返回nil
+func ClientFromContext(ctx context.Context) *RPCStats {
+	s, _ := ctx.Value(protocol.ClientStatsKey).(*RPCStats)
+	return s
+}
+
+// EnsureClient 获取ctx中客户端的统计，没有时创建，多个拦截器共享同一次调用的统计
+func EnsureClient(ctx context.Context) (context.Context, *RPCStats) {
+	if s := ClientFromContext(ctx); s != nil {
+		return ctx, s
+	}
+	s := new(RPCStats)
+	return NewClientContext(ctx, s), s
+}
+
+// Mark 记录时间点
+func (s *RPCStats) Mark(m Mark) {
+	if s == nil {
+		return
+	}
+	atomic.StoreInt64(&s.marks[m], time.Now().UnixNano())
+}
+
+// Time 获取时间点，没有记录时返回false
+func (s *RPCStats) Time(m Mark) (time.Time, bool) {
+	if s == nil {
+		return time.Time{}, false
+	}
+	n := atomic.LoadInt64(&s.marks[m])
+	if n == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(0, n), true
+}
+
+// SetRequestBytes 记录请求体大小
+func (s *RPCStats) SetRequestBytes(n int) {
+	if s != nil {
+		atomic.StoreInt64(&s.requestBytes, int64(n))
+	}
+}
+
+// SetResponseBytes 记录响应体大小
+func (s *RPCStats) SetResponseBytes(n int) {
+	if s != nil {
+		atomic.StoreInt64(&s.responseBytes, int64(n))
+	}
+}
+
+// SetServerTime 记录服务端返回的处理时间
+func (s *RPCStats) SetServerTime(d time.Duration) {
+	if s != nil {
+		atomic.StoreInt64(&s.serverTime, int64(d))
+	}
+}
+
+// SetCacheTTL 记录响应可以缓存的时间
+func (s *RPCStats) SetCacheTTL(d time.Duration) {
+	if s != nil {
+		atomic.StoreInt64(&s.cacheTTL, int64(d))
+	}
+}
+
+// RequestBytes 请求体大小
+func (s *RPCStats) RequestBytes() int {
+	if s == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&s.requestBytes))
+}
+
+// ResponseBytes 响应体大小
+func (s *RPCStats) ResponseBytes() int {
+	if s == nil {
+		return 0
+	}
+	return int(atomic.LoadInt64(&s.responseBytes))
+}
+
+// ServerTime 服务端返回的处理时间，没有时为0
+func (s *RPCStats) ServerTime() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&s.serverTime))
+}
+
+// CacheTTL 响应可以缓存的时间，不能缓存时为0
+func (s *RPCStats) CacheTTL() time.Duration {
+	if s == nil {
+		return 0
+	}
+	return time.Duration(atomic.LoadInt64(&s.cacheTTL))
+}
+
+// SetPrincipal 记录鉴权通过的调用方
+func (s *RPCStats) SetPrincipal(principal string) {
+	if s != nil {
+		s.principal.Store(principal)
+	}
+}
+
+// Principal 鉴权通过的调用方，没有时为空
+func (s *RPCStats) Principal() string {
+	if s == nil {
+		return ""
+	}
+	p, _ := s.principal.Load().(string)
+	return p
+}
+
+// SetPeer 记录本次调用的提供者地址
+func (s *RPCStats) SetPeer(addr string) {
+	if s != nil {
+		s.peer.Store(addr)
+	}
+}
+
+// Peer 本次调用的提供者地址，没有时为空
+func (s *RPCStats) Peer() string {
+	if s == nil {
+		return ""
+	}
+	p, _ := s.peer.Load().(string)
+	return p
+}
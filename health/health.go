@@ -0,0 +1,68 @@
+package health
+
+import "fmt"
+
+// 标准健康检查服务的服务名和方法名
+const (
+	ServiceName = "Health"
+	CheckMethod = "Check"
+	ListMethod  = "List"
+)
+
+// ServingStatus 服务状态
+type ServingStatus byte
+
+const (
+	StatusUnknown        ServingStatus = iota //未知
+	StatusServing                             //正常提供服务
+	StatusNotServing                          //暂停服务，比如正在预热或者正在关闭
+	StatusServiceUnknown                      //没有该服务
+)
+
+func (status ServingStatus) String() string {
+	switch status {
+	case StatusServing:
+		return "SERVING"
+	case StatusNotServing:
+		return "NOT_SERVING"
+	case StatusServiceUnknown:
+		return "SERVICE_UNKNOWN"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// ParseServingStatus string转status
+func ParseServingStatus(name string) (ServingStatus, error) {
+	switch name {
+	case "SERVING":
+		return StatusServing, nil
+	case "NOT_SERVING":
+		return StatusNotServing, nil
+	case "SERVICE_UNKNOWN":
+		return StatusServiceUnknown, nil
+	case "UNKNOWN":
+		return StatusUnknown, nil
+	default:
+		return StatusUnknown, fmt.Errorf("status %s not found", name)
+	}
+}
+
+// CheckRequest 健康检查请求，Service为空时检查整个服务端
+type CheckRequest struct {
+	Service string
+}
+
+// CheckResponse 健康检查响应
+type CheckResponse struct {
+	Status ServingStatus
+}
+
+// ListRequest 查询所有服务状态的请求
+type ListRequest struct{}
+
+// ListResponse 所有服务的状态
+type ListResponse struct {
+	Status   ServingStatus            //整个服务端的状态
+	Services map[string]ServingStatus //各个服务的状态
+}
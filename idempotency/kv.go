@@ -0,0 +1,234 @@
+package idempotency
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/libkv/store"
+)
+
+// KVOption kv存储的配置
+type KVOption struct {
+	Prefix       string        // 键的前缀
+	TTL          time.Duration // 结果的保留时间
+	LockTTL      time.Duration // 处理中的占用的有效期，处理期间会自动续期，处理方退出后超过该时间其它请求可以接管
+	PollInterval time.Duration // 等待其它实例处理时查询结果的间隔
+}
+
+// DefaultKVOption 默认配置
+var DefaultKVOption = KVOption{
+	Prefix:       "lincxrpc/idempotency",
+	TTL:          DefaultTTL,
+	LockTTL:      time.Minute,
+	PollInterval: 50 * time.Millisecond,
+}
+
+// ErrLeaseLost 处理期间占用被其它实例接管，结果不会被保存
+var ErrLeaseLost = errors.New("idempotency lease was lost")
+
+// KVStore 基于kv存储的Store，多个服务端实例共享结果，kv客户端可以由kvregistry.NewStore创建
+// 处理期间每隔LockTTL/3续期占用，保存结果时确认占用没有被其它实例接管
+type KVStore struct {
+	kv     store.Store
+	option KVOption
+
+	mu     sync.Mutex
+	leases map[string]*lease //path -> 当前实例持有的占用
+}
+
+// lease 当前实例持有的占用
+type lease struct {
+	mu   sync.Mutex
+	pair *store.KVPair // 最近一次写入的值，用于比较并交换
+	lost bool          // 续期时发现已经被接管
+	stop chan struct{}
+}
+
+// kvEntry kv中保存的值
+type kvEntry struct {
+	Expire int64   `json:"expire"` // unix纳秒，处理中时为占用的过期时间
+	Result *Result `json:"result,omitempty"`
+}
+
+// NewKVStore 创建kv存储的Store，option中没有设置的字段使用DefaultKVOption
+func NewKVStore(kv store.Store, option KVOption) *KVStore {
+	if option.Prefix == "" {
+		option.Prefix = DefaultKVOption.Prefix
+	}
+	option.Prefix = strings.Trim(option.Prefix, "/")
+	if option.TTL <= 0 {
+		option.TTL = DefaultKVOption.TTL
+	}
+	if option.LockTTL <= 0 {
+		option.LockTTL = DefaultKVOption.LockTTL
+	}
+	if option.PollInterval <= 0 {
+		option.PollInterval = DefaultKVOption.PollInterval
+	}
+	return &KVStore{kv: kv, option: option, leases: make(map[string]*lease)}
+}
+
+// path key可能包含kv后端不支持的字符，使用摘要作为路径
+func (s *KVStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return s.option.Prefix + "/" + hex.EncodeToString(sum[:])
+}
+
+func (s *KVStore) Acquire(ctx context.Context, key string) (*Result, bool, error) {
+	path := s.path(key)
+	for {
+		pending, err := s.pending()
+		if err != nil {
+			return nil, false, err
+		}
+		opts := &store.WriteOptions{TTL: s.option.LockTTL}
+		pair, err := s.kv.Get(path)
+		if err == store.ErrKeyNotFound {
+			ok, acquired, err := s.kv.AtomicPut(path, pending, nil, opts)
+			if ok {
+				s.hold(path, acquired)
+				return nil, true, nil
+			}
+			if err != store.ErrKeyExists && err != store.ErrKeyModified {
+				return nil, false, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		var e kvEntry
+		if err := json.Unmarshal(pair.Value, &e); err != nil {
+			return nil, false, err
+		}
+		if time.Now().UnixNano() > e.Expire {
+			// 结果已经过期或者处理方已经退出，接管这个key
+			ok, acquired, err := s.kv.AtomicPut(path, pending, pair, opts)
+			if ok {
+				s.hold(path, acquired)
+				return nil, true, nil
+			}
+			if err != store.ErrKeyExists && err != store.ErrKeyModified {
+				return nil, false, err
+			}
+			continue
+		}
+		if e.Result != nil {
+			return e.Result, false, nil
+		}
+
+		timer := time.NewTimer(s.option.PollInterval)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+// pending 处理中的占用，过期时间为LockTTL之后
+func (s *KVStore) pending() ([]byte, error) {
+	return json.Marshal(kvEntry{Expire: time.Now().Add(s.option.LockTTL).UnixNano()})
+}
+
+// hold 记录占用并开始续期
+func (s *KVStore) hold(path string, pair *store.KVPair) {
+	l := &lease{pair: pair, stop: make(chan struct{})}
+	s.mu.Lock()
+	s.leases[path] = l
+	s.mu.Unlock()
+	go s.renew(path, l)
+}
+
+// release 停止续期并返回占用，没有持有时返回nil
+func (s *KVStore) release(path string) *lease {
+	s.mu.Lock()
+	l, ok := s.leases[path]
+	delete(s.leases, path)
+	s.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	close(l.stop)
+	return l
+}
+
+// renew 处理期间续期占用，避免耗时超过LockTTL的请求被其它实例接管并重复执行
+func (s *KVStore) renew(path string, l *lease) {
+	ticker := time.NewTicker(s.option.LockTTL / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.stop:
+			return
+		case <-ticker.C:
+		}
+		value, err := s.pending()
+		if err != nil {
+			continue
+		}
+		l.mu.Lock()
+		ok, pair, err := s.kv.AtomicPut(path, value, l.pair, &store.WriteOptions{TTL: s.option.LockTTL})
+		if ok {
+			l.pair = pair
+		} else if err == store.ErrKeyModified || err == store.ErrKeyNotFound {
+			l.lost = true
+		}
+		l.mu.Unlock()
+		if l.lost {
+			return
+		}
+	}
+}
+
+func (s *KVStore) Complete(key string, result *Result) error {
+	path := s.path(key)
+	l := s.release(path)
+	if l == nil {
+		return ErrLeaseLost
+	}
+	value, err := json.Marshal(kvEntry{Expire: time.Now().Add(s.option.TTL).UnixNano(), Result: result})
+	if err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lost {
+		return ErrLeaseLost
+	}
+	// 只有占用没有被接管时才保存结果
+	ok, _, err := s.kv.AtomicPut(path, value, l.pair, &store.WriteOptions{TTL: s.option.TTL})
+	if ok {
+		return nil
+	}
+	if err == store.ErrKeyModified || err == store.ErrKeyNotFound {
+		return ErrLeaseLost
+	}
+	return err
+}
+
+func (s *KVStore) Release(key string) error {
+	path := s.path(key)
+	l := s.release(path)
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lost {
+		return nil
+	}
+	// 已经被接管的占用不删除
+	_, err := s.kv.AtomicDelete(path, l.pair)
+	if err == store.ErrKeyNotFound || err == store.ErrKeyModified {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,100 @@
+package idempotency
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/docker/libkv/store"
+	"github.com/docker/libkv/store/boltdb"
+)
+
+func newBoltStore(t *testing.T) store.Store {
+	dir, err := ioutil.TempDir("", "idempotency")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kv, err := boltdb.New([]string{filepath.Join(dir, "idempotency.db")}, &store.Config{Bucket: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		kv.Close()
+		os.RemoveAll(dir)
+	})
+	return kv
+}
+
+func TestKVStoreRenewsLease(t *testing.T) {
+	kv := newBoltStore(t)
+	option := KVOption{LockTTL: 60 * time.Millisecond, PollInterval: 5 * time.Millisecond}
+	a, b := NewKVStore(kv, option), NewKVStore(kv, option)
+
+	if _, acquired, err := a.Acquire(context.Background(), "key"); err != nil || !acquired {
+		t.Fatalf("Acquire() = %v, %v", acquired, err)
+	}
+	// 处理时间超过LockTTL时占用被续期，其它实例不会接管
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, acquired, err := b.Acquire(ctx, "key"); acquired || err != context.DeadlineExceeded {
+		t.Fatalf("Acquire() on another instance = %v, %v, want to wait", acquired, err)
+	}
+	if err := a.Complete("key", &Result{Data: []byte("done")}); err != nil {
+		t.Fatal(err)
+	}
+	r, acquired, err := b.Acquire(context.Background(), "key")
+	if err != nil || acquired || string(r.Data) != "done" {
+		t.Fatalf("Acquire() = %v, %v, %v, want the saved result", r, acquired, err)
+	}
+}
+
+func TestKVStoreCompleteAfterTakeover(t *testing.T) {
+	kv := newBoltStore(t)
+	option := KVOption{LockTTL: time.Minute, PollInterval: 5 * time.Millisecond}
+	a, b := NewKVStore(kv, option), NewKVStore(kv, option)
+
+	if _, acquired, _ := a.Acquire(context.Background(), "key"); !acquired {
+		t.Fatal("first Acquire did not acquire")
+	}
+	// 模拟占用过期后被另一个实例接管
+	pair, err := kv.Get(a.path("key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expired, _ := json.Marshal(kvEntry{Expire: time.Now().Add(-time.Second).UnixNano()})
+	if _, _, err := kv.AtomicPut(a.path("key"), expired, pair, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, acquired, _ := b.Acquire(context.Background(), "key"); !acquired {
+		t.Fatal("expired lease was not taken over")
+	}
+	if err := a.Complete("key", &Result{Data: []byte("stale")}); err != ErrLeaseLost {
+		t.Fatalf("Complete() after takeover = %v, want ErrLeaseLost", err)
+	}
+	if err := b.Complete("key", &Result{Data: []byte("done")}); err != nil {
+		t.Fatal(err)
+	}
+	r, _, err := a.Acquire(context.Background(), "key")
+	if err != nil || string(r.Data) != "done" {
+		t.Fatalf("Acquire() = %v, %v, want the result of the new owner", r, err)
+	}
+}
+
+func TestKVStoreRelease(t *testing.T) {
+	kv := newBoltStore(t)
+	s := NewKVStore(kv, KVOption{PollInterval: 5 * time.Millisecond})
+	s.Acquire(context.Background(), "key")
+	if err := s.Release("key"); err != nil {
+		t.Fatal(err)
+	}
+	if _, acquired, _ := s.Acquire(context.Background(), "key"); !acquired {
+		t.Fatal("released key was not acquired again")
+	}
+	if err := s.Release("missing"); err != nil {
+		t.Fatalf("Release() of a key that is not held = %v", err)
+	}
+}
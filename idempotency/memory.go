@@ -0,0 +1,101 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MemoryStore 进程内的Store，只能对同一个服务端实例上的重复请求去重
+type MemoryStore struct {
+	ttl time.Duration
+
+	mu        sync.Mutex
+	entries   map[string]*memoryEntry
+	lastSweep time.Time
+}
+
+type memoryEntry struct {
+	done   chan struct{} // 处理完成或者放弃时关闭
+	result *Result       // 处理中时为空
+	expire time.Time
+}
+
+// NewMemoryStore 创建进程内的Store，结果保留ttl，ttl不大于0时使用DefaultTTL
+func NewMemoryStore(ttl time.Duration) *MemoryStore {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &MemoryStore{ttl: ttl, entries: make(map[string]*memoryEntry), lastSweep: time.Now()}
+}
+
+func (m *MemoryStore) Acquire(ctx context.Context, key string) (*Result, bool, error) {
+	for {
+		m.mu.Lock()
+		now := time.Now()
+		m.sweep(now)
+		e, ok := m.entries[key]
+		if !ok || (e.result != nil && now.After(e.expire)) {
+			m.entries[key] = &memoryEntry{done: make(chan struct{})}
+			m.mu.Unlock()
+			return nil, true, nil
+		}
+		if e.result != nil {
+			m.mu.Unlock()
+			return e.result, false, nil
+		}
+		done := e.done
+		m.mu.Unlock()
+
+		select {
+		case <-done:
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+}
+
+func (m *MemoryStore) Complete(key string, result *Result) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok || e.result != nil {
+		return nil
+	}
+	e.result = result
+	e.expire = time.Now().Add(m.ttl)
+	close(e.done)
+	return nil
+}
+
+func (m *MemoryStore) Release(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[key]
+	if !ok || e.result != nil {
+		return nil
+	}
+	delete(m.entries, key)
+	close(e.done)
+	return nil
+}
+
+// Len 保存的key数量，包括处理中的
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.entries)
+}
+
+// sweep 每隔ttl清理一次过期的结果，调用方持有锁
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < m.ttl {
+		return
+	}
+	m.lastSweep = now
+	for k, e := range m.entries {
+		if e.result != nil && now.After(e.expire) {
+			delete(m.entries, k)
+		}
+	}
+}
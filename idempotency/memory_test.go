@@ -0,0 +1,94 @@
+package idempotency
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreConcurrentDuplicates(t *testing.T) {
+	m := NewMemoryStore(time.Minute)
+	var executed int32
+	var wg sync.WaitGroup
+	results := make([]*Result, 10)
+	for i := range results {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			result, acquired, err := m.Acquire(context.Background(), "key")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			if acquired {
+				atomic.AddInt32(&executed, 1)
+				// 其它请求在处理期间等待
+				time.Sleep(50 * time.Millisecond)
+				result = &Result{Data: []byte("done")}
+				if err := m.Complete("key", result); err != nil {
+					t.Error(err)
+				}
+			}
+			results[i] = result
+		}(i)
+	}
+	wg.Wait()
+	if executed != 1 {
+		t.Fatalf("executed %d times, want 1", executed)
+	}
+	for i, r := range results {
+		if r == nil || string(r.Data) != "done" {
+			t.Fatalf("result %d = %v, want the saved result", i, r)
+		}
+	}
+}
+
+func TestMemoryStoreRelease(t *testing.T) {
+	m := NewMemoryStore(time.Minute)
+	if _, acquired, _ := m.Acquire(context.Background(), "key"); !acquired {
+		t.Fatal("first Acquire did not acquire")
+	}
+	acquiredCh := make(chan bool, 1)
+	go func() {
+		_, acquired, _ := m.Acquire(context.Background(), "key")
+		acquiredCh <- acquired
+	}()
+	time.Sleep(20 * time.Millisecond)
+	// 放弃占用后等待中的请求接管并重新执行
+	if err := m.Release("key"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case acquired := <-acquiredCh:
+		if !acquired {
+			t.Fatal("waiting request did not take over after Release")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("waiting request was not woken up")
+	}
+}
+
+func TestMemoryStoreWaitCanceled(t *testing.T) {
+	m := NewMemoryStore(time.Minute)
+	m.Acquire(context.Background(), "key")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, _, err := m.Acquire(ctx, "key"); err != context.DeadlineExceeded {
+		t.Fatalf("err = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestMemoryStoreExpire(t *testing.T) {
+	m := NewMemoryStore(10 * time.Millisecond)
+	m.Acquire(context.Background(), "key")
+	m.Complete("key", &Result{Data: []byte("old")})
+	if r, acquired, _ := m.Acquire(context.Background(), "key"); acquired || string(r.Data) != "old" {
+		t.Fatalf("Acquire() = %v, %v, want the saved result", r, acquired)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, acquired, _ := m.Acquire(context.Background(), "key"); !acquired {
+		t.Fatal("expired result was returned")
+	}
+}
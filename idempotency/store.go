@@ -0,0 +1,33 @@
+package idempotency
+
+import (
+	"context"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/codec"
+	"github.com/lincx-911/lincxrpc/protocol"
+)
+
+// DefaultTTL 默认的结果保留时间
+const DefaultTTL = 24 * time.Hour
+
+// Result 请求的处理结果，重复的请求直接返回它
+type Result struct {
+	StatusCode    protocol.StatusCode    `json:"status_code"`
+	Error         string                 `json:"error,omitempty"`
+	ErrorDetails  map[string]interface{} `json:"error_details,omitempty"`
+	SerializeType codec.SerializeType    `json:"serialize_type"`
+	Data          []byte                 `json:"data,omitempty"`
+	Fingerprint   string                 `json:"fingerprint,omitempty"` // 请求内容的摘要，同一个key被用于不同的请求时拒绝
+}
+
+// Store 保存幂等key对应的处理结果
+type Store interface {
+	// Acquire 占用key，返回acquired为true时调用方负责执行请求，之后必须调用Complete或者Release
+	// key已经有结果时返回结果；正在被其它请求处理时等待其完成，ctx结束时返回ctx.Err()
+	Acquire(ctx context.Context, key string) (result *Result, acquired bool, err error)
+	// Complete 保存结果并释放占用，等待中的请求会得到这个结果
+	Complete(key string, result *Result) error
+	// Release 放弃占用并且不保存结果，等待中的请求之一会重新执行
+	Release(key string) error
+}
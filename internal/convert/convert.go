@@ -0,0 +1,45 @@
+// Package convert 框架内部共用的类型转换，protocol不能依赖common/metadata，由这里提供同一份实现
+package convert
+
+import (
+	"encoding/json"
+	"strconv"
+)
+
+// ToInt64 将解码后的数字转换为int64，经过msgpack或者json编解码后数字的具体类型不固定，
+// 也可能是json.Number或者十进制字符串，浮点数会被截断
+func ToInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), true
+	case float32:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	case string:
+		i, err := strconv.ParseInt(v, 10, 64)
+		return i, err == nil
+	}
+	return 0, false
+}
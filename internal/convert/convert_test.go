@@ -0,0 +1,39 @@
+package convert
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestToInt64(t *testing.T) {
+	tests := []struct {
+		v    interface{}
+		want int64
+		ok   bool
+	}{
+		{int(1), 1, true},
+		{int8(-2), -2, true},
+		{int16(300), 300, true},
+		{int32(70000), 70000, true},
+		{int64(1) << 40, 1 << 40, true},
+		{uint(1), 1, true},
+		{uint8(200), 200, true},
+		{uint16(60000), 60000, true},
+		{uint32(1) << 31, 1 << 31, true},
+		{uint64(1) << 40, 1 << 40, true},
+		{float32(1.5), 1, true},
+		{float64(2.9), 2, true},
+		{json.Number("42"), 42, true},
+		{json.Number("4.2"), 0, false},
+		{"17", 17, true},
+		{"abc", 0, false},
+		{nil, 0, false},
+		{true, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := ToInt64(tt.v)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("ToInt64(%#v) = %d, %v, want %d, %v", tt.v, got, ok, tt.want, tt.ok)
+		}
+	}
+}
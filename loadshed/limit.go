@@ -0,0 +1,169 @@
+// Package loadshed 根据观察到的延迟自适应地调整并发上限，超过上限的请求直接拒绝，低优先级的请求先被拒绝
+package loadshed
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit 并发上限算法，每个请求结束时以它的耗时和当时的并发数更新
+type Limit interface {
+	Limit() int
+	// Update dropped表示请求超时或者被丢弃，是过载的信号
+	Update(rtt time.Duration, inFlight int, dropped bool)
+}
+
+// AIMDOption AIMD算法的配置项
+type AIMDOption struct {
+	Initial int           // 初始上限
+	Min     int           // 最小上限
+	Max     int           // 最大上限
+	Backoff float64       // 过载时上限乘以这个系数，(0,1)
+	Timeout time.Duration // 耗时超过它也视为过载，0时只看dropped
+}
+
+// DefaultAIMDOption 默认
+var DefaultAIMDOption = AIMDOption{
+	Initial: 20,
+	Min:     1,
+	Max:     1000,
+	Backoff: 0.9,
+	Timeout: 5 * time.Second,
+}
+
+// AIMDLimit 加性增乘性减：正常时上限加1，过载时乘以Backoff
+type AIMDLimit struct {
+	mu     sync.Mutex
+	option AIMDOption
+	limit  float64
+}
+
+// NewAIMDLimit 创建AIMD算法
+func NewAIMDLimit(option AIMDOption) *AIMDLimit {
+	option.Min, option.Max = normalizeBounds(option.Min, option.Max)
+	if option.Backoff <= 0 || option.Backoff >= 1 {
+		option.Backoff = DefaultAIMDOption.Backoff
+	}
+	return &AIMDLimit{option: option, limit: float64(clamp(option.Initial, option.Min, option.Max))}
+}
+
+func (l *AIMDLimit) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *AIMDLimit) Update(rtt time.Duration, inFlight int, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if dropped || (l.option.Timeout > 0 && rtt > l.option.Timeout) {
+		l.limit = math.Max(float64(l.option.Min), math.Floor(l.limit*l.option.Backoff))
+		return
+	}
+	// 并发数远低于上限时说明上限不是瓶颈，不再增加
+	if float64(inFlight)*2 >= l.limit {
+		l.limit = math.Min(float64(l.option.Max), l.limit+1)
+	}
+}
+
+// GradientOption 梯度算法的配置项
+type GradientOption struct {
+	Initial    int     // 初始上限
+	Min        int     // 最小上限
+	Max        int     // 最大上限
+	Smoothing  float64 // 新上限的权重，(0,1]
+	Tolerance  float64 // 短期延迟超过长期延迟的多少倍才开始降低上限，>=1
+	LongWindow int     // 长期延迟的平滑窗口，按请求数计算
+}
+
+// DefaultGradientOption 默认
+var DefaultGradientOption = GradientOption{
+	Initial:    20,
+	Min:        1,
+	Max:        1000,
+	Smoothing:  0.2,
+	Tolerance:  1.5,
+	LongWindow: 600,
+}
+
+// GradientLimit 比较短期和长期的平均延迟，延迟升高时按比例降低上限，否则以sqrt(limit)的余量增长
+type GradientLimit struct {
+	mu      sync.Mutex
+	option  GradientOption
+	limit   float64
+	longRTT float64
+	samples int
+}
+
+// NewGradientLimit 创建梯度算法
+func NewGradientLimit(option GradientOption) *GradientLimit {
+	option.Min, option.Max = normalizeBounds(option.Min, option.Max)
+	if option.Smoothing <= 0 || option.Smoothing > 1 {
+		option.Smoothing = DefaultGradientOption.Smoothing
+	}
+	if option.Tolerance < 1 {
+		option.Tolerance = DefaultGradientOption.Tolerance
+	}
+	if option.LongWindow <= 0 {
+		option.LongWindow = DefaultGradientOption.LongWindow
+	}
+	return &GradientLimit{option: option, limit: float64(clamp(option.Initial, option.Min, option.Max))}
+}
+
+func (l *GradientLimit) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+func (l *GradientLimit) Update(rtt time.Duration, inFlight int, dropped bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	short := float64(rtt)
+	if short <= 0 {
+		return
+	}
+	// 长期延迟使用指数平均，样本不足时使用简单平均
+	l.samples++
+	window := l.samples
+	if window > l.option.LongWindow {
+		window = l.option.LongWindow
+	}
+	l.longRTT += (short - l.longRTT) / float64(window)
+	if l.longRTT > short*2 {
+		// 延迟明显下降，让长期延迟更快地跟上
+		l.longRTT = short * 2
+	}
+	if !dropped && float64(inFlight)*2 < l.limit {
+		// 上限不是瓶颈
+		return
+	}
+	gradient := math.Max(0.5, math.Min(1, l.option.Tolerance*l.longRTT/short))
+	if dropped {
+		gradient = 0.5
+	}
+	target := l.limit*gradient + math.Sqrt(l.limit)
+	l.limit = l.limit*(1-l.option.Smoothing) + target*l.option.Smoothing
+	l.limit = math.Max(float64(l.option.Min), math.Min(float64(l.option.Max), l.limit))
+}
+
+func normalizeBounds(min, max int) (int, int) {
+	if min < 1 {
+		min = 1
+	}
+	if max < min {
+		max = min
+	}
+	return min, max
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
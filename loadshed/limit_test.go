@@ -0,0 +1,79 @@
+package loadshed
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAIMDLimit(t *testing.T) {
+	l := NewAIMDLimit(AIMDOption{Initial: 10, Min: 2, Max: 12, Backoff: 0.5, Timeout: time.Second})
+	tests := []struct {
+		name     string
+		rtt      time.Duration
+		inFlight int
+		dropped  bool
+		want     int
+	}{
+		{"increase", 10 * time.Millisecond, 5, false, 11},
+		{"limit not reached", 10 * time.Millisecond, 4, false, 11},
+		{"increase to max", 10 * time.Millisecond, 11, false, 12},
+		{"capped at max", 10 * time.Millisecond, 12, false, 12},
+		{"timeout", 2 * time.Second, 12, false, 6},
+		{"dropped", 10 * time.Millisecond, 6, true, 3},
+		{"floored at min", 10 * time.Millisecond, 3, true, 2},
+	}
+	for _, tt := range tests {
+		l.Update(tt.rtt, tt.inFlight, tt.dropped)
+		if got := l.Limit(); got != tt.want {
+			t.Fatalf("%s: limit = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGradientLimit(t *testing.T) {
+	l := NewGradientLimit(GradientOption{Initial: 100, Min: 10, Max: 200, Smoothing: 1, Tolerance: 1.5, LongWindow: 10})
+	tests := []struct {
+		name     string
+		rtt      time.Duration
+		inFlight int
+		dropped  bool
+		want     int
+	}{
+		// 延迟稳定时以sqrt(limit)的余量增长
+		{"steady", 10 * time.Millisecond, 60, false, 110},
+		{"limit not reached", 10 * time.Millisecond, 10, false, 110},
+		// 长期延迟为三次的平均40ms，gradient=1.5*40/100
+		{"latency rising", 100 * time.Millisecond, 60, false, 76},
+		{"dropped", 10 * time.Millisecond, 60, true, 46},
+		{"ignore zero rtt", 0, 60, true, 46},
+	}
+	for _, tt := range tests {
+		l.Update(tt.rtt, tt.inFlight, tt.dropped)
+		if got := l.Limit(); got != tt.want {
+			t.Fatalf("%s: limit = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+	for i := 0; i < 20; i++ {
+		l.Update(10*time.Millisecond, 1, true)
+	}
+	if got := l.Limit(); got != 10 {
+		t.Fatalf("limit = %d, want floored at 10", got)
+	}
+}
+
+func TestLimitBounds(t *testing.T) {
+	tests := []struct {
+		name string
+		l    Limit
+		want int
+	}{
+		{"aimd initial above max", NewAIMDLimit(AIMDOption{Initial: 50, Min: 1, Max: 20}), 20},
+		{"aimd max below min", NewAIMDLimit(AIMDOption{Initial: 1, Min: 5, Max: 2}), 5},
+		{"gradient zero min", NewGradientLimit(GradientOption{Initial: 0, Min: 0, Max: 10}), 1},
+	}
+	for _, tt := range tests {
+		if got := tt.l.Limit(); got != tt.want {
+			t.Errorf("%s: limit = %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package loadshed
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Priority 请求的优先级，越大越重要，过载时低优先级的请求先被拒绝
+type Priority int
+
+const (
+	PriorityLow      Priority = -1 // 可以随时丢弃的请求，比如批处理和预取
+	PriorityNormal   Priority = 0  // 没有指定优先级时
+	PriorityHigh     Priority = 1
+	PriorityCritical Priority = 2 // 只在达到上限时才拒绝
+)
+
+// PriorityOf 将请求中携带的优先级限制在PriorityLow和PriorityCritical之间
+func PriorityOf(v int64) Priority {
+	if v < int64(PriorityLow) {
+		return PriorityLow
+	}
+	if v > int64(PriorityCritical) {
+		return PriorityCritical
+	}
+	return Priority(v)
+}
+
+// share 每个优先级可以使用的并发上限的比例
+func (p Priority) share() float64 {
+	switch {
+	case p <= PriorityLow:
+		return 0.6
+	case p == PriorityNormal:
+		return 0.85
+	case p == PriorityHigh:
+		return 0.95
+	}
+	return 1
+}
+
+// Limiter 根据Limit算法计算的上限控制并发数
+type Limiter struct {
+	limit    Limit
+	inFlight int64
+	rejected uint64
+	latency  int64 // 请求耗时的指数移动平均，单位为纳秒
+}
+
+// NewLimiter 创建并发限制，limit为空时使用默认配置的梯度算法
+func NewLimiter(limit Limit) *Limiter {
+	if limit == nil {
+		limit = NewGradientLimit(DefaultGradientOption)
+	}
+	return &Limiter{limit: limit}
+}
+
+// Token 获取到的执行许可，请求结束时必须调用Release
+type Token struct {
+	l        *Limiter
+	start    time.Time
+	inFlight int
+}
+
+// Acquire 获取执行许可，当前并发数超过该优先级可以使用的上限时返回false
+func (l *Limiter) Acquire(priority Priority) (*Token, bool) {
+	n := atomic.AddInt64(&l.inFlight, 1)
+	allowed := int64(float64(l.limit.Limit()) * priority.share())
+	if allowed < 1 {
+		allowed = 1
+	}
+	if n > allowed {
+		atomic.AddInt64(&l.inFlight, -1)
+		atomic.AddUint64(&l.rejected, 1)
+		return nil, false
+	}
+	return &Token{l: l, start: time.Now(), inFlight: int(n)}, true
+}
+
+// Release 请求结束，dropped表示请求超时等过载的信号
+func (t *Token) Release(dropped bool) {
+	atomic.AddInt64(&t.l.inFlight, -1)
+	rtt := time.Since(t.start)
+	t.l.limit.Update(rtt, t.inFlight, dropped)
+	for {
+		old := atomic.LoadInt64(&t.l.latency)
+		latency := int64(rtt)
+		if old > 0 {
+			latency = old + (latency-old)/10
+		}
+		if atomic.CompareAndSwapInt64(&t.l.latency, old, latency) {
+			return
+		}
+	}
+}
+
+// Latency 请求耗时的移动平均，还没有完成的请求时为0
+func (l *Limiter) Latency() time.Duration {
+	return time.Duration(atomic.LoadInt64(&l.latency))
+}
+
+// Limit 当前的并发上限
+func (l *Limiter) Limit() int {
+	return l.limit.Limit()
+}
+
+// InFlight 当前的并发数
+func (l *Limiter) InFlight() int {
+	return int(atomic.LoadInt64(&l.inFlight))
+}
+
+// Rejected 累计拒绝的请求数
+func (l *Limiter) Rejected() uint64 {
+	return atomic.LoadUint64(&l.rejected)
+}
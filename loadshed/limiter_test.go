@@ -0,0 +1,84 @@
+package loadshed
+
+import (
+	"testing"
+	"time"
+)
+
+// fixedLimit 固定的并发上限
+type fixedLimit int
+
+func (l fixedLimit) Limit() int                      { return int(l) }
+func (l fixedLimit) Update(time.Duration, int, bool) {}
+
+func TestPriorityOf(t *testing.T) {
+	tests := []struct {
+		v    int64
+		want Priority
+	}{
+		{-100, PriorityLow},
+		{-1, PriorityLow},
+		{0, PriorityNormal},
+		{1, PriorityHigh},
+		{2, PriorityCritical},
+		{100, PriorityCritical},
+	}
+	for _, tt := range tests {
+		if got := PriorityOf(tt.v); got != tt.want {
+			t.Errorf("PriorityOf(%d) = %d, want %d", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterAcquire(t *testing.T) {
+	tests := []struct {
+		priority Priority
+		allowed  int
+	}{
+		{PriorityLow, 6},
+		{PriorityNormal, 8},
+		{PriorityHigh, 9},
+		{PriorityCritical, 10},
+	}
+	for _, tt := range tests {
+		l := NewLimiter(fixedLimit(10))
+		var tokens []*Token
+		for {
+			token, ok := l.Acquire(tt.priority)
+			if !ok {
+				break
+			}
+			tokens = append(tokens, token)
+		}
+		if len(tokens) != tt.allowed {
+			t.Errorf("priority %d: acquired %d, want %d", tt.priority, len(tokens), tt.allowed)
+		}
+		if l.InFlight() != tt.allowed || l.Rejected() != 1 {
+			t.Errorf("priority %d: in flight = %d, rejected = %d", tt.priority, l.InFlight(), l.Rejected())
+		}
+		// 低优先级的请求先被拒绝，高优先级的请求仍然可以执行
+		if tt.priority < PriorityCritical {
+			if _, ok := l.Acquire(PriorityCritical); !ok {
+				t.Errorf("priority %d: critical request rejected below the limit", tt.priority)
+			}
+		}
+		for _, token := range tokens {
+			token.Release(false)
+		}
+	}
+}
+
+func TestLimiterMinimumAllowed(t *testing.T) {
+	l := NewLimiter(fixedLimit(1))
+	token, ok := l.Acquire(PriorityLow)
+	if !ok {
+		t.Fatal("low priority request rejected while idle")
+	}
+	if _, ok := l.Acquire(PriorityCritical); ok {
+		t.Fatal("request accepted above the limit")
+	}
+	token.Release(false)
+	if l.InFlight() != 0 || l.Latency() <= 0 {
+		t.Fatalf("in flight = %d, latency = %v after release", l.InFlight(), l.Latency())
+	}
+}
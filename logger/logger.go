@@ -0,0 +1,137 @@
+// Package logger 分级的结构化日志，可以全局设置，也可以在server和client的Option中单独设置
+package logger
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/lincx-911/lincxrpc/protocol"
+)
+
+// Level 日志级别
+type Level int8
+
+const (
+	DebugLevel Level = iota - 1
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+)
+
+var levelNames = map[Level]string{
+	DebugLevel: "debug",
+	InfoLevel:  "info",
+	WarnLevel:  "warn",
+	ErrorLevel: "error",
+}
+
+func (l Level) String() string {
+	if name, ok := levelNames[l]; ok {
+		return name
+	}
+	return fmt.Sprintf("level(%d)", l)
+}
+
+// ParseLevel 解析日志级别，不区分大小写
+func ParseLevel(s string) (Level, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return l, nil
+		}
+	}
+	if strings.EqualFold(s, "warning") {
+		return WarnLevel, nil
+	}
+	return InfoLevel, fmt.Errorf("unknown log level %q", s)
+}
+
+// Field 结构化字段
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+// F 创建字段
+func F(key string, value interface{}) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Err 以error为key的错误字段
+func Err(err error) Field {
+	return Field{Key: "error", Value: err}
+}
+
+// Logger 日志接口，With返回附加了字段的新Logger
+type Logger interface {
+	Debug(msg string, fields ...Field)
+	Info(msg string, fields ...Field)
+	Warn(msg string, fields ...Field)
+	Error(msg string, fields ...Field)
+	With(fields ...Field) Logger
+	Enabled(level Level) bool
+}
+
+type holder struct {
+	Logger
+}
+
+var global atomic.Value
+
+func init() {
+	global.Store(holder{NewTextLogger(os.Stderr, InfoLevel)})
+}
+
+// SetLogger 设置全局日志，没有单独设置日志的server和client都使用它
+func SetLogger(l Logger) {
+	if l == nil {
+		l = Nop()
+	}
+	global.Store(holder{l})
+}
+
+// Default 全局日志
+func Default() Logger {
+	return global.Load().(holder).Logger
+}
+
+// NewContext 将日志放入ctx，通常已经附加了请求相关的字段
+func NewContext(ctx context.Context, l Logger) context.Context {
+	return context.WithValue(ctx, protocol.LoggerKey, l)
+}
+
+// FromContext 获取ctx中的日志，没有时返回全局日志
+func FromContext(ctx context.Context) Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(protocol.LoggerKey).(Logger); ok {
+			return l
+		}
+	}
+	return Default()
+}
+
+// Debug 使用全局日志输出
+func Debug(msg string, fields ...Field) { Default().Debug(msg, fields...) }
+
+// Info 使用全局日志输出
+func Info(msg string, fields ...Field) { Default().Info(msg, fields...) }
+
+// Warn 使用全局日志输出
+func Warn(msg string, fields ...Field) { Default().Warn(msg, fields...) }
+
+// Error 使用全局日志输出
+func Error(msg string, fields ...Field) { Default().Error(msg, fields...) }
+
+type nopLogger struct{}
+
+// Nop 丢弃所有日志
+func Nop() Logger { return nopLogger{} }
+
+func (nopLogger) Debug(string, ...Field)   {}
+func (nopLogger) Info(string, ...Field)    {}
+func (nopLogger) Warn(string, ...Field)    {}
+func (nopLogger) Error(string, ...Field)   {}
+func (n nopLogger) With(...Field) Logger   { return n }
+func (nopLogger) Enabled(level Level) bool { return false }
@@ -0,0 +1,110 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Level
+		ok   bool
+	}{
+		{"debug", DebugLevel, true},
+		{"INFO", InfoLevel, true},
+		{"Warn", WarnLevel, true},
+		{"warning", WarnLevel, true},
+		{"error", ErrorLevel, true},
+		{"trace", InfoLevel, false},
+		{"", InfoLevel, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseLevel(tt.s)
+		if got != tt.want || (err == nil) != tt.ok {
+			t.Errorf("ParseLevel(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	tests := []struct {
+		level Level
+		want  []string
+	}{
+		{DebugLevel, []string{"debug", "info", "warn", "error"}},
+		{InfoLevel, []string{"info", "warn", "error"}},
+		{WarnLevel, []string{"warn", "error"}},
+		{ErrorLevel, []string{"error"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.level.String(), func(t *testing.T) {
+			var buf bytes.Buffer
+			l := NewTextLogger(&buf, tt.level)
+			l.Debug("debug")
+			l.Info("info")
+			l.Warn("warn")
+			l.Error("error")
+			lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+			if len(lines) != len(tt.want) {
+				t.Fatalf("logged %d lines, want %d:\n%s", len(lines), len(tt.want), buf.String())
+			}
+			for i, msg := range tt.want {
+				if !strings.HasSuffix(lines[i], " "+msg) {
+					t.Fatalf("line %d = %q, want message %q", i, lines[i], msg)
+				}
+			}
+			for _, level := range []Level{DebugLevel, InfoLevel, WarnLevel, ErrorLevel} {
+				if l.Enabled(level) != (level >= tt.level) {
+					t.Fatalf("Enabled(%s) = %v", level, l.Enabled(level))
+				}
+			}
+		})
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewTextLogger(&buf, InfoLevel)
+	child := l.With(F("request", 1))
+	child.Debug("hidden")
+	if buf.Len() != 0 {
+		t.Fatalf("debug logged at info level: %s", buf.String())
+	}
+	// 修改级别对With产生的Logger同样生效
+	l.(LevelSetter).SetLevel(DebugLevel)
+	child.Debug("shown", F("user", "alice bob"))
+	if got := buf.String(); !strings.Contains(got, "DEBUG shown request=1 user=\"alice bob\"") {
+		t.Fatalf("output = %q", got)
+	}
+}
+
+func TestJSONLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewJSONLogger(&buf, InfoLevel)
+	l.Warn("failed", Err(errors.New("boom")), F("n", 1))
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("invalid json %q: %v", buf.String(), err)
+	}
+	if entry["level"] != "warn" || entry["msg"] != "failed" || entry["error"] != "boom" || entry["n"] != float64(1) {
+		t.Fatalf("entry = %v", entry)
+	}
+}
+
+func TestFromContext(t *testing.T) {
+	if FromContext(context.Background()) != Default() {
+		t.Fatal("FromContext without a logger should return the default logger")
+	}
+	l := Nop()
+	if FromContext(NewContext(context.Background(), l)) != l {
+		t.Fatal("FromContext did not return the logger in ctx")
+	}
+	if l.Enabled(ErrorLevel) {
+		t.Fatal("nop logger enabled")
+	}
+}
@@ -0,0 +1,170 @@
+package logger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// encoder 把一条日志编码到buf中
+type encoder func(buf *bytes.Buffer, t time.Time, level Level, msg string, fields []Field)
+
+type output struct {
+	mu  sync.Mutex
+	w   io.Writer
+	lvl int32
+}
+
+// writerLogger 文本和JSON日志的公共实现，With产生的Logger共享输出和级别
+type writerLogger struct {
+	out    *output
+	encode encoder
+	fields []Field
+}
+
+// LevelSetter 可以在运行时修改级别的Logger
+type LevelSetter interface {
+	SetLevel(level Level)
+}
+
+// NewTextLogger 输出 "2006/01/02 15:04:05.000000 INFO msg key=value" 格式的日志
+func NewTextLogger(w io.Writer, level Level) Logger {
+	return &writerLogger{out: &output{w: w, lvl: int32(level)}, encode: encodeText}
+}
+
+// NewJSONLogger 每条日志输出一行JSON，包含time、level、msg和所有字段
+func NewJSONLogger(w io.Writer, level Level) Logger {
+	return &writerLogger{out: &output{w: w, lvl: int32(level)}, encode: encodeJSON}
+}
+
+// SetLevel 修改级别，对With产生的Logger同样生效
+func (l *writerLogger) SetLevel(level Level) {
+	atomic.StoreInt32(&l.out.lvl, int32(level))
+}
+
+func (l *writerLogger) Enabled(level Level) bool {
+	return int32(level) >= atomic.LoadInt32(&l.out.lvl)
+}
+
+func (l *writerLogger) With(fields ...Field) Logger {
+	if len(fields) == 0 {
+		return l
+	}
+	all := make([]Field, 0, len(l.fields)+len(fields))
+	all = append(all, l.fields...)
+	all = append(all, fields...)
+	return &writerLogger{out: l.out, encode: l.encode, fields: all}
+}
+
+func (l *writerLogger) Debug(msg string, fields ...Field) { l.log(DebugLevel, msg, fields) }
+func (l *writerLogger) Info(msg string, fields ...Field)  { l.log(InfoLevel, msg, fields) }
+func (l *writerLogger) Warn(msg string, fields ...Field)  { l.log(WarnLevel, msg, fields) }
+func (l *writerLogger) Error(msg string, fields ...Field) { l.log(ErrorLevel, msg, fields) }
+
+var bufPool = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+
+func (l *writerLogger) log(level Level, msg string, fields []Field) {
+	if !l.Enabled(level) {
+		return
+	}
+	all := fields
+	if len(l.fields) > 0 {
+		all = make([]Field, 0, len(l.fields)+len(fields))
+		all = append(all, l.fields...)
+		all = append(all, fields...)
+	}
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	l.encode(buf, time.Now(), level, msg, all)
+	buf.WriteByte('\n')
+	l.out.mu.Lock()
+	l.out.w.Write(buf.Bytes())
+	l.out.mu.Unlock()
+	bufPool.Put(buf)
+}
+
+func encodeText(buf *bytes.Buffer, t time.Time, level Level, msg string, fields []Field) {
+	buf.WriteString(t.Format("2006/01/02 15:04:05.000000"))
+	buf.WriteByte(' ')
+	switch level {
+	case DebugLevel:
+		buf.WriteString("DEBUG")
+	case InfoLevel:
+		buf.WriteString("INFO ")
+	case WarnLevel:
+		buf.WriteString("WARN ")
+	case ErrorLevel:
+		buf.WriteString("ERROR")
+	default:
+		buf.WriteString(level.String())
+	}
+	buf.WriteByte(' ')
+	buf.WriteString(msg)
+	for _, f := range fields {
+		buf.WriteByte(' ')
+		buf.WriteString(f.Key)
+		buf.WriteByte('=')
+		s := fmt.Sprint(valueOf(f.Value))
+		if needsQuote(s) {
+			s = strconv.Quote(s)
+		}
+		buf.WriteString(s)
+	}
+}
+
+func needsQuote(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, r := range s {
+		if r <= ' ' || r == '=' || r == '"' || r > '~' {
+			return true
+		}
+	}
+	return false
+}
+
+func encodeJSON(buf *bytes.Buffer, t time.Time, level Level, msg string, fields []Field) {
+	buf.WriteString(`{"time":`)
+	writeJSON(buf, t.Format(time.RFC3339Nano))
+	buf.WriteString(`,"level":`)
+	writeJSON(buf, level.String())
+	buf.WriteString(`,"msg":`)
+	writeJSON(buf, msg)
+	for _, f := range fields {
+		buf.WriteByte(',')
+		writeJSON(buf, f.Key)
+		buf.WriteByte(':')
+		writeJSON(buf, valueOf(f.Value))
+	}
+	buf.WriteByte('}')
+}
+
+func writeJSON(buf *bytes.Buffer, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		// 无法编码的值使用字符串形式
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	buf.Write(b)
+}
+
+// valueOf error和Stringer以字符串输出
+func valueOf(v interface{}) interface{} {
+	switch x := v.(type) {
+	case nil:
+		return nil
+	case error:
+		return x.Error()
+	case time.Duration:
+		return x.String()
+	case fmt.Stringer:
+		return x.String()
+	}
+	return v
+}
@@ -0,0 +1,491 @@
+// Package metrics 简单的指标库，以Prometheus文本格式输出
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// 指标类型
+const (
+	TypeCounter   = "counter"
+	TypeGauge     = "gauge"
+	TypeHistogram = "histogram"
+)
+
+// DefBuckets 默认的耗时分桶，单位为秒
+var DefBuckets = []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// SizeBuckets 默认的大小分桶，单位为字节
+var SizeBuckets = ExponentialBuckets(64, 4, 8)
+
+// ExponentialBuckets 指数增长的分桶
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	buckets := make([]float64, count)
+	for i := range buckets {
+		buckets[i] = start
+		start *= factor
+	}
+	return buckets
+}
+
+// Desc 指标的描述
+type Desc struct {
+	Name   string
+	Help   string
+	Type   string
+	Labels []string
+}
+
+// Sample 一个采样值，Name为空时使用指标名
+type Sample struct {
+	Name        string
+	LabelValues []string
+	ExtraLabel  [2]string // 额外的标签，比如histogram的le
+	Value       float64
+}
+
+// Collector 指标收集器
+type Collector interface {
+	Describe() Desc
+	Collect(emit func(Sample))
+}
+
+// Registry 指标注册表
+type Registry struct {
+	mu         sync.RWMutex
+	collectors map[string]Collector
+}
+
+// DefaultRegistry 默认的注册表
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry 创建注册表
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// Register 注册收集器，同名的指标已经存在时返回错误
+func (r *Registry) Register(c Collector) error {
+	name := c.Describe().Name
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collectors[name]; ok {
+		return fmt.Errorf("metrics: duplicate metric %s", name)
+	}
+	r.collectors[name] = c
+	return nil
+}
+
+// MustRegister 注册收集器，出错时panic
+func (r *Registry) MustRegister(cs ...Collector) {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			panic(err)
+		}
+	}
+}
+
+// GetOrRegister 注册收集器，同名的指标已经存在时返回已经存在的收集器
+func (r *Registry) GetOrRegister(c Collector) Collector {
+	name := c.Describe().Name
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if existing, ok := r.collectors[name]; ok {
+		return existing
+	}
+	r.collectors[name] = c
+	return c
+}
+
+// Get 获取已经注册的收集器
+func (r *Registry) Get(name string) Collector {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.collectors[name]
+}
+
+// Unregister 移除收集器
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	delete(r.collectors, name)
+	r.mu.Unlock()
+}
+
+// WriteText 以Prometheus文本格式输出所有指标
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.RLock()
+	collectors := make([]Collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mu.RUnlock()
+	sort.Slice(collectors, func(i, j int) bool {
+		return collectors[i].Describe().Name < collectors[j].Describe().Name
+	})
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		desc := c.Describe()
+		fmt.Fprintf(bw, "# HELP %s %s\n", desc.Name, escapeHelp(desc.Help))
+		fmt.Fprintf(bw, "# TYPE %s %s\n", desc.Name, desc.Type)
+		var lines []string
+		c.Collect(func(s Sample) {
+			lines = append(lines, formatSample(desc, s))
+		})
+		// histogram的各个采样需要保持顺序，只按标签排序
+		sort.SliceStable(lines, func(i, j int) bool {
+			return labelPart(lines[i]) < labelPart(lines[j])
+		})
+		for _, line := range lines {
+			bw.WriteString(line)
+		}
+	}
+	return bw.Flush()
+}
+
+// Handler 输出指标的http handler
+func Handler(r *Registry) http.Handler {
+	if r == nil {
+		r = DefaultRegistry
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = r.WriteText(w)
+	})
+}
+
+func formatSample(desc Desc, s Sample) string {
+	var b strings.Builder
+	name := s.Name
+	if name == "" {
+		name = desc.Name
+	}
+	b.WriteString(name)
+	n := 0
+	writeLabel := func(k, v string) {
+		if n == 0 {
+			b.WriteByte('{')
+		} else {
+			b.WriteByte(',')
+		}
+		n++
+		b.WriteString(k)
+		b.WriteString(`="`)
+		b.WriteString(escapeLabel(v))
+		b.WriteByte('"')
+	}
+	for i, l := range desc.Labels {
+		if i < len(s.LabelValues) {
+			writeLabel(l, s.LabelValues[i])
+		}
+	}
+	if s.ExtraLabel[0] != "" {
+		writeLabel(s.ExtraLabel[0], s.ExtraLabel[1])
+	}
+	if n > 0 {
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatFloat(s.Value))
+	b.WriteByte('\n')
+	return b.String()
+}
+
+// labelPart 去掉histogram的后缀和le，用于排序
+func labelPart(line string) string {
+	i := strings.IndexAny(line, "{ ")
+	if i < 0 || line[i] != '{' {
+		return ""
+	}
+	j := strings.LastIndex(line, "}")
+	labels := line[i:j]
+	// le总是最后一个标签
+	if k := strings.LastIndex(labels, `le="`); k > 0 && (labels[k-1] == ',' || labels[k-1] == '{') {
+		labels = strings.TrimSuffix(labels[:k], ",")
+	}
+	return labels
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func escapeLabel(v string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(v)
+}
+
+func escapeHelp(v string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(v)
+}
+
+// atomicFloat 原子操作的float64
+type atomicFloat struct {
+	bits uint64
+}
+
+func (f *atomicFloat) Add(v float64) {
+	for {
+		old := atomic.LoadUint64(&f.bits)
+		if atomic.CompareAndSwapUint64(&f.bits, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) Set(v float64) {
+	atomic.StoreUint64(&f.bits, math.Float64bits(v))
+}
+
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&f.bits))
+}
+
+// vec 按标签值保存子指标
+type vec struct {
+	desc     Desc
+	mu       sync.RWMutex
+	children map[string]interface{}
+	values   map[string][]string
+	newChild func() interface{}
+}
+
+func newVec(desc Desc, newChild func() interface{}) *vec {
+	return &vec{desc: desc, children: make(map[string]interface{}), values: make(map[string][]string), newChild: newChild}
+}
+
+func (v *vec) Describe() Desc {
+	return v.desc
+}
+
+func (v *vec) with(labelValues []string) interface{} {
+	if len(labelValues) != len(v.desc.Labels) {
+		panic(fmt.Sprintf("metrics: %s expects %d label values, got %d", v.desc.Name, len(v.desc.Labels), len(labelValues)))
+	}
+	key := strings.Join(labelValues, "\xff")
+	v.mu.RLock()
+	child, ok := v.children[key]
+	v.mu.RUnlock()
+	if ok {
+		return child
+	}
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if child, ok = v.children[key]; ok {
+		return child
+	}
+	child = v.newChild()
+	v.children[key] = child
+	v.values[key] = append([]string(nil), labelValues...)
+	return child
+}
+
+func (v *vec) each(fn func(labelValues []string, child interface{})) {
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	for key, child := range v.children {
+		fn(v.values[key], child)
+	}
+}
+
+// Counter 只增不减的计数
+type Counter struct {
+	v atomicFloat
+}
+
+// Inc 加1
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add 增加，v不能为负数
+func (c *Counter) Add(v float64) {
+	if v < 0 {
+		return
+	}
+	c.v.Add(v)
+}
+
+// Value 当前值
+func (c *Counter) Value() float64 {
+	return c.v.Load()
+}
+
+// CounterVec 带标签的计数
+type CounterVec struct {
+	*vec
+}
+
+// NewCounterVec 创建计数
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(Desc{Name: name, Help: help, Type: TypeCounter, Labels: labels}, func() interface{} { return new(Counter) })}
+}
+
+// With 获取标签值对应的计数
+func (c *CounterVec) With(labelValues ...string) *Counter {
+	return c.with(labelValues).(*Counter)
+}
+
+func (c *CounterVec) Collect(emit func(Sample)) {
+	c.each(func(labelValues []string, child interface{}) {
+		emit(Sample{LabelValues: labelValues, Value: child.(*Counter).Value()})
+	})
+}
+
+// Gauge 可增可减的值
+type Gauge struct {
+	v atomicFloat
+}
+
+// Set 设置
+func (g *Gauge) Set(v float64) {
+	g.v.Set(v)
+}
+
+// Add 增加，v可以为负数
+func (g *Gauge) Add(v float64) {
+	g.v.Add(v)
+}
+
+// Inc 加1
+func (g *Gauge) Inc() {
+	g.v.Add(1)
+}
+
+// Dec 减1
+func (g *Gauge) Dec() {
+	g.v.Add(-1)
+}
+
+// Value 当前值
+func (g *Gauge) Value() float64 {
+	return g.v.Load()
+}
+
+// GaugeVec 带标签的Gauge
+type GaugeVec struct {
+	*vec
+}
+
+// NewGaugeVec 创建Gauge
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(Desc{Name: name, Help: help, Type: TypeGauge, Labels: labels}, func() interface{} { return new(Gauge) })}
+}
+
+// With 获取标签值对应的Gauge
+func (g *GaugeVec) With(labelValues ...string) *Gauge {
+	return g.with(labelValues).(*Gauge)
+}
+
+func (g *GaugeVec) Collect(emit func(Sample)) {
+	g.each(func(labelValues []string, child interface{}) {
+		emit(Sample{LabelValues: labelValues, Value: child.(*Gauge).Value()})
+	})
+}
+
+// GaugeFunc 在输出时才计算的Gauge，fn通过emit输出每组标签的值
+type GaugeFunc struct {
+	desc Desc
+	fn   func(emit func(value float64, labelValues ...string))
+}
+
+// NewGaugeFunc 创建GaugeFunc
+func NewGaugeFunc(name, help string, labels []string, fn func(emit func(value float64, labelValues ...string))) *GaugeFunc {
+	return &GaugeFunc{desc: Desc{Name: name, Help: help, Type: TypeGauge, Labels: labels}, fn: fn}
+}
+
+func (g *GaugeFunc) Describe() Desc {
+	return g.desc
+}
+
+func (g *GaugeFunc) Collect(emit func(Sample)) {
+	g.fn(func(value float64, labelValues ...string) {
+		emit(Sample{LabelValues: labelValues, Value: value})
+	})
+}
+
+// Histogram 分桶统计
+type Histogram struct {
+	buckets []float64
+	counts  []uint64
+	count   uint64
+	sum     atomicFloat
+}
+
+// Observe 记录一个值
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.counts) {
+		atomic.AddUint64(&h.counts[i], 1)
+	}
+	atomic.AddUint64(&h.count, 1)
+	h.sum.Add(v)
+}
+
+// Count 记录的次数
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+// Sum 记录的值的和
+func (h *Histogram) Sum() float64 {
+	return h.sum.Load()
+}
+
+// HistogramVec 带标签的分桶统计
+type HistogramVec struct {
+	*vec
+	buckets []float64
+}
+
+// NewHistogramVec 创建分桶统计，buckets为空时使用DefBuckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &HistogramVec{
+		vec: newVec(Desc{Name: name, Help: help, Type: TypeHistogram, Labels: labels}, func() interface{} {
+			return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+		}),
+		buckets: buckets,
+	}
+}
+
+// With 获取标签值对应的分桶统计
+func (h *HistogramVec) With(labelValues ...string) *Histogram {
+	return h.with(labelValues).(*Histogram)
+}
+
+func (h *HistogramVec) Collect(emit func(Sample)) {
+	name := h.desc.Name
+	h.each(func(labelValues []string, child interface{}) {
+		hist := child.(*Histogram)
+		var cumulative uint64
+		for i, upper := range hist.buckets {
+			cumulative += atomic.LoadUint64(&hist.counts[i])
+			emit(Sample{Name: name + "_bucket", LabelValues: labelValues, ExtraLabel: [2]string{"le", formatFloat(upper)}, Value: float64(cumulative)})
+		}
+		count := hist.Count()
+		emit(Sample{Name: name + "_bucket", LabelValues: labelValues, ExtraLabel: [2]string{"le", "+Inf"}, Value: float64(count)})
+		emit(Sample{Name: name + "_sum", LabelValues: labelValues, Value: hist.Sum()})
+		emit(Sample{Name: name + "_count", LabelValues: labelValues, Value: float64(count)})
+	})
+}
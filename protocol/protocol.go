@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/lincx-911/lincxrpc/codec"
+	"github.com/lincx-911/lincxrpc/internal/convert"
 )
 //消息协议定义
 //-------------------------------------------------------------------------------------------------
@@ -24,9 +25,10 @@ type MessageType byte
 
 // 消息类型
 const (
-	MessageTypeRequest MessageType = iota //请求
-	MessageTypeResponse // 响应
-	MessageTypeHeartbeat //心跳
+	MessageTypeRequest   MessageType = iota //请求
+	MessageTypeResponse                     // 响应
+	MessageTypeHeartbeat                    //心跳
+	MessageTypeGoAway                       //服务端即将关闭，客户端不要再发送新的请求
 )
 
 // ParseMessageType string转type
@@ -38,6 +40,8 @@ func ParseMessageType(name string) (MessageType, error) {
 		return MessageTypeResponse, nil
 	case "heartbeat":
 		return MessageTypeHeartbeat, nil
+	case "goaway":
+		return MessageTypeGoAway, nil
 	default:
 		return MessageTypeRequest, fmt.Errorf("type %s not found", name)
 	}
@@ -52,6 +56,8 @@ func (messageType MessageType) String() string {
 		return "response"
 	case MessageTypeHeartbeat:
 		return "heartbeat"
+	case MessageTypeGoAway:
+		return "goaway"
 	default:
 		return "unknown"
 	}
@@ -81,33 +87,63 @@ func (compressType CompressType) String() string {
 	}
 }
 
-// StatusCode 状态
+// StatusCode 状态码，StatusOK以外的都表示调用失败
 type StatusCode byte
+
 const (
-	StatusOK StatusCode = iota
-	StatusError
+	StatusOK                 StatusCode = iota // 成功
+	StatusError                                // 未分类的错误，兼容旧版本
+	StatusCanceled                             // 调用方取消了请求
+	StatusInvalidArgument                      // 参数不合法
+	StatusDeadlineExceeded                     // 超过截止时间
+	StatusNotFound                             // 请求的资源不存在
+	StatusAlreadyExists                        // 资源已经存在
+	StatusPermissionDenied                     // 没有权限
+	StatusResourceExhausted                    // 资源耗尽，比如被限流
+	StatusFailedPrecondition                   // 当前状态不满足执行条件
+	StatusAborted                              // 因为并发冲突等原因中止
+	StatusOutOfRange                           // 超出有效范围
+	StatusUnimplemented                        // 服务或方法没有实现
+	StatusInternal                             // 服务端内部错误
+	StatusUnavailable                          // 服务暂时不可用，可以重试
+	StatusDataLoss                             // 数据丢失或损坏
+	StatusUnauthenticated                      // 没有通过认证
 )
 
+var statusCodeNames = map[StatusCode]string{
+	StatusOK:                 "ok",
+	StatusError:              "error",
+	StatusCanceled:           "canceled",
+	StatusInvalidArgument:    "invalid_argument",
+	StatusDeadlineExceeded:   "deadline_exceeded",
+	StatusNotFound:           "not_found",
+	StatusAlreadyExists:      "already_exists",
+	StatusPermissionDenied:   "permission_denied",
+	StatusResourceExhausted:  "resource_exhausted",
+	StatusFailedPrecondition: "failed_precondition",
+	StatusAborted:            "aborted",
+	StatusOutOfRange:         "out_of_range",
+	StatusUnimplemented:      "unimplemented",
+	StatusInternal:           "internal",
+	StatusUnavailable:        "unavailable",
+	StatusDataLoss:           "data_loss",
+	StatusUnauthenticated:    "unauthenticated",
+}
+
 func (code StatusCode) String() string {
-	switch code {
-	case StatusOK:
-		return "ok"
-	case StatusError:
-		return "error"
-	default:
-		return "unknown"
+	if name, ok := statusCodeNames[code]; ok {
+		return name
 	}
+	return "unknown"
 }
 
 func ParseStatusCode(name string) (StatusCode, error) {
-	switch name {
-	case "ok":
-		return StatusOK, nil
-	case "error":
-		return StatusError, nil
-	default:
-		return StatusError, fmt.Errorf("type %s not found", name)
+	for code, n := range statusCodeNames {
+		if n == name {
+			return code, nil
+		}
 	}
+	return StatusError, fmt.Errorf("type %s not found", name)
 }
 
 type ProtocolType byte
@@ -128,14 +164,40 @@ var protocols = map[ProtocolType]Protocol{
 
 // 键
 const (
-	RequestSeqKey      string = "rpc_request_seq"
-	RequestTimeoutKey  string = "rpc_request_timeout"
-	MetaDataKey        string = "rpc_meta_data"
-	AuthKey            string = "rpc_auth"
-	RequestDeadlineKey string = "rpc_request_deadline"
-	ProviderDegradeKey string = "rpc_provider_degrade"
+	RequestSeqKey       string = "rpc_request_seq"
+	RequestTimeoutKey   string = "rpc_request_timeout"
+	MetaDataKey         string = "rpc_meta_data"
+	AuthKey             string = "rpc_auth"
+	RequestDeadlineKey  string = "rpc_request_deadline"
+	RemoteAppKey        string = "rpc_remote_appkey"
+	PeerKey             string = "rpc_peer"
+	ProviderDrainingKey string = "rpc_provider_draining"
+	ProviderWeightKey   string = "rpc_provider_weight"
+	ProviderWarmUpStart string = "rpc_provider_warmup_start"
+	ProviderWarmUpKey   string = "rpc_provider_warmup"
+	ProviderWarmUpAge   string = "rpc_provider_warmup_age"
+	ServerStatsKey      string = "rpc_server_stats"
+	ClientStatsKey      string = "rpc_client_stats"
+	TraceSpanKey        string = "rpc_trace_span"
+	TraceParentKey      string = "rpc_trace_parent"
+	ServerTimeKey       string = "rpc_server_time"
+	LoggerKey           string = "rpc_logger"
+	PrincipalKey        string = "rpc_principal"
+	CallerAppKey        string = "rpc_app_key"
+	PriorityKey         string = "rpc_priority"
+	IncomingMetaDataKey string = "rpc_incoming_meta_data"
+	OutgoingMetaDataKey string = "rpc_outgoing_meta_data"
+	WireMetaDataKey     string = "rpc_wire_meta_data"
+	IdempotencyKey      string = "rpc_idempotency_key"
+	IdempotentReplayKey string = "rpc_idempotent_replay"
+	CacheTTLKey         string = "rpc_cache_ttl"
 )
 
+// ProviderDegradeKey 注册中心元数据中的降级标记
+//
+// Deprecated: 框架不再写入，提供者的健康状态由客户端维护
+const ProviderDegradeKey string = "rpc_provider_degrade"
+
 // Header 消息头部
 type Header struct {
 	Seq           uint64                 // 序号，用于唯一标识请求或者响应
@@ -146,6 +208,7 @@ type Header struct {
 	ServiceName   string                 //服务名称
 	MethodName    string                 //方法名称
 	Error         string                 //方法调用异常
+	ErrorDetails  map[string]interface{} //异常的详细信息
 	MetaData      map[string]interface{} //其他元数据
 }
 
@@ -157,32 +220,35 @@ type Message struct {
 
 // Clone 克隆消息内容与头部
 func (m *Message) Clone() *Message {
-	header := m.Header
+	header := *m.Header
 	res := new(Message)
-	res.Header = header
+	res.Header = &header
 	res.Data = m.Data
 	return res
 }
 
-// Deadline 过期时间
+// Deadline 过期时间，元数据中为unix纳秒，兼容旧版本客户端直接放入的time.Time
 func (m *Message) Deadline() (time.Time, bool) {
-	if m.MetaData == nil {
-		return time.Now(), false
-	} else {
-		deadline, ok := m.MetaData[RequestDeadlineKey]
-		if ok {
-			switch deadline := deadline.(type) {
-			case time.Time:
-				return deadline, ok
-			case *time.Time:
-				return *deadline, ok
-			default:
-				return time.Now(), false
-			}
-		} else {
-			return time.Now(), false
+	if deadline, ok := convert.ToInt64(m.MetaData[RequestDeadlineKey]); ok {
+		return time.Unix(0, deadline), true
+	}
+	switch deadline := m.MetaData[RequestDeadlineKey].(type) {
+	case time.Time:
+		return deadline, true
+	case *time.Time:
+		if deadline != nil {
+			return *deadline, true
 		}
 	}
+	return time.Time{}, false
+}
+
+// SetDeadline 以unix纳秒的形式在元数据中设置过期时间，任何序列化方式都能保留
+func (m *Message) SetDeadline(deadline time.Time) {
+	if m.MetaData == nil {
+		m.MetaData = make(map[string]interface{})
+	}
+	m.MetaData[RequestDeadlineKey] = deadline.UnixNano()
 }
 
 // NewMessage 创建消息
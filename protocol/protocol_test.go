@@ -0,0 +1,44 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMessageDeadline(t *testing.T) {
+	deadline := time.Unix(1700000000, 123)
+	tests := []struct {
+		name  string
+		value interface{}
+		want  time.Time
+		ok    bool
+	}{
+		{"int64", deadline.UnixNano(), deadline, true},
+		{"uint64", uint64(deadline.UnixNano()), deadline, true},
+		// msgpack把小的整数解码为较窄的类型
+		{"uint8", uint8(200), time.Unix(0, 200), true},
+		{"int16", int16(-1), time.Unix(0, -1), true},
+		{"time", deadline, deadline, true},
+		{"time pointer", &deadline, deadline, true},
+		{"nil pointer", (*time.Time)(nil), time.Time{}, false},
+		{"missing", nil, time.Time{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Message{Header: &Header{MetaData: map[string]interface{}{}}}
+			if tt.value != nil {
+				m.MetaData[RequestDeadlineKey] = tt.value
+			}
+			got, ok := m.Deadline()
+			if !got.Equal(tt.want) || ok != tt.ok {
+				t.Fatalf("Deadline() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+
+	m := &Message{Header: &Header{}}
+	m.SetDeadline(deadline)
+	if got, ok := m.Deadline(); !ok || !got.Equal(deadline) {
+		t.Fatalf("Deadline() after SetDeadline = %v, %v", got, ok)
+	}
+}
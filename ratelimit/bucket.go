@@ -0,0 +1,65 @@
+// Package ratelimit 令牌桶限流，规则可以按服务、方法和调用方配置，并在运行时重新加载
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket 令牌桶，以rate的速度产生令牌，最多存放burst个
+type Bucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+// NewBucket 创建装满令牌的令牌桶，rate为每秒产生的令牌数
+func NewBucket(rate float64, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// Allow 取出一个令牌
+func (b *Bucket) Allow() bool {
+	ok, _ := b.Take(time.Now())
+	return ok
+}
+
+// Take 在now时取出一个令牌，没有令牌时返回需要等待的时间
+func (b *Bucket) Take(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if b.rate <= 0 {
+		return false, time.Duration(1<<63 - 1)
+	}
+	wait := time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+	return false, wait
+}
+
+// refund 退回取出的令牌
+func (b *Bucket) refund() {
+	b.mu.Lock()
+	if b.tokens += 1; b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.mu.Unlock()
+}
+
+func (b *Bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * b.rate
+		if b.tokens > b.burst {
+			b.tokens = b.burst
+		}
+		b.last = now
+	}
+}
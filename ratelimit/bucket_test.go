@@ -0,0 +1,64 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBucketTake(t *testing.T) {
+	b := NewBucket(2, 3)
+	now := b.last
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.Take(now); !ok {
+			t.Fatalf("take %d rejected within burst", i)
+		}
+	}
+	ok, wait := b.Take(now)
+	if ok {
+		t.Fatal("take accepted after the burst was used up")
+	}
+	if wait != 500*time.Millisecond {
+		t.Fatalf("wait = %v, want 500ms", wait)
+	}
+	// 令牌按照rate恢复，但不超过burst
+	if ok, _ := b.Take(now.Add(500 * time.Millisecond)); !ok {
+		t.Fatal("take rejected after a token was refilled")
+	}
+	later := now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if ok, _ := b.Take(later); !ok {
+			t.Fatalf("take %d rejected after refill", i)
+		}
+	}
+	if ok, _ := b.Take(later); ok {
+		t.Fatal("bucket refilled beyond burst")
+	}
+}
+
+func TestBucketZeroRate(t *testing.T) {
+	b := NewBucket(0, 0)
+	now := b.last
+	if ok, _ := b.Take(now); !ok {
+		t.Fatal("burst should be at least 1")
+	}
+	ok, wait := b.Take(now.Add(time.Hour))
+	if ok || wait <= time.Hour {
+		t.Fatalf("Take() = %v, %v, want rejected forever", ok, wait)
+	}
+}
+
+func TestBucketRefund(t *testing.T) {
+	b := NewBucket(1, 1)
+	now := b.last
+	b.Take(now)
+	b.refund()
+	if ok, _ := b.Take(now); !ok {
+		t.Fatal("refunded token was not returned")
+	}
+	b.refund()
+	b.refund()
+	b.Take(now)
+	if ok, _ := b.Take(now); ok {
+		t.Fatal("refund exceeded burst")
+	}
+}
@@ -0,0 +1,137 @@
+package ratelimit
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Rule 限流规则，请求需要满足所有匹配的规则
+type Rule struct {
+	Service   string  // 为空时匹配所有服务
+	Method    string  // 为空时匹配所有方法
+	Caller    string  // 为空时匹配所有调用方
+	PerCaller bool    // 每个调用方单独使用一个令牌桶，否则匹配的请求共享一个令牌桶
+	Rate      float64 // 每秒产生的令牌数
+	Burst     int     // 令牌桶的容量，小于1时为1
+}
+
+func (r Rule) match(service, method, caller string) bool {
+	return (r.Service == "" || r.Service == service) &&
+		(r.Method == "" || r.Method == method) &&
+		(r.Caller == "" || r.Caller == caller)
+}
+
+// String 规则的描述，同时作为令牌桶的key，规则不变时重新加载不会重置令牌桶
+func (r Rule) String() string {
+	return fmt.Sprintf("service=%s method=%s caller=%s per_caller=%t rate=%g burst=%d",
+		r.Service, r.Method, r.Caller, r.PerCaller, r.Rate, r.Burst)
+}
+
+// maxBuckets 令牌桶的最大数量，超过时淘汰最久没有使用的令牌桶，避免按调用方限流时无限增长
+// 最久没有使用的令牌桶通常已经装满，淘汰它和重新创建没有区别
+const maxBuckets = 10000
+
+// ruleBucket 记录令牌桶属于哪条规则，重新加载时删除已经不存在的规则的令牌桶
+type ruleBucket struct {
+	*Bucket
+	key  string
+	rule string
+}
+
+// Limiter 按规则限流
+type Limiter struct {
+	mu        sync.RWMutex
+	rules     []Rule
+	bucketsMu sync.Mutex
+	ll        *list.List // 最近使用的令牌桶在前面
+	buckets   map[string]*list.Element
+}
+
+// NewLimiter 创建限流器
+func NewLimiter(rules ...Rule) *Limiter {
+	l := &Limiter{ll: list.New(), buckets: make(map[string]*list.Element)}
+	l.Update(rules...)
+	return l
+}
+
+// Update 重新加载规则，没有变化的规则保留当前的令牌桶
+func (l *Limiter) Update(rules ...Rule) {
+	keep := make(map[string]bool, len(rules))
+	for _, r := range rules {
+		keep[r.String()] = true
+	}
+	l.mu.Lock()
+	l.rules = append([]Rule(nil), rules...)
+	l.mu.Unlock()
+
+	l.bucketsMu.Lock()
+	for key, el := range l.buckets {
+		if !keep[el.Value.(*ruleBucket).rule] {
+			l.ll.Remove(el)
+			delete(l.buckets, key)
+		}
+	}
+	l.bucketsMu.Unlock()
+}
+
+// Rules 当前的规则
+func (l *Limiter) Rules() []Rule {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return append([]Rule(nil), l.rules...)
+}
+
+// Allow 判断请求是否被允许，拒绝时返回拒绝它的规则以及建议的等待时间
+func (l *Limiter) Allow(service, method, caller string) (bool, Rule, time.Duration) {
+	l.mu.RLock()
+	rules := l.rules
+	l.mu.RUnlock()
+	now := time.Now()
+	var taken []*Bucket
+	for _, r := range rules {
+		if !r.match(service, method, caller) {
+			continue
+		}
+		b := l.bucket(r, caller)
+		if ok, wait := b.Take(now); !ok {
+			// 被拒绝的请求不消耗其他规则的令牌
+			for _, t := range taken {
+				t.refund()
+			}
+			return false, r, wait
+		}
+		taken = append(taken, b)
+	}
+	return true, Rule{}, 0
+}
+
+func (l *Limiter) bucket(r Rule, caller string) *Bucket {
+	rule := r.String()
+	key := rule
+	if r.PerCaller {
+		key += " caller_key=" + caller
+	}
+	l.bucketsMu.Lock()
+	defer l.bucketsMu.Unlock()
+	if el, ok := l.buckets[key]; ok {
+		l.ll.MoveToFront(el)
+		return el.Value.(*ruleBucket).Bucket
+	}
+	b := &ruleBucket{Bucket: NewBucket(r.Rate, r.Burst), key: key, rule: rule}
+	l.buckets[key] = l.ll.PushFront(b)
+	for len(l.buckets) > maxBuckets {
+		el := l.ll.Back()
+		l.ll.Remove(el)
+		delete(l.buckets, el.Value.(*ruleBucket).key)
+	}
+	return b.Bucket
+}
+
+// Len 当前的令牌桶数量
+func (l *Limiter) Len() int {
+	l.bucketsMu.Lock()
+	defer l.bucketsMu.Unlock()
+	return len(l.buckets)
+}
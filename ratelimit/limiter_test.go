@@ -0,0 +1,90 @@
+package ratelimit
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestLimiterRules(t *testing.T) {
+	l := NewLimiter(
+		Rule{Service: "Arith", Rate: 0, Burst: 2},
+		Rule{Service: "Arith", Method: "Mul", Rate: 0, Burst: 1},
+	)
+	if ok, _, _ := l.Allow("Arith", "Mul", ""); !ok {
+		t.Fatal("first Mul rejected")
+	}
+	ok, rule, _ := l.Allow("Arith", "Mul", "")
+	if ok || rule.Method != "Mul" {
+		t.Fatalf("second Mul = %v, %v, want rejected by the Mul rule", ok, rule)
+	}
+	// 被Mul的规则拒绝的请求不消耗服务级别的令牌
+	if ok, _, _ := l.Allow("Arith", "Add", ""); !ok {
+		t.Fatal("Add rejected, tokens of the rejected Mul call were not refunded")
+	}
+	if ok, _, _ := l.Allow("Arith", "Add", ""); ok {
+		t.Fatal("service burst exceeded")
+	}
+	if ok, _, _ := l.Allow("Other", "Add", ""); !ok {
+		t.Fatal("unmatched service was limited")
+	}
+}
+
+func TestLimiterPerCaller(t *testing.T) {
+	l := NewLimiter(Rule{PerCaller: true, Rate: 0, Burst: 1}, Rule{Caller: "bob", Rate: 0, Burst: 1})
+	if ok, _, _ := l.Allow("Arith", "Add", "alice"); !ok {
+		t.Fatal("alice rejected")
+	}
+	if ok, _, _ := l.Allow("Arith", "Add", "alice"); ok {
+		t.Fatal("alice exceeded her bucket")
+	}
+	if ok, _, _ := l.Allow("Arith", "Add", "carol"); !ok {
+		t.Fatal("carol shares alice's bucket")
+	}
+	if ok, _, _ := l.Allow("Arith", "Add", "bob"); !ok {
+		t.Fatal("bob rejected")
+	}
+	if ok, rule, _ := l.Allow("Arith", "Add", "bob"); ok || rule.Caller != "" {
+		t.Fatalf("bob = %v, %v, want rejected by the per caller rule first", ok, rule)
+	}
+}
+
+func TestLimiterUpdate(t *testing.T) {
+	keep := Rule{Service: "Arith", Rate: 0, Burst: 1}
+	drop := Rule{Service: "Other", Rate: 0, Burst: 1}
+	l := NewLimiter(keep, drop)
+	l.Allow("Arith", "Add", "")
+	l.Allow("Other", "Add", "")
+
+	l.Update(keep, Rule{Service: "New", Rate: 0, Burst: 1})
+	if ok, _, _ := l.Allow("Arith", "Add", ""); ok {
+		t.Fatal("bucket of an unchanged rule was reset")
+	}
+	if l.Len() != 1 {
+		t.Fatalf("Len() = %d, want 1 after dropping the removed rule", l.Len())
+	}
+	if got := len(l.Rules()); got != 2 {
+		t.Fatalf("len(Rules()) = %d, want 2", got)
+	}
+}
+
+func TestLimiterMaxBuckets(t *testing.T) {
+	l := NewLimiter(Rule{PerCaller: true, Rate: 0, Burst: 1})
+	l.Allow("Arith", "Add", "first")
+	for i := 0; i < maxBuckets+100; i++ {
+		l.Allow("Arith", "Add", strconv.Itoa(i))
+		if i%1000 == 0 {
+			// 经常使用的令牌桶不会被淘汰
+			l.Allow("Arith", "Add", "first")
+		}
+	}
+	if l.Len() != maxBuckets {
+		t.Fatalf("Len() = %d, want %d", l.Len(), maxBuckets)
+	}
+	if ok, _, _ := l.Allow("Arith", "Add", "first"); ok {
+		t.Fatal("recently used bucket was evicted")
+	}
+	// 最久没有使用的令牌桶被淘汰，重新创建后是满的
+	if ok, _, _ := l.Allow("Arith", "Add", "1"); !ok {
+		t.Fatal("least recently used bucket was kept")
+	}
+}
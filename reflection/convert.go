@@ -0,0 +1,250 @@
+package reflection
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/codec"
+)
+
+// Convert 将json解析得到的值(map[string]interface{}、[]interface{}、json.Number等)按照类型描述
+// 转换为可以直接用指定编码序列化的值，struct转换为以该编码的字段名为键的map
+// td为nil时只对数字做转换，用于没有反射信息的情况
+func Convert(v interface{}, td *TypeDescriptor, st codec.SerializeType) (interface{}, error) {
+	switch st {
+	case codec.MessagePackType, codec.JsonType:
+	default:
+		return nil, fmt.Errorf("serialize type %s is not supported for dynamic calls", st)
+	}
+	if td == nil {
+		return convertGeneric(v), nil
+	}
+	return convert(v, td, st, "$")
+}
+
+func convert(v interface{}, td *TypeDescriptor, st codec.SerializeType, path string) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+	if td.Ref != "" {
+		// 递归引用的类型没有字段信息，按照通用的方式转换
+		return convertGeneric(v), nil
+	}
+	switch td.Kind {
+	case "ptr":
+		return convert(v, td.Elem, st, path)
+	case "bool":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, typeError(path, "boolean", v)
+		}
+		return b, nil
+	case "int", "int8", "int16", "int32", "int64":
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, typeError(path, "integer", v)
+		}
+		i, err := strconv.ParseInt(n.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return i, nil
+	case "uint", "uint8", "uint16", "uint32", "uint64", "uintptr":
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, typeError(path, "unsigned integer", v)
+		}
+		u, err := strconv.ParseUint(n.String(), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return u, nil
+	case "float32", "float64":
+		n, ok := v.(json.Number)
+		if !ok {
+			return nil, typeError(path, "number", v)
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return f, nil
+	case "string":
+		s, ok := v.(string)
+		if !ok {
+			return nil, typeError(path, "string", v)
+		}
+		return s, nil
+	case KindTime:
+		s, ok := v.(string)
+		if !ok {
+			return nil, typeError(path, "RFC3339 time string", v)
+		}
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", path, err)
+		}
+		return t, nil
+	case "slice", "array":
+		if td.Elem.Kind == "uint8" {
+			s, ok := v.(string)
+			if !ok {
+				return nil, typeError(path, "base64 string", v)
+			}
+			b, err := base64.StdEncoding.DecodeString(s)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", path, err)
+			}
+			return b, nil
+		}
+		list, ok := v.([]interface{})
+		if !ok {
+			return nil, typeError(path, "array", v)
+		}
+		res := make([]interface{}, len(list))
+		for i, item := range list {
+			converted, err := convert(item, td.Elem, st, fmt.Sprintf("%s[%d]", path, i))
+			if err != nil {
+				return nil, err
+			}
+			res[i] = converted
+		}
+		return res, nil
+	case "map":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, typeError(path, "object", v)
+		}
+		// json只支持字符串键，保留原来的键，键的类型只做校验
+		jsonRes := make(map[string]interface{}, len(m))
+		res := make(map[interface{}]interface{}, len(m))
+		for k, item := range m {
+			key, err := convertKey(k, td.Key, path)
+			if err != nil {
+				return nil, err
+			}
+			converted, err := convert(item, td.Elem, st, path+"."+k)
+			if err != nil {
+				return nil, err
+			}
+			jsonRes[k] = converted
+			res[key] = converted
+		}
+		if st == codec.JsonType {
+			return jsonRes, nil
+		}
+		return res, nil
+	case "struct":
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, typeError(path, "object", v)
+		}
+		res := make(map[string]interface{}, len(m))
+		for k, item := range m {
+			field, ok := findField(td, k)
+			if !ok {
+				return nil, fmt.Errorf("%s: unknown field %s in %s", path, k, td.Name)
+			}
+			name := field.MsgpackName
+			if st == codec.JsonType {
+				name = field.JSONName
+			}
+			if name == "-" {
+				continue
+			}
+			converted, err := convert(item, field.Type, st, path+"."+k)
+			if err != nil {
+				return nil, err
+			}
+			res[name] = converted
+		}
+		return res, nil
+	default:
+		return convertGeneric(v), nil
+	}
+}
+
+// findField 按照json字段名或者Go字段名查找字段
+func findField(td *TypeDescriptor, name string) (*FieldDescriptor, bool) {
+	for i := range td.Fields {
+		if td.Fields[i].JSONName == name || td.Fields[i].Name == name {
+			return &td.Fields[i], true
+		}
+	}
+	for i := range td.Fields {
+		if strings.EqualFold(td.Fields[i].Name, name) {
+			return &td.Fields[i], true
+		}
+	}
+	return nil, false
+}
+
+// convertKey 将json对象的键转换为map的键类型
+func convertKey(k string, td *TypeDescriptor, path string) (interface{}, error) {
+	switch td.Kind {
+	case "string":
+		return k, nil
+	default:
+		return convert(json.Number(k), td, codec.MessagePackType, path+"."+k)
+	}
+}
+
+// convertGeneric 没有类型信息时，整数转换为int64，其他数字转换为float64
+func convertGeneric(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			res[k] = convertGeneric(item)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			res[i] = convertGeneric(item)
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+// JSONValue 将解码得到的任意值转换为可以用json编码的值，比如把map[interface{}]interface{}转换为map[string]interface{}
+func JSONValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			res[fmt.Sprint(k)] = JSONValue(item)
+		}
+		return res
+	case map[string]interface{}:
+		res := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			res[k] = JSONValue(item)
+		}
+		return res
+	case []interface{}:
+		res := make([]interface{}, len(v))
+		for i, item := range v {
+			res[i] = JSONValue(item)
+		}
+		return res
+	default:
+		return v
+	}
+}
+
+func typeError(path, want string, got interface{}) error {
+	return fmt.Errorf("%s: expect %s, got %T", path, want, got)
+}
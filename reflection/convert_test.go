@@ -0,0 +1,89 @@
+package reflection
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/codec"
+)
+
+type convertItem struct {
+	Name  string    `json:"item_name" msgpack:"item_name"`
+	Count int       `json:"count" msgpack:"count"`
+	At    time.Time `json:"at" msgpack:"at"`
+}
+
+type convertArgs struct {
+	Items map[string]convertItem `json:"items" msgpack:"items"`
+	Times map[string]time.Time   `json:"times" msgpack:"times"`
+	ByID  map[int]convertItem    `json:"by_id" msgpack:"by_id"`
+}
+
+func TestConvertMap(t *testing.T) {
+	at := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	input := `{
+		"items": {"a": {"item_name": "apple", "count": 3, "at": "2021-03-04T05:06:07Z"}},
+		"times": {"start": "2021-03-04T05:06:07Z"},
+		"by_id": {"7": {"Name": "seven", "Count": 7, "At": "2021-03-04T05:06:07Z"}}
+	}`
+	want := convertArgs{
+		Items: map[string]convertItem{"a": {Name: "apple", Count: 3, At: at}},
+		Times: map[string]time.Time{"start": at},
+		ByID:  map[int]convertItem{7: {Name: "seven", Count: 7, At: at}},
+	}
+	tests := []struct {
+		name string
+		st   codec.SerializeType
+	}{
+		{"json", codec.JsonType},
+		{"msgpack", codec.MessagePackType},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := json.NewDecoder(strings.NewReader(input))
+			dec.UseNumber()
+			var v interface{}
+			if err := dec.Decode(&v); err != nil {
+				t.Fatal(err)
+			}
+			converted, err := Convert(v, DescribeType(reflect.TypeOf(convertArgs{})), tt.st)
+			if err != nil {
+				t.Fatalf("Convert() error = %v", err)
+			}
+			cc := codec.GetCodec(tt.st)
+			data, err := cc.Encode(converted)
+			if err != nil {
+				t.Fatalf("Encode() error = %v", err)
+			}
+			var got convertArgs
+			if err := cc.Decode(data, &got); err != nil {
+				t.Fatalf("Decode() error = %v", err)
+			}
+			for k, item := range got.Items {
+				item.At = item.At.UTC()
+				got.Items[k] = item
+			}
+			for k, item := range got.ByID {
+				item.At = item.At.UTC()
+				got.ByID[k] = item
+			}
+			for k, v := range got.Times {
+				got.Times[k] = v.UTC()
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestConvertMapKeyError(t *testing.T) {
+	td := DescribeType(reflect.TypeOf(map[int]string{}))
+	_, err := Convert(map[string]interface{}{"x": "a"}, td, codec.JsonType)
+	if err == nil {
+		t.Fatal("expect error for non-integer key")
+	}
+}
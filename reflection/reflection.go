@@ -0,0 +1,170 @@
+package reflection
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// 反射服务的服务名和方法名
+const (
+	ServiceName    = "Reflection"
+	DescribeMethod = "Describe"
+)
+
+// 类型的Kind，除了reflect.Kind之外增加了time
+const (
+	KindTime = "time"
+)
+
+var typeOfTime = reflect.TypeOf(time.Time{})
+
+// TypeDescriptor 类型描述
+type TypeDescriptor struct {
+	Name   string            `json:"name,omitempty"`   //命名类型的名称，如service.Args
+	Kind   string            `json:"kind"`             //reflect.Kind的字符串形式，如int、struct、slice
+	Fields []FieldDescriptor `json:"fields,omitempty"` //struct的字段
+	Elem   *TypeDescriptor   `json:"elem,omitempty"`   //slice、array、ptr、map的元素类型
+	Key    *TypeDescriptor   `json:"key,omitempty"`    //map的键类型
+	Ref    string            `json:"ref,omitempty"`    //递归引用的类型名，此时不再展开
+}
+
+// FieldDescriptor 字段描述
+type FieldDescriptor struct {
+	Name        string          `json:"name"`         //Go字段名
+	JSONName    string          `json:"json_name"`    //json编码时的字段名
+	MsgpackName string          `json:"msgpack_name"` //messagepack编码时的字段名
+	Type        *TypeDescriptor `json:"type"`
+}
+
+// MethodDescriptor 方法描述
+type MethodDescriptor struct {
+	Name        string                 `json:"name"`
+	ArgType     *TypeDescriptor        `json:"arg_type"`
+	ReplyType   *TypeDescriptor        `json:"reply_type"`
+	ArgSchema   map[string]interface{} `json:"arg_schema"`   //参数的json schema
+	ReplySchema map[string]interface{} `json:"reply_schema"` //返回值的json schema
+}
+
+// ServiceDescriptor 服务描述
+type ServiceDescriptor struct {
+	Name    string             `json:"name"`
+	Methods []MethodDescriptor `json:"methods"`
+}
+
+// Method 按方法名查找方法
+func (sd *ServiceDescriptor) Method(name string) (*MethodDescriptor, bool) {
+	for i := range sd.Methods {
+		if sd.Methods[i].Name == name {
+			return &sd.Methods[i], true
+		}
+	}
+	return nil, false
+}
+
+// DescribeRequest 查询服务描述，Service为空时查询所有服务
+type DescribeRequest struct {
+	Service string `json:"service"`
+}
+
+// DescribeResponse 服务描述
+type DescribeResponse struct {
+	Services []ServiceDescriptor `json:"services"`
+}
+
+// DescribeMethodType 根据方法的参数和返回值类型生成方法描述
+func DescribeMethodType(name string, argType, replyType reflect.Type) MethodDescriptor {
+	md := MethodDescriptor{
+		Name:      name,
+		ArgType:   DescribeType(argType),
+		ReplyType: DescribeType(replyType),
+	}
+	md.ArgSchema = JSONSchema(md.ArgType)
+	md.ReplySchema = JSONSchema(md.ReplyType)
+	return md
+}
+
+// DescribeType 生成类型描述，递归引用的struct只展开一次
+func DescribeType(t reflect.Type) *TypeDescriptor {
+	return describe(t, make(map[reflect.Type]bool))
+}
+
+func describe(t reflect.Type, visiting map[reflect.Type]bool) *TypeDescriptor {
+	td := &TypeDescriptor{Kind: t.Kind().String()}
+	if t.Name() != "" && t.PkgPath() != "" {
+		td.Name = t.String()
+	}
+	if t == typeOfTime {
+		td.Kind = KindTime
+		return td
+	}
+	switch t.Kind() {
+	case reflect.Ptr, reflect.Slice, reflect.Array:
+		td.Elem = describe(t.Elem(), visiting)
+	case reflect.Map:
+		td.Key = describe(t.Key(), visiting)
+		td.Elem = describe(t.Elem(), visiting)
+	case reflect.Struct:
+		if visiting[t] {
+			return &TypeDescriptor{Kind: td.Kind, Ref: t.String()}
+		}
+		visiting[t] = true
+		td.Fields = describeFields(t, visiting)
+		delete(visiting, t)
+	}
+	return td
+}
+
+// describeFields 描述struct的可导出字段，没有指定名称的匿名struct字段会被展开，与json和messagepack的编码方式一致
+func describeFields(t reflect.Type, visiting map[reflect.Type]bool) []FieldDescriptor {
+	var fields []FieldDescriptor
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" && !f.Anonymous {
+			continue
+		}
+		jsonName, jsonSkip := tagName(f.Tag.Get("json"))
+		msgpackName, msgpackSkip := tagName(f.Tag.Get("msgpack"))
+		if jsonSkip && msgpackSkip {
+			continue
+		}
+		ft := f.Type
+		if f.Anonymous && ft.Kind() == reflect.Struct && jsonName == "" && msgpackName == "" {
+			fields = append(fields, describeFields(ft, visiting)...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if jsonName == "" {
+			jsonName = f.Name
+		}
+		if msgpackName == "" {
+			msgpackName = f.Name
+		}
+		if jsonSkip {
+			jsonName = "-"
+		}
+		if msgpackSkip {
+			msgpackName = "-"
+		}
+		fields = append(fields, FieldDescriptor{
+			Name:        f.Name,
+			JSONName:    jsonName,
+			MsgpackName: msgpackName,
+			Type:        describe(ft, visiting),
+		})
+	}
+	return fields
+}
+
+// tagName 解析tag中的名称，返回的skip表示字段被忽略
+func tagName(tag string) (name string, skip bool) {
+	if tag == "-" {
+		return "", true
+	}
+	if idx := strings.Index(tag, ","); idx >= 0 {
+		tag = tag[:idx]
+	}
+	return tag, false
+}
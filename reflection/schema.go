@@ -0,0 +1,57 @@
+package reflection
+
+// JSONSchema 根据类型描述生成json schema
+func JSONSchema(td *TypeDescriptor) map[string]interface{} {
+	schema := make(map[string]interface{})
+	if td.Name != "" {
+		schema["title"] = td.Name
+	}
+	if td.Ref != "" {
+		// 递归引用的类型不再展开
+		schema["type"] = "object"
+		schema["title"] = td.Ref
+		return schema
+	}
+	switch td.Kind {
+	case "bool":
+		schema["type"] = "boolean"
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr":
+		schema["type"] = "integer"
+	case "float32", "float64":
+		schema["type"] = "number"
+	case "string":
+		schema["type"] = "string"
+	case KindTime:
+		schema["type"] = "string"
+		schema["format"] = "date-time"
+	case "ptr":
+		elem := JSONSchema(td.Elem)
+		for k, v := range elem {
+			schema[k] = v
+		}
+	case "slice", "array":
+		if td.Elem.Kind == "uint8" {
+			// []byte按base64编码为字符串
+			schema["type"] = "string"
+			schema["contentEncoding"] = "base64"
+			break
+		}
+		schema["type"] = "array"
+		schema["items"] = JSONSchema(td.Elem)
+	case "map":
+		schema["type"] = "object"
+		schema["additionalProperties"] = JSONSchema(td.Elem)
+	case "struct":
+		schema["type"] = "object"
+		properties := make(map[string]interface{})
+		for _, f := range td.Fields {
+			if f.JSONName == "-" {
+				continue
+			}
+			properties[f.JSONName] = JSONSchema(f.Type)
+		}
+		schema["properties"] = properties
+	}
+	return schema
+}
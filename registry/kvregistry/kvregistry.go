@@ -4,13 +4,14 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
-	"log"
+	"reflect"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/lincx-911/lincxrpc/common"
+	"github.com/lincx-911/lincxrpc/logger"
 	"github.com/lincx-911/lincxrpc/registry"
 
 	"github.com/docker/libkv"
@@ -31,21 +32,34 @@ const(
 )
 
 type KVRegistry struct {
-	AppKey         string        //KVRegistry
+	AppKey         string        //默认应用，GetServiceList/Watch传入的appKey为空时使用
 	ServicePath    string        //数据存储的基本路径位置，比如/service/providers
 	UpdateInterval time.Duration //定时拉取数据的时间间隔
+	SnapshotPath   string        //服务列表快照文件路径
 
+	kvMu        sync.RWMutex
 	kv          store.Store //store实例是一个封装过的客户端
 	providersMu sync.RWMutex
-	providers   []registry.Provider
+	providers   map[string][]registry.Provider //appKey -> providers
+	apps        map[string]bool                //已经开始拉取和监听的应用
+	live        map[string]bool                //服务列表已经从注册中心拉取到的应用，否则来自快照
+
+	snapshotMu sync.Mutex
 
 	watchersMu sync.Mutex
 	watchers   []*Watcher //watch 列表
+
+	done      chan struct{} //Close后关闭，停止后台的拉取和监听
+	closeOnce sync.Once
+
+	pendingMu sync.Mutex
+	pending   map[string]map[string]registry.Provider //appKey -> providerKey -> provider，还没有成功写入注册中心的提供者
 }
 
 type Watcher struct {
-	event chan *registry.Event
-	exit  chan struct{}
+	appKey string
+	event  chan *registry.Event
+	exit   chan struct{}
 }
 
 func (w *Watcher) Next() (*registry.Event, error) {
@@ -68,8 +82,59 @@ func (w *Watcher) Close() {
 	}
 }
 
+// Option kv注册中心配置
+type Option struct {
+	Backend        Backend
+	Addrs          []string
+	AppKey         string //默认应用
+	Config         *store.Config
+	ServicePath    string        //数据存储的基本路径位置
+	UpdateInterval time.Duration //定时拉取数据、重连注册中心以及重试注册的时间间隔
+	SnapshotPath   string        //服务列表快照文件路径，为空则不使用快照
+}
+
 func NewKVRegistry(backend Backend, addrs []string, AppKey string,
 	cfg *store.Config, servicePath string, updateInterval time.Duration) registry.Registry {
+	return NewKVRegistryWithOption(Option{
+		Backend:        backend,
+		Addrs:          addrs,
+		AppKey:         AppKey,
+		Config:         cfg,
+		ServicePath:    servicePath,
+		UpdateInterval: updateInterval,
+	})
+}
+
+// NewKVRegistryWithOption 创建kv注册中心
+// 注册中心不可用时不会退出，而是在后台重连，期间使用快照中的服务列表
+func NewKVRegistryWithOption(opt Option) registry.Registry {
+	r := new(KVRegistry)
+	r.AppKey = opt.AppKey
+	r.UpdateInterval = opt.UpdateInterval
+	r.SnapshotPath = opt.SnapshotPath
+
+	servicePath := opt.ServicePath
+	if servicePath[0] == '/' {
+		//路径不能以"/"开头
+		servicePath = servicePath[1:]
+	}
+	r.ServicePath = servicePath
+	r.providers = make(map[string][]registry.Provider)
+	r.apps = make(map[string]bool)
+	r.live = make(map[string]bool)
+	r.pending = make(map[string]map[string]registry.Provider)
+	r.done = make(chan struct{})
+
+	r.connect(opt)
+	go r.maintain(opt)
+
+	//先拉取并监听默认应用
+	r.track(r.AppKey)
+	return r
+}
+
+// NewStore 创建kv存储的客户端，注册中心之外的组件(比如幂等结果的存储)可以复用同样的后端
+func NewStore(backend Backend, addrs []string, cfg *store.Config) (store.Store, error) {
 	var be store.Backend
 	switch backend {
 	case ZK:
@@ -82,67 +147,228 @@ func NewKVRegistry(backend Backend, addrs []string, AppKey string,
 		be = store.BOLTDB
 		boltdb.Register()
 	}
-	r := new(KVRegistry)
-	r.AppKey = AppKey
-	r.UpdateInterval = updateInterval
-	kv, err := libkv.NewStore(be, addrs, cfg)
+	return libkv.NewStore(be, addrs, cfg)
+}
+
+// connect 连接注册中心并创建基本路径，创建基本路径失败时认为没有连接上
+// consul和zk的客户端在第一次请求时才真正连接，NewStore成功不代表注册中心可用
+func (r *KVRegistry) connect(opt Option) bool {
+	kv, err := NewStore(opt.Backend, opt.Addrs, opt.Config)
+	if err != nil {
+		logger.Error("cannot create kv registry", logger.Err(err))
+		return false
+	}
+
+	//先创建基本路径
+	err = kv.Put(r.ServicePath, []byte("base path"), &store.WriteOptions{IsDir: true})
 	if err != nil {
-		log.Fatalf("cannot create kv registry: %v", err)
+		logger.Error("cannot create registry path", logger.F("path", r.ServicePath), logger.Err(err))
+		kv.Close()
+		return false
 	}
+	r.kvMu.Lock()
 	r.kv = kv
+	r.kvMu.Unlock()
 
-	if servicePath[0] == '/' {
-		//路径不能以"/"开头
-		servicePath = servicePath[1:]
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+	if len(r.pending) > 0 {
+		logger.Info("registry connected, registering pending providers", logger.F("apps", len(r.pending)))
 	}
-	r.ServicePath = servicePath
+	r.flushPending(kv)
+	return true
+}
 
-	//先创建基本路径
-	err = r.kv.Put(servicePath, []byte("base path"), &store.WriteOptions{IsDir: true})
-	if err != nil {
-		log.Fatalf("cannot create regitry path %s: %v", r.ServicePath, err)
+// maintain 没有连接上注册中心时定时重连，连接上之后定时重试写入失败的提供者
+func (r *KVRegistry) maintain(opt Option) {
+	t := time.NewTicker(r.UpdateInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			kv := r.store()
+			if kv == nil {
+				r.connect(opt)
+				continue
+			}
+			r.pendingMu.Lock()
+			r.flushPending(kv)
+			r.pendingMu.Unlock()
+		case <-r.done:
+			return
+		}
 	}
+}
+
+// flushPending 写入待注册的提供者，写入失败的保留下来之后重试，调用方持有pendingMu
+func (r *KVRegistry) flushPending(kv store.Store) {
+	for appKey, providers := range r.pending {
+		for key, p := range providers {
+			if r.put(kv, appKey, p) == nil {
+				delete(providers, key)
+			}
+		}
+		if len(providers) == 0 {
+			delete(r.pending, appKey)
+		}
+	}
+}
+
+// store 获取kv客户端，还没有连接上注册中心时返回nil
+func (r *KVRegistry) store() store.Store {
+	r.kvMu.RLock()
+	defer r.kvMu.RUnlock()
+	return r.kv
+}
+
+// track 开始拉取并监听应用的服务列表，已经在监听的应用直接返回
+func (r *KVRegistry) track(appKey string) {
+	r.providersMu.Lock()
+	if r.apps[appKey] {
+		r.providersMu.Unlock()
+		return
+	}
+	r.apps[appKey] = true
+	r.providersMu.Unlock()
 
 	//尝试拉取一次数据
-	r.doGetServiceList()
+	r.doGetServiceList(appKey)
 	go func() {
-		t := time.NewTicker(updateInterval)
-		for range t.C {
-			//定时拉取数据
-			r.doGetServiceList()
+		t := time.NewTicker(r.UpdateInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				//定时拉取数据
+				r.doGetServiceList(appKey)
+			case <-r.done:
+				return
+			}
 		}
 	}()
 	go func() {
 		//watch数据
-		r.watch()
+		r.watch(appKey)
 	}()
-	return r
 }
 
-func (r *KVRegistry) doGetServiceList() {
-	path := constructServiceBasePath(r.ServicePath, r.AppKey)
-	kvPairs, err := r.kv.List(path)
+// appKey 未指定应用时使用默认应用
+func (r *KVRegistry) appKey(appKey string) string {
+	if appKey == "" {
+		return r.AppKey
+	}
+	return appKey
+}
+
+func (r *KVRegistry) doGetServiceList(appKey string) {
+	kv := r.store()
+	if kv == nil {
+		r.restoreSnapshot(appKey)
+		return
+	}
+	path := constructServiceBasePath(r.ServicePath, appKey)
+	kvPairs, err := kv.List(path)
 
 	if err != nil {
-		log.Printf("error get service list %v", err)
+		logger.Warn("error get service list", logger.F("app", appKey), logger.Err(err))
+		r.restoreSnapshot(appKey)
 		return
 	}
-	var list []registry.Provider
-	for _, pair := range kvPairs {
+	r.update(appKey, kvPairs2Providers(kvPairs))
+}
 
-		list = append(list, kv2Provider(pair))
+// update 更新从注册中心拉取到的服务列表，有变化时通知watcher并保存快照
+func (r *KVRegistry) update(appKey string, list []registry.Provider) {
+	r.providersMu.Lock()
+	changed := !r.live[appKey] || !reflect.DeepEqual(r.providers[appKey], list)
+	r.providers[appKey] = list
+	r.live[appKey] = true
+	r.providersMu.Unlock()
+	if !changed {
+		return
+	}
+	r.notify(appKey, list)
+	r.saveSnapshot()
+}
+
+// restoreSnapshot 注册中心不可用并且还没有拉取到服务列表时，从快照中恢复
+func (r *KVRegistry) restoreSnapshot(appKey string) {
+	if r.SnapshotPath == "" {
+		return
+	}
+	if r.hasProviders(appKey) {
+		//已经有服务列表了，保留上一次的结果
+		return
+	}
+	//读取文件时不持有providersMu，避免阻塞GetServiceList
+	r.snapshotMu.Lock()
+	snap, err := loadSnapshot(r.SnapshotPath)
+	r.snapshotMu.Unlock()
+	if err != nil {
+		logger.Warn("load registry snapshot error", logger.F("path", r.SnapshotPath), logger.Err(err))
+		return
+	}
+	list, ok := snap.Apps[appKey]
+	if !ok {
+		return
 	}
 	r.providersMu.Lock()
-	r.providers = list
+	if _, ok := r.providers[appKey]; ok {
+		//读取快照期间已经拉取到了服务列表
+		r.providersMu.Unlock()
+		return
+	}
+	r.providers[appKey] = list
 	r.providersMu.Unlock()
+	logger.Warn("registry unavailable, restored providers from snapshot",
+		logger.F("app", appKey), logger.F("providers", len(list)), logger.F("saved_at", snap.UpdatedAt.Format(time.RFC3339)))
+	r.notify(appKey, list)
+}
 
+// hasProviders 是否已经有应用的服务列表
+func (r *KVRegistry) hasProviders(appKey string) bool {
+	r.providersMu.RLock()
+	defer r.providersMu.RUnlock()
+	_, ok := r.providers[appKey]
+	return ok
 }
 
-func (r *KVRegistry) GetServiceList() []registry.Provider {
+// saveSnapshot 将已经从注册中心拉取到的服务列表保存到快照文件
+func (r *KVRegistry) saveSnapshot() {
+	if r.SnapshotPath == "" {
+		return
+	}
+	apps := make(map[string][]registry.Provider)
+	r.providersMu.RLock()
+	for appKey := range r.live {
+		apps[appKey] = r.providers[appKey]
+	}
+	r.providersMu.RUnlock()
+
+	r.snapshotMu.Lock()
+	defer r.snapshotMu.Unlock()
+	//保留快照中其他应用的服务列表
+	snap, err := loadSnapshot(r.SnapshotPath)
+	if err != nil || snap.Apps == nil {
+		snap = &snapshot{Apps: make(map[string][]registry.Provider)}
+	}
+	for appKey, list := range apps {
+		snap.Apps[appKey] = list
+	}
+	snap.UpdatedAt = time.Now()
+	if err := writeSnapshot(r.SnapshotPath, snap); err != nil {
+		logger.Warn("save registry snapshot error", logger.F("path", r.SnapshotPath), logger.Err(err))
+	}
+}
+
+// GetServiceList 获取指定应用的服务列表，首次获取时开始监听该应用
+func (r *KVRegistry) GetServiceList(appKey string) []registry.Provider {
+	appKey = r.appKey(appKey)
+	r.track(appKey)
 	r.providersMu.RLock()
 	defer r.providersMu.RUnlock()
 
-	return r.providers
+	return r.providers[appKey]
 }
 
 func constructServiceBasePath(basePath string, appkey string) string {
@@ -156,8 +382,10 @@ func constructServiceBasePath(basePath string, appkey string) string {
 // kv2Provider 键值对转换为provider
 func kv2Provider(kv *store.KVPair) registry.Provider {
 	provider := registry.Provider{}
-	provider.ProviderKey = kv.Key
-	networkAndAddr := strings.SplitN(kv.Key, "@", 2)
+	// 键为完整路径，最后一段才是network@addr
+	key := kv.Key[strings.LastIndex(kv.Key, "/")+1:]
+	provider.ProviderKey = key
+	networkAndAddr := strings.SplitN(key, "@", 2)
 	provider.Network = networkAndAddr[0]
 	provider.Addr = networkAndAddr[1]
 	meta := make(map[string]interface{})
@@ -167,87 +395,184 @@ func kv2Provider(kv *store.KVPair) registry.Provider {
 	return provider
 }
 
-func (r *KVRegistry) watch() {
+// kvPairs2Providers 键值对列表转换为provider列表，忽略不是provider的键
+func kvPairs2Providers(kvPairs []*store.KVPair) []registry.Provider {
+	var list []registry.Provider
+	for _, pair := range kvPairs {
+		if !strings.Contains(pair.Key[strings.LastIndex(pair.Key, "/")+1:], "@") {
+			continue
+		}
+		list = append(list, kv2Provider(pair))
+	}
+	return list
+}
+
+func (r *KVRegistry) watch(appKey string) {
 	//每次监听到数据后都需要重新watch
-	for {
+	for !r.closed() {
 		// 监听appkey对应的目录,一旦父级目录的数据有变更就重新读取服务列表
-		appkeyPath := constructServiceBasePath(r.ServicePath, r.AppKey)
+		appkeyPath := constructServiceBasePath(r.ServicePath, appKey)
+		kv := r.store()
+		if kv == nil {
+			//还没有连接上注册中心
+			r.sleep(r.UpdateInterval)
+			continue
+		}
 		// 判断路径是否存在
-		if exit, _ := r.kv.Exists(appkeyPath); !exit {
+		if exit, _ := kv.Exists(appkeyPath); !exit {
 			lastUpdate := strconv.Itoa(int(time.Now().UnixNano()))
-			err := r.kv.Put(appkeyPath, []byte(lastUpdate), &store.WriteOptions{IsDir: true})
+			err := kv.Put(appkeyPath, []byte(lastUpdate), &store.WriteOptions{IsDir: true})
 			if err != nil {
-				log.Printf("create path before watch error,  key %v", appkeyPath)
+				logger.Warn("create path before watch error", logger.F("key", appkeyPath), logger.Err(err))
+				r.sleep(r.UpdateInterval)
 				continue
 			}
 		}
-		ch, err := r.kv.Watch(appkeyPath, nil)
+		stopCh := make(chan struct{})
+		ch, err := kv.Watch(appkeyPath, stopCh)
 		if err != nil {
-			log.Printf("error watch %v", err)
+			logger.Warn("error watch", logger.F("key", appkeyPath), logger.Err(err))
+			r.sleep(r.UpdateInterval)
 			continue
 		}
 		watchFinish := false
 		for !watchFinish {
 			//循环读取watch到的数据
 			select {
+			case <-r.done:
+				close(stopCh)
+				return
 			case pairs := <-ch:
 				// watch数据结束，跳出循环
 				if pairs == nil {
-					log.Println("read finish")
+					logger.Debug("watch finished", logger.F("key", appkeyPath))
 					watchFinish = true
 				}
 				//重新读取服务列表
-				latestPairs, err := r.kv.List(appkeyPath)
+				latestPairs, err := kv.List(appkeyPath)
 				if err != nil {
 					watchFinish = true
+					continue
 				}
-				r.providersMu.RLock()
-				list := r.providers
-				r.providersMu.RUnlock()
-				for _, p := range latestPairs {
-					log.Printf("got provider %v", kv2Provider(p))
-					list = append(list, kv2Provider(p))
-				}
-
-				r.providersMu.Lock()
-				r.providers = list
-				r.providersMu.Unlock()
-				//通知watcher
-				for _, w := range r.watchers {
-					w.event <- &registry.Event{AppKey: r.AppKey, Providers: list}
+				list := kvPairs2Providers(latestPairs)
+				for _, p := range list {
+					logger.Debug("got provider", logger.F("app", appKey), logger.F("provider", p.ProviderKey))
 				}
+				//更新服务列表并通知watcher
+				r.update(appKey, list)
 			}
 		}
+		close(stopCh)
 	}
 }
 
-// Register 注册
-func (r *KVRegistry) Register(option registry.RegisterOption, provider ...registry.Provider) {
-	serviceBasePath := constructServiceBasePath(r.ServicePath, option.AppKey)
-	ipv4 := common.LocalIPV4()
-	for _, p := range provider {
-		if p.Addr[0] == ':' {
-			p.Addr = ipv4 + p.Addr
+// notify 通知监听该应用的watcher，在锁外发送，读取慢的watcher不会阻塞Watch和Unwatch
+func (r *KVRegistry) notify(appKey string, list []registry.Provider) {
+	var watchers []*Watcher
+	r.watchersMu.Lock()
+	for _, w := range r.watchers {
+		if w.appKey == appKey {
+			watchers = append(watchers, w)
 		}
-		key := serviceBasePath + p.Network + "@" + p.Addr
-		log.Println("key :"+key)
-		data, _ := json.Marshal(p.Meta)
-		err := r.kv.Put(key, data, nil)
-		if err != nil {
-			log.Printf("libkv register error: %v, provider: %v", err, p)
+	}
+	r.watchersMu.Unlock()
+	for _, w := range watchers {
+		select {
+		case w.event <- &registry.Event{AppKey: appKey, Providers: list}:
+		case <-w.exit:
+		case <-r.done:
 		}
-		//r.providers = append(r.providers, provider...)
-		//注册时更新父级目录触发watch
-		lastUpdate := strconv.Itoa(int(time.Now().Nanosecond()))
-		err = r.kv.Put(serviceBasePath, []byte(lastUpdate), nil)
-		if err != nil {
-			log.Printf("libkv register modify lastupdate error: %v, provider: %v", err, p)
+	}
+}
+
+// Close 停止后台的拉取和监听并断开注册中心的连接，所有watcher都会停止
+func (r *KVRegistry) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+		r.watchersMu.Lock()
+		for _, w := range r.watchers {
+			w.Close()
 		}
+		r.watchers = nil
+		r.watchersMu.Unlock()
+		if kv := r.store(); kv != nil {
+			kv.Close()
+		}
+	})
+}
+
+func (r *KVRegistry) closed() bool {
+	select {
+	case <-r.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// sleep 等待d，Close时提前返回
+func (r *KVRegistry) sleep(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-r.done:
 	}
 }
 
-// Unregister 卸载
+// Register 注册，还没有连接上注册中心或者写入失败时先记录下来，之后定时重试
+func (r *KVRegistry) Register(option registry.RegisterOption, provider ...registry.Provider) {
+	r.pendingMu.Lock()
+	defer r.pendingMu.Unlock()
+	providers, ok := r.pending[option.AppKey]
+	if !ok {
+		providers = make(map[string]registry.Provider)
+		r.pending[option.AppKey] = providers
+	}
+	for _, p := range provider {
+		providers[p.ProviderKey] = p
+	}
+	kv := r.store()
+	if kv == nil {
+		logger.Warn("registry is not connected, providers will be registered after connecting", logger.F("providers", len(provider)))
+		return
+	}
+	r.flushPending(kv)
+}
+
+// put 将提供者写入注册中心
+func (r *KVRegistry) put(kv store.Store, appKey string, p registry.Provider) error {
+	serviceBasePath := constructServiceBasePath(r.ServicePath, appKey)
+	if p.Addr[0] == ':' {
+		p.Addr = common.LocalIPV4() + p.Addr
+	}
+	key := serviceBasePath + p.Network + "@" + p.Addr
+	data, _ := json.Marshal(p.Meta)
+	err := kv.Put(key, data, nil)
+	if err != nil {
+		logger.Error("libkv register error", logger.F("provider", p.ProviderKey), logger.Err(err))
+		return err
+	}
+	//注册时更新父级目录触发watch
+	lastUpdate := strconv.Itoa(int(time.Now().Nanosecond()))
+	err = kv.Put(serviceBasePath, []byte(lastUpdate), nil)
+	if err != nil {
+		logger.Warn("libkv modify lastupdate error", logger.F("provider", p.ProviderKey), logger.Err(err))
+	}
+	return nil
+}
+
+// Unregister 卸载，同时从待注册的提供者中删除，还没有连接上注册中心时只从待注册的提供者中删除
 func (r *KVRegistry) Unregister(option registry.RegisterOption, provider ...registry.Provider) {
+	r.pendingMu.Lock()
+	for _, p := range provider {
+		delete(r.pending[option.AppKey], p.ProviderKey)
+	}
+	kv := r.store()
+	r.pendingMu.Unlock()
+	if kv == nil {
+		return
+	}
 	serviceBasePath := constructServiceBasePath(r.ServicePath, option.AppKey)
 	ipv4 := common.LocalIPV4()
 	for _, p := range provider {
@@ -255,22 +580,25 @@ func (r *KVRegistry) Unregister(option registry.RegisterOption, provider ...regi
 			p.Addr = ipv4 + p.Addr
 		}
 		key := serviceBasePath + p.Network + "@" + p.Addr
-		err := r.kv.Delete(key)
+		err := kv.Delete(key)
 		if err != nil {
-			log.Printf("libkv unregister error: %v, provider: %v", err, p)
+			logger.Error("libkv unregister error", logger.F("provider", p.ProviderKey), logger.Err(err))
 		}
 
 		//注销时更新父级目录触发watch
 		lastUpdate := strconv.Itoa(int(time.Now().UnixNano()))
-		err = r.kv.Put(serviceBasePath, []byte(lastUpdate), nil)
+		err = kv.Put(serviceBasePath, []byte(lastUpdate), nil)
 		if err != nil {
-			log.Printf("libkv register modify lastupdate error: %v, provider: %v", err, p)
+			logger.Warn("libkv modify lastupdate error", logger.F("provider", p.ProviderKey), logger.Err(err))
 		}
 	}
 }
 
-func (r *KVRegistry) Watch() registry.Watcher {
-	w := &Watcher{event: make(chan *registry.Event, 10), exit: make(chan struct{}, 10)}
+// Watch 监听指定应用的服务列表变化
+func (r *KVRegistry) Watch(appKey string) registry.Watcher {
+	appKey = r.appKey(appKey)
+	r.track(appKey)
+	w := &Watcher{appKey: appKey, event: make(chan *registry.Event, 10), exit: make(chan struct{}, 10)}
 	r.watchersMu.Lock()
 	r.watchers = append(r.watchers, w)
 	r.watchersMu.Unlock()
@@ -0,0 +1,139 @@
+package kvregistry
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/docker/libkv/store"
+	"github.com/lincx-911/lincxrpc/registry"
+)
+
+// flakyStore 可以让写入失败的kv存储，只实现注册用到的方法
+type flakyStore struct {
+	store.Store
+	mu      sync.Mutex
+	failing bool
+	values  map[string][]byte
+}
+
+func (s *flakyStore) Put(key string, value []byte, options *store.WriteOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.failing {
+		return errors.New("registry unavailable")
+	}
+	s.values[key] = value
+	return nil
+}
+
+func (s *flakyStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.values, key)
+	return nil
+}
+
+func (s *flakyStore) has(key string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.values[key]
+	return ok
+}
+
+func (s *flakyStore) setFailing(failing bool) {
+	s.mu.Lock()
+	s.failing = failing
+	s.mu.Unlock()
+}
+
+func newTestRegistry(kv store.Store) *KVRegistry {
+	return &KVRegistry{
+		ServicePath: "lincxrpc",
+		kv:          kv,
+		pending:     make(map[string]map[string]registry.Provider),
+		done:        make(chan struct{}),
+	}
+}
+
+func TestRegisterKeepsProvidersUntilPutSucceeds(t *testing.T) {
+	kv := &flakyStore{failing: true, values: make(map[string][]byte)}
+	r := newTestRegistry(kv)
+	option := registry.RegisterOption{AppKey: "app"}
+	a := registry.Provider{ProviderKey: "tcp@127.0.0.1:1", Network: "tcp", Addr: "127.0.0.1:1"}
+	b := registry.Provider{ProviderKey: "tcp@127.0.0.1:2", Network: "tcp", Addr: "127.0.0.1:2"}
+
+	r.Register(option, a, b)
+	if n := len(r.pending["app"]); n != 2 {
+		t.Fatalf("pending = %d, want 2", n)
+	}
+
+	// 注册中心恢复后重试
+	kv.setFailing(false)
+	r.pendingMu.Lock()
+	r.flushPending(kv)
+	r.pendingMu.Unlock()
+	if len(r.pending) != 0 {
+		t.Fatalf("pending = %v, want empty", r.pending)
+	}
+	for _, p := range []registry.Provider{a, b} {
+		if !kv.has("lincxrpc/app/" + p.ProviderKey) {
+			t.Fatalf("%s not registered", p.ProviderKey)
+		}
+	}
+}
+
+func TestUnregisterDropsPendingProviders(t *testing.T) {
+	kv := &flakyStore{failing: true, values: make(map[string][]byte)}
+	r := newTestRegistry(kv)
+	option := registry.RegisterOption{AppKey: "app"}
+	a := registry.Provider{ProviderKey: "tcp@127.0.0.1:1", Network: "tcp", Addr: "127.0.0.1:1"}
+
+	r.Register(option, a)
+	r.Unregister(option, a)
+	kv.setFailing(false)
+	r.pendingMu.Lock()
+	r.flushPending(kv)
+	r.pendingMu.Unlock()
+	if kv.has("lincxrpc/app/" + a.ProviderKey) {
+		t.Fatal("unregistered provider was written after the registry recovered")
+	}
+}
+
+func TestConnectFailsWhenBasePathCannotBeCreated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kvregistry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	r := newTestRegistry(nil)
+	a := registry.Provider{ProviderKey: "tcp@127.0.0.1:1", Network: "tcp", Addr: "127.0.0.1:1"}
+	r.Register(registry.RegisterOption{AppKey: "app"}, a)
+
+	// boltdb在第一次读写时才打开文件，和consul、zk一样NewStore会成功，之后写入基本路径失败
+	unavailable := Option{Backend: BOLTDB, Addrs: []string{dir}, Config: &store.Config{Bucket: "lincxrpc"}}
+	if r.connect(unavailable) {
+		t.Fatal("connect succeeded while the base path can not be written")
+	}
+	if r.store() != nil {
+		t.Fatal("store set after failed connect")
+	}
+	if len(r.pending["app"]) != 1 {
+		t.Fatalf("pending = %v, want the provider kept", r.pending)
+	}
+
+	available := Option{Backend: BOLTDB, Addrs: []string{filepath.Join(dir, "registry.db")}, Config: &store.Config{Bucket: "lincxrpc"}}
+	if !r.connect(available) {
+		t.Fatal("connect failed")
+	}
+	defer r.store().Close()
+	if len(r.pending) != 0 {
+		t.Fatalf("pending = %v, want empty after connecting", r.pending)
+	}
+	if ok, err := r.store().Exists("lincxrpc/app/" + a.ProviderKey); err != nil || !ok {
+		t.Fatalf("provider not registered after connecting: %v, %v", ok, err)
+	}
+}
@@ -0,0 +1,56 @@
+package kvregistry
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/registry"
+)
+
+// snapshot 服务列表快照，注册中心不可用时用来恢复服务列表
+type snapshot struct {
+	UpdatedAt time.Time                      `json:"updated_at"`
+	Apps      map[string][]registry.Provider `json:"apps"` //appKey -> providers
+}
+
+// loadSnapshot 读取快照文件
+func loadSnapshot(path string) (*snapshot, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	snap := &snapshot{}
+	if err = json.Unmarshal(data, snap); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// writeSnapshot 写入快照文件，先写临时文件再重命名，避免写到一半的文件被读取
+func writeSnapshot(path string, snap *snapshot) error {
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
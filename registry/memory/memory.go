@@ -15,61 +15,72 @@ var (
 
 // Registry 注册中心
 type Registry struct {
+	AppKey string //默认应用，GetServiceList/Watch传入的appKey为空时使用
+
 	mu        sync.RWMutex
-	providers []registry.Provider
+	providers map[string][]registry.Provider //appKey -> providers
 	watchers  map[string]*Watcher
 }
 
 // Watcher 监听器
 type Watcher struct {
-	id   string
-	res  chan *registry.Event
-	exit chan bool
+	id     string
+	appKey string //监听的应用
+	res    chan *registry.Event
+	exit   chan bool
 }
 
 func (r *Registry) Register(option registry.RegisterOption, providers ...registry.Provider) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	go r.sendWatcherEvent(option.AppKey, providers...)
-	var providers2Register []registry.Provider
-
+	if r.providers == nil {
+		r.providers = make(map[string][]registry.Provider)
+	}
+	// 已经存在的提供者更新元数据，比如下线前标记为draining
 	for _, p := range providers {
 		exist := false
-		
-		for _, cp := range r.providers {
+		for i, cp := range r.providers[option.AppKey] {
 			if cp.ProviderKey == p.ProviderKey {
+				r.providers[option.AppKey][i] = p
 				exist = true
 				break
 			}
 		}
 		if !exist {
-			providers2Register = append(providers2Register, p)
+			r.providers[option.AppKey] = append(r.providers[option.AppKey], p)
 		}
 	}
-	r.providers = append(r.providers, providers2Register...)
+	go r.sendWatcherEvent(option.AppKey)
 }
 
-func (r *Registry) sendWatcherEvent(AppKey string, providers ...registry.Provider) {
-	var watchers []*Watcher
-	event := &registry.Event{
-		AppKey:    AppKey,
-		Providers: providers,
+// sendWatcherEvent 将应用最新的服务列表通知给监听该应用的watcher
+func (r *Registry) sendWatcherEvent(appKey string) {
+	type watcherEvent struct {
+		w     *Watcher
+		event *registry.Event
 	}
+	var events []watcherEvent
 	r.mu.RLock()
 	for _, w := range r.watchers {
-		watchers = append(watchers, w)
+		if w.appKey != appKey {
+			continue
+		}
+		events = append(events, watcherEvent{w: w, event: &registry.Event{
+			AppKey:    w.appKey,
+			Providers: r.list(w.appKey),
+		}})
 	}
 	r.mu.RUnlock()
 
-	for _, w := range watchers {
+	for _, we := range events {
 		select {
-		case <-w.exit:
+		case <-we.w.exit:
 			r.mu.Lock()
-			delete(r.watchers, w.id)
+			delete(r.watchers, we.w.id)
 			r.mu.Unlock()
 		default:
 			select {
-			case w.res <- event:
+			case we.w.res <- we.event:
 			case <-time.After(timeout):
 			}
 		}
@@ -79,30 +90,49 @@ func (r *Registry) sendWatcherEvent(AppKey string, providers ...registry.Provide
 func (r *Registry) Unregister(option registry.RegisterOption, providers ...registry.Provider) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
-	go r.sendWatcherEvent(option.AppKey, providers...)
+	if _, ok := r.providers[option.AppKey]; !ok {
+		return
+	}
 	var newList []registry.Provider
-	for _, p := range r.providers {
+	for _, p := range r.providers[option.AppKey] {
 		remain := true
 		for _, up := range providers {
-			if p.ProviderKey != up.ProviderKey {
+			if p.ProviderKey == up.ProviderKey {
 				remain = false
+				break
 			}
 		}
 		if remain {
 			newList = append(newList, p)
 		}
 	}
-	r.providers = newList
+	r.providers[option.AppKey] = newList
+	go r.sendWatcherEvent(option.AppKey)
 }
 
-func (r *Registry) GetServiceList() []registry.Provider {
+// GetServiceList 获取指定应用的服务列表，appKey为空时使用默认应用
+func (r *Registry) GetServiceList(appKey string) []registry.Provider {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	return r.providers
+	return r.list(r.appKey(appKey))
+}
+
+// appKey 未指定应用时使用默认应用
+func (r *Registry) appKey(appKey string) string {
+	if appKey == "" {
+		return r.AppKey
+	}
+	return appKey
+}
+
+// list 返回服务列表的拷贝，调用方需持有锁
+func (r *Registry) list(appKey string) []registry.Provider {
+	var providers []registry.Provider
+	return append(providers, r.providers[appKey]...)
 }
 
-func (r *Registry) Watch() registry.Watcher {
+func (r *Registry) Watch(appKey string) registry.Watcher {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
@@ -114,9 +144,10 @@ func (r *Registry) Watch() registry.Watcher {
 	id := uuid.New().String()
 
 	w := &Watcher{
-		id:   id,
-		res:  event,
-		exit: exit,
+		id:     id,
+		appKey: r.appKey(appKey),
+		res:    event,
+		exit:   exit,
 	}
 
 	r.watchers[id] = w
@@ -129,14 +160,9 @@ func (r *Registry) Unwatch(watcher registry.Watcher) {
 	}
 
 	r.mu.Lock()
-	defer r.mu.Lock()
+	defer r.mu.Unlock()
 
-	var newWatcherList []registry.Watcher
-	for _, w := range r.watchers {
-		if w.id != target.id {
-			newWatcherList = append(newWatcherList, w)
-		}
-	}
+	delete(r.watchers, target.id)
 }
 func (m *Watcher) Next() (*registry.Event, error) {
 	for {
@@ -162,3 +188,8 @@ func NewInMemoryRegistry() registry.Registry {
 	r := &Registry{}
 	return r
 }
+
+// NewInMemoryRegistryWithAppKey 创建指定了默认应用的注册中心
+func NewInMemoryRegistryWithAppKey(appKey string) registry.Registry {
+	return &Registry{AppKey: appKey}
+}
@@ -1,5 +1,7 @@
 package registry
 
+import "sync"
+
 type EventAction byte
 
 const (
@@ -10,10 +12,10 @@ const (
 
 // Registry 注册中心 Registry包含两部分功能：服务注册（用于服务端）和服务发现（用于客户端）
 type Registry interface {
-	Register(option RegisterOption, provider ...Provider)   //注册
+	Register(option RegisterOption, provider ...Provider)   //注册，已经注册的提供者会更新元数据
 	Unregister(option RegisterOption, provider ...Provider) //注销
-	GetServiceList() []Provider                             //获取服务列表
-	Watch() Watcher                                         //监听服务列表的变化
+	GetServiceList(appKey string) []Provider                //获取指定应用的服务列表，appKey为空时使用注册中心的默认应用
+	Watch(appKey string) Watcher                            //监听指定应用服务列表的变化
 	Unwatch(watcher Watcher)                                //取消监听
 }
 
@@ -40,23 +42,35 @@ type Provider struct {
 	Meta        map[string]interface{}
 }
 
+// Peer2PeerDiscovery 点对点直连，不依赖注册中心
+// 未指定应用的提供者对所有应用可用
 type Peer2PeerDiscovery struct {
-	providers []Provider
+	mu        sync.RWMutex
+	providers map[string][]Provider //appKey -> providers
 }
 
 func (p *Peer2PeerDiscovery) Register(option RegisterOption, providers ...Provider) {
-	p.providers = providers
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.providers[option.AppKey] = providers
 }
 
 func (p *Peer2PeerDiscovery) Unregister(option RegisterOption, provider ...Provider) {
-	p.providers = []Provider{}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.providers, option.AppKey)
 }
 
-func (p *Peer2PeerDiscovery) GetServiceList() []Provider {
-	return p.providers
+func (p *Peer2PeerDiscovery) GetServiceList(appKey string) []Provider {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if providers, ok := p.providers[appKey]; ok {
+		return providers
+	}
+	return p.providers[""]
 }
 
-func (p *Peer2PeerDiscovery) Watch() Watcher {
+func (p *Peer2PeerDiscovery) Watch(appKey string) Watcher {
 	return nil
 }
 
@@ -65,16 +79,22 @@ func (p *Peer2PeerDiscovery) Unwatch(watcher Watcher) {
 }
 
 func (p *Peer2PeerDiscovery) WithProvider(provider Provider) *Peer2PeerDiscovery {
-	p.providers = append(p.providers, provider)
-	return p
+	return p.WithAppProviders("", []Provider{provider})
 }
 
 func (p *Peer2PeerDiscovery) WithProviders(providers []Provider) *Peer2PeerDiscovery {
-	p.providers = append(p.providers, providers...)
+	return p.WithAppProviders("", providers)
+}
+
+// WithAppProviders 添加指定应用的提供者
+func (p *Peer2PeerDiscovery) WithAppProviders(appKey string, providers []Provider) *Peer2PeerDiscovery {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.providers[appKey] = append(p.providers[appKey], providers...)
 	return p
 }
 
 func NewPeer2PeerRegistry() *Peer2PeerDiscovery {
-	r := &Peer2PeerDiscovery{}
+	r := &Peer2PeerDiscovery{providers: make(map[string][]Provider)}
 	return r
 }
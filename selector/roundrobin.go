@@ -0,0 +1,67 @@
+package selector
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/registry"
+)
+
+// RoundRobinSelector 平滑加权轮询，权重见EffectiveWeight，权重都相同时等价于普通轮询
+// 每次选择时所有提供者的当前值加上各自的权重，选择当前值最大的提供者并减去总权重，
+// 权重大的提供者被选中的次数更多，同时不会被连续选中
+type RoundRobinSelector struct {
+	mu      sync.Mutex
+	current map[string]int //providerKey -> 当前值
+}
+
+// NewRoundRobinSelector 创建平滑加权轮询的负载均衡器，每个客户端使用单独的实例
+func NewRoundRobinSelector() Selector {
+	return &RoundRobinSelector{current: make(map[string]int)}
+}
+
+func (s *RoundRobinSelector) Next(ctx context.Context, providers []registry.Provider, ServiceMethod string, arg interface{}, opt SelectOption) (rp registry.Provider, err error) {
+	filters := combineFilter(opt.Filters)
+	list := make([]registry.Provider, 0)
+	for _, p := range providers {
+		if filters(ctx, p, ServiceMethod, arg) {
+			list = append(list, p)
+		}
+	}
+	if len(list) == 0 {
+		err = ErrEmptyProviderList
+		return
+	}
+	now := time.Now()
+	weights := make([]int, len(list))
+	for i, p := range list {
+		weights[i] = EffectiveWeight(p, now)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.current) > len(list) {
+		// 清理已经不在列表中的提供者
+		keys := make(map[string]struct{}, len(list))
+		for _, p := range list {
+			keys[p.ProviderKey] = struct{}{}
+		}
+		for key := range s.current {
+			if _, ok := keys[key]; !ok {
+				delete(s.current, key)
+			}
+		}
+	}
+	total, best := 0, -1
+	for i, p := range list {
+		s.current[p.ProviderKey] += weights[i]
+		total += weights[i]
+		if best < 0 || s.current[p.ProviderKey] > s.current[list[best].ProviderKey] {
+			best = i
+		}
+	}
+	s.current[list[best].ProviderKey] -= total
+	rp = list[best]
+	return
+}
@@ -0,0 +1,77 @@
+package selector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/common/metadata"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/registry"
+)
+
+func TestRoundRobinSelectorWeights(t *testing.T) {
+	providers := []registry.Provider{
+		{ProviderKey: "a", Meta: map[string]interface{}{protocol.ProviderWeightKey: 3}},
+		{ProviderKey: "b", Meta: map[string]interface{}{protocol.ProviderWeightKey: 1}},
+	}
+	s := NewRoundRobinSelector()
+	counts := make(map[string]int)
+	var seq []string
+	for i := 0; i < 8; i++ {
+		p, err := s.Next(context.Background(), providers, "Arith.Add", nil, SelectOption{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		counts[p.ProviderKey]++
+		seq = append(seq, p.ProviderKey)
+	}
+	if counts["a"] != 6 || counts["b"] != 2 {
+		t.Fatalf("counts = %v, want a:6 b:2", counts)
+	}
+	// 平滑轮询不会把一个周期内的请求集中在同一个提供者上
+	for i := 0; i+3 < len(seq); i++ {
+		if seq[i] == seq[i+1] && seq[i] == seq[i+2] && seq[i] == seq[i+3] {
+			t.Fatalf("sequence %v is not smooth", seq)
+		}
+	}
+}
+
+func TestRoundRobinSelectorEmpty(t *testing.T) {
+	s := NewRoundRobinSelector()
+	if _, err := s.Next(context.Background(), nil, "Arith.Add", nil, SelectOption{}); err != ErrEmptyProviderList {
+		t.Fatalf("err = %v, want ErrEmptyProviderList", err)
+	}
+}
+
+func TestLocalizeWarmUp(t *testing.T) {
+	now := time.Unix(1000, 0)
+	providers := []registry.Provider{
+		{ProviderKey: "a", Meta: map[string]interface{}{protocol.ProviderWarmUpAge: int64(2000), protocol.ProviderWarmUpKey: int64(10000)}},
+		{ProviderKey: "b"},
+	}
+	localized := LocalizeWarmUp(providers, nil, now)
+	if _, ok := providers[0].Meta[protocol.ProviderWarmUpStart]; ok {
+		t.Fatal("input meta was modified")
+	}
+	start, _ := metadata.ToInt(localized[0].Meta[protocol.ProviderWarmUpStart])
+	if want := now.UnixNano()/int64(time.Millisecond) - 2000; start != want {
+		t.Fatalf("start = %d, want %d", start, want)
+	}
+	if w := EffectiveWeight(localized[0], now); w != DefaultWeight/5 {
+		t.Fatalf("weight = %d, want %d", w, DefaultWeight/5)
+	}
+
+	// 注册中心再次推送同样的提供者时沿用之前的开始时间
+	later := now.Add(5 * time.Second)
+	again := LocalizeWarmUp(providers, localized, later)
+	if s, _ := metadata.ToInt(again[0].Meta[protocol.ProviderWarmUpStart]); s != start {
+		t.Fatalf("start = %d, want %d", s, start)
+	}
+	if w := EffectiveWeight(again[0], later); w != DefaultWeight*7/10 {
+		t.Fatalf("weight = %d, want %d", w, DefaultWeight*7/10)
+	}
+	if EffectiveWeight(again[1], later) != DefaultWeight {
+		t.Fatal("provider without warm-up should use the default weight")
+	}
+}
@@ -31,13 +31,15 @@ type Selector interface {
 	Next(ctx context.Context, providers []registry.Provider, ServiceMethod string, arg interface{}, opt SelectOption) (rp registry.Provider, err error)
 }
 
-// RandomSelector 随机负载均衡
+// RandomSelector 按权重随机负载均衡，权重见EffectiveWeight
 type RandomSelector struct {
 }
 
 var RandomSelectorInstance = RandomSelector{}
 
-// DegradeProviderFilter 降级
+// DegradeProviderFilter 降级，过滤掉元数据中带有ProviderDegradeKey的提供者
+//
+// Deprecated: 框架不再写入ProviderDegradeKey，客户端按照心跳和健康检查的结果过滤，见HealthyProviderFilter
 func DegradeProviderFilter() Filter {
 	return func(ctx context.Context, provider registry.Provider, serviceMethod string, arg interface{}) bool {
 		_, degrade := provider.Meta[protocol.ProviderDegradeKey]
@@ -45,6 +47,18 @@ func DegradeProviderFilter() Filter {
 	}
 }
 
+// HealthChecker 提供者的健康状态，与注册中心的元数据分开维护
+type HealthChecker interface {
+	Healthy(providerKey string) bool
+}
+
+// HealthyProviderFilter 过滤掉健康检查不通过的提供者
+func HealthyProviderFilter(checker HealthChecker) Filter {
+	return func(ctx context.Context, provider registry.Provider, serviceMethod string, arg interface{}) bool {
+		return checker.Healthy(provider.ProviderKey)
+	}
+}
+
 // TaggedProviderFilter 基于tags进行过滤
 func TaggedProviderFilter(tags map[string]string) Filter {
 	return func(ctx context.Context, provider registry.Provider, ServiceMethod string, arg interface{}) bool {
@@ -85,8 +99,7 @@ func (RandomSelector) Next(ctx context.Context, providers []registry.Provider, S
 		err = ErrEmptyProviderList
 		return
 	}
-	idx := rand.Intn(len(list))
-	rp = list[idx]
+	rp = weightedRandom(list)
 	return
 }
 
@@ -125,7 +138,7 @@ func NewRandomSelector() Selector {
 	return RandomSelectorInstance
 }
 
-// HashSelector 一致哈希
+// HashSelector 一致哈希，不使用权重和预热
 type HashSelector struct {
 	//排序的hash虚拟结点
 	hashSortedNodes []uint32
@@ -0,0 +1,125 @@
+package selector
+
+import (
+	"context"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/common/metadata"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/registry"
+)
+
+// DefaultWeight 没有设置权重的提供者的权重
+const DefaultWeight = 100
+
+// DrainingProviderFilter 过滤掉在注册中心标记为draining的提供者，这些提供者正在下线
+func DrainingProviderFilter() Filter {
+	return func(ctx context.Context, provider registry.Provider, serviceMethod string, arg interface{}) bool {
+		return !IsDraining(provider)
+	}
+}
+
+// IsDraining 提供者是否正在下线
+func IsDraining(provider registry.Provider) bool {
+	switch v := provider.Meta[protocol.ProviderDrainingKey].(type) {
+	case bool:
+		return v
+	case string:
+		draining, _ := strconv.ParseBool(v)
+		return draining
+	}
+	return false
+}
+
+// EffectiveWeight 提供者当前的权重
+// 在预热期间权重按照启动后经过的时间线性增加，最小为1
+// 预热开始时间是客户端的时钟，由LocalizeWarmUp根据提供者上报的预热已进行时间换算
+func EffectiveWeight(provider registry.Provider, now time.Time) int {
+	weight := DefaultWeight
+	if w, ok := metadata.ToInt(provider.Meta[protocol.ProviderWeightKey]); ok && w > 0 {
+		weight = int(w)
+	}
+	start, ok1 := metadata.ToInt(provider.Meta[protocol.ProviderWarmUpStart])
+	warmUp, ok2 := metadata.ToInt(provider.Meta[protocol.ProviderWarmUpKey])
+	if !ok1 || !ok2 || warmUp <= 0 {
+		return weight
+	}
+	elapsed := now.UnixNano()/int64(time.Millisecond) - start
+	if elapsed >= warmUp {
+		return weight
+	}
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	w := int(int64(weight) * elapsed / warmUp)
+	if w < 1 {
+		w = 1
+	}
+	return w
+}
+
+// LocalizeWarmUp 根据提供者上报的预热已进行时间(ProviderWarmUpAge)换算出本地时钟的预热开始时间(ProviderWarmUpStart)
+// previous为之前的服务列表，已经换算过并且上报的时间没有变化的提供者沿用之前的开始时间，
+// 避免注册中心每次推送都重新开始预热。需要换算的提供者会拷贝Meta，不会修改传入的列表
+func LocalizeWarmUp(providers []registry.Provider, previous []registry.Provider, now time.Time) []registry.Provider {
+	var res []registry.Provider
+	for i, p := range providers {
+		age, ok := metadata.ToInt(p.Meta[protocol.ProviderWarmUpAge])
+		if !ok {
+			continue
+		}
+		start := now.UnixNano()/int64(time.Millisecond) - age
+		for _, prev := range previous {
+			if prev.ProviderKey != p.ProviderKey {
+				continue
+			}
+			prevAge, ok1 := metadata.ToInt(prev.Meta[protocol.ProviderWarmUpAge])
+			prevStart, ok2 := metadata.ToInt(prev.Meta[protocol.ProviderWarmUpStart])
+			if ok1 && ok2 && prevAge == age {
+				start = prevStart
+			}
+			break
+		}
+		if res == nil {
+			res = append([]registry.Provider(nil), providers...)
+		}
+		meta := make(map[string]interface{}, len(p.Meta)+1)
+		for k, v := range p.Meta {
+			meta[k] = v
+		}
+		meta[protocol.ProviderWarmUpStart] = start
+		res[i].Meta = meta
+	}
+	if res == nil {
+		return providers
+	}
+	return res
+}
+
+// weightedRandom 按照权重随机选择，权重都相同时等价于均匀随机
+func weightedRandom(list []registry.Provider) registry.Provider {
+	now := time.Now()
+	weights := make([]int, len(list))
+	total := 0
+	same := true
+	for i, p := range list {
+		weights[i] = EffectiveWeight(p, now)
+		total += weights[i]
+		if weights[i] != weights[0] {
+			same = false
+		}
+	}
+	if same {
+		return list[rand.Intn(len(list))]
+	}
+	n := rand.Intn(total)
+	for i, w := range weights {
+		if n < w {
+			return list[i]
+		}
+		n -= w
+	}
+	return list[len(list)-1]
+}
@@ -0,0 +1,83 @@
+package selector
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/registry"
+)
+
+func TestEffectiveWeight(t *testing.T) {
+	now := time.Unix(1000, 0)
+	nowMs := now.UnixNano() / int64(time.Millisecond)
+	warmingUp := func(weight interface{}, elapsedMs int64) map[string]interface{} {
+		meta := map[string]interface{}{
+			protocol.ProviderWarmUpStart: nowMs - elapsedMs,
+			protocol.ProviderWarmUpKey:   int64(10000),
+		}
+		if weight != nil {
+			meta[protocol.ProviderWeightKey] = weight
+		}
+		return meta
+	}
+	tests := []struct {
+		name string
+		meta map[string]interface{}
+		want int
+	}{
+		{"default", nil, DefaultWeight},
+		{"configured", map[string]interface{}{protocol.ProviderWeightKey: int64(40)}, 40},
+		{"configured as string", map[string]interface{}{protocol.ProviderWeightKey: "40"}, 40},
+		{"invalid weight", map[string]interface{}{protocol.ProviderWeightKey: int64(-3)}, DefaultWeight},
+		{"warm-up start", warmingUp(nil, 0), 1},
+		{"warm-up quarter", warmingUp(int8(40), 2500), 10},
+		{"warm-up half", warmingUp(nil, 5000), DefaultWeight / 2},
+		{"warm-up finished", warmingUp(nil, 10000), DefaultWeight},
+		{"warm-up after finished", warmingUp(nil, 60000), DefaultWeight},
+		{"start in the future", warmingUp(nil, -5000), 1},
+		{"minimum weight", warmingUp(int64(5), 1000), 1},
+		{"no warm-up duration", map[string]interface{}{protocol.ProviderWarmUpStart: nowMs}, DefaultWeight},
+		{"zero warm-up duration", map[string]interface{}{protocol.ProviderWarmUpStart: nowMs, protocol.ProviderWarmUpKey: int64(0)}, DefaultWeight},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := EffectiveWeight(registry.Provider{Meta: tt.meta}, now); got != tt.want {
+				t.Fatalf("EffectiveWeight() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDrainingProviderFilter(t *testing.T) {
+	tests := []struct {
+		name     string
+		value    interface{}
+		draining bool
+	}{
+		{"unset", nil, false},
+		{"true", true, true},
+		{"false", false, false},
+		{"string true", "true", true},
+		{"string 1", "1", true},
+		{"string false", "false", false},
+		{"invalid string", "yes", false},
+		{"other type", 1, false},
+	}
+	filter := DrainingProviderFilter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := registry.Provider{ProviderKey: "a", Meta: map[string]interface{}{}}
+			if tt.value != nil {
+				p.Meta[protocol.ProviderDrainingKey] = tt.value
+			}
+			if got := IsDraining(p); got != tt.draining {
+				t.Fatalf("IsDraining() = %v, want %v", got, tt.draining)
+			}
+			if got := filter(context.Background(), p, "Arith.Add", nil); got == tt.draining {
+				t.Fatalf("filter() = %v, want %v", got, !tt.draining)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lincx-911/lincxrpc/codec"
+	"github.com/lincx-911/lincxrpc/common/peer"
+	"github.com/lincx-911/lincxrpc/common/stats"
+	"github.com/lincx-911/lincxrpc/logger"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/status"
+	"github.com/lincx-911/lincxrpc/transport"
+)
+
+// AccessLogOption 访问日志配置项
+type AccessLogOption struct {
+	Logger        logger.Logger // 为空时使用服务端的日志
+	SampleRate    float64       // 成功请求的采样率，小于等于0时记录所有请求，出错和慢请求总是记录
+	SlowThreshold time.Duration // 超过这个耗时的请求以warn级别记录并输出截断的参数，0时不判断
+	MaxArgLength  int           // 慢请求输出参数的最大长度
+}
+
+// DefaultAccessLogOption 默认记录所有请求
+var DefaultAccessLogOption = AccessLogOption{
+	SampleRate:   1,
+	MaxArgLength: 256,
+}
+
+// AccessLogWrapper 每个请求输出一行访问日志
+type AccessLogWrapper struct {
+	defaultServerInterceptor
+	option AccessLogOption
+}
+
+// NewAccessLogWrapper 创建访问日志拦截器
+func NewAccessLogWrapper(option AccessLogOption) *AccessLogWrapper {
+	if option.MaxArgLength <= 0 {
+		option.MaxArgLength = DefaultAccessLogOption.MaxArgLength
+	}
+	if option.SampleRate <= 0 {
+		option.SampleRate = 1
+	}
+	return &AccessLogWrapper{option: option}
+}
+
+func (w *AccessLogWrapper) WrapHandleRequest(s *SGServer, requestFunc HandleRequestFunc) HandleRequestFunc {
+	return func(ctx context.Context, request *protocol.Message, response *protocol.Message, tr transport.Transport) {
+		if request.MessageType == protocol.MessageTypeHeartbeat {
+			requestFunc(ctx, request, response, tr)
+			return
+		}
+		start := time.Now()
+		requestFunc(ctx, request, response, tr)
+		latency := time.Since(start)
+
+		code := protocol.StatusOK
+		err := status.FromMessage(response)
+		if err != nil {
+			code = err.Code
+		}
+		slow := w.option.SlowThreshold > 0 && latency >= w.option.SlowThreshold
+		if err == nil && !slow && rand.Float64() >= w.option.SampleRate {
+			return
+		}
+		l := w.option.Logger
+		if l == nil {
+			l = s.log()
+		}
+		fields := []logger.Field{
+			logger.F("peer", tr.RemoteAddr()),
+			logger.F("service_method", request.ServiceName+"."+request.MethodName),
+			logger.F("seq", request.Seq),
+			logger.F("status", code.String()),
+			logger.F("latency", latency),
+			logger.F("request_bytes", len(request.Data)),
+			logger.F("response_bytes", len(response.Data)),
+			logger.F("principal", principalOf(ctx)),
+		}
+		if err != nil {
+			fields = append(fields, logger.F("error", err.Message))
+		}
+		if slow {
+			fields = append(fields, logger.F("arg", w.formatArg(request)))
+		}
+		switch {
+		case err != nil && !status.IsCallerError(err):
+			l.Error("access", fields...)
+		case err != nil || slow:
+			l.Warn("access", fields...)
+		default:
+			l.Info("access", fields...)
+		}
+	}
+}
+
+// principalOf 鉴权拦截器记录的调用方，没有时使用TLS证书中的身份
+func principalOf(ctx context.Context) string {
+	if principal := stats.ServerFromContext(ctx).Principal(); principal != "" {
+		return principal
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		return p.Identity()
+	}
+	return ""
+}
+
+// formatArg 将请求参数转换为可读的字符串并截断，msgpack的参数解码后输出，其他二进制格式输出十六进制
+func (w *AccessLogWrapper) formatArg(request *protocol.Message) string {
+	var s string
+	switch request.SerializeType {
+	case codec.JsonType:
+		s = string(request.Data)
+	case codec.MessagePackType:
+		var v interface{}
+		if err := codec.GetCodec(codec.MessagePackType).Decode(request.Data, &v); err != nil {
+			s = fmt.Sprintf("%x", request.Data)
+		} else {
+			s = fmt.Sprintf("%+v", v)
+		}
+	default:
+		s = fmt.Sprintf("%x", request.Data)
+	}
+	return truncate(s, w.option.MaxArgLength)
+}
+
+// truncate 截断过长的字符串，截断位置落在多字节字符中间时退回到字符的开始
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	for max > 0 && !utf8.RuneStart(s[max]) {
+		max--
+	}
+	return s[:max] + "...(truncated)"
+}
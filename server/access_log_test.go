@@ -0,0 +1,59 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lincx-911/lincxrpc/common/peer"
+	"github.com/lincx-911/lincxrpc/logger"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/transport"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s    string
+		max  int
+		want string
+	}{
+		{"hello", 10, "hello"},
+		{"hello", 5, "hello"},
+		{"hello", 3, "hel...(truncated)"},
+		// "你"占3个字节，截断位置在字符中间时退回到字符的开始
+		{"a你好", 2, "a...(truncated)"},
+		{"a你好", 4, "a你...(truncated)"},
+		{"你好", 1, "...(truncated)"},
+	}
+	for _, tt := range tests {
+		got := truncate(tt.s, tt.max)
+		if got != tt.want {
+			t.Errorf("truncate(%q, %d) = %q, want %q", tt.s, tt.max, got, tt.want)
+		}
+		if !utf8.ValidString(got) {
+			t.Errorf("truncate(%q, %d) = %q is not valid utf-8", tt.s, tt.max, got)
+		}
+	}
+}
+
+func TestAccessLogZeroSampleRateLogsAll(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewAccessLogWrapper(AccessLogOption{
+		Logger:        logger.NewTextLogger(&buf, logger.InfoLevel),
+		SlowThreshold: time.Hour,
+	})
+	handle := w.WrapHandleRequest(&SGServer{}, func(ctx context.Context, request *protocol.Message, response *protocol.Message, tr transport.Transport) {
+		response.StatusCode = protocol.StatusOK
+	})
+	request := protocol.NewMessage(protocol.Default)
+	request.ServiceName, request.MethodName = "Arith", "Add"
+	for i := 0; i < 3; i++ {
+		handle(context.Background(), request, request.Clone(), &httpTransport{peer: &peer.Peer{}})
+	}
+	if n := strings.Count(buf.String(), "access"); n != 3 {
+		t.Fatalf("logged %d requests, want 3:\n%s", n, buf.String())
+	}
+}
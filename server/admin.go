@@ -0,0 +1,34 @@
+package server
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/lincx-911/lincxrpc/logger"
+	"github.com/lincx-911/lincxrpc/metrics"
+)
+
+var AdminMetricsUrl string = "/metrics" // 管理端口上指标的路由
+
+// StartAdmin 在Option.AdminAddr上启动管理端口，暴露Prometheus指标和健康检查
+func (s *SGServer) StartAdmin() error {
+	ln, err := net.Listen("tcp", s.Option.AdminAddr)
+	if err != nil {
+		s.log().Error("error listening admin", logger.Err(err))
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(AdminMetricsUrl, metrics.Handler(s.Option.MetricsRegistry))
+	mux.HandleFunc(HttpHealthUrl, s.serveHealth)
+	admin := &http.Server{Handler: mux}
+	s.mutex.Lock()
+	s.admin = admin
+	s.mutex.Unlock()
+	s.log().Info("admin http listening", logger.F("addr", ln.Addr()))
+	go func() {
+		if err := admin.Serve(ln); err != nil && err != http.ErrServerClosed {
+			s.log().Error("error serving admin http", logger.Err(err))
+		}
+	}()
+	return nil
+}
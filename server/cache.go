@@ -0,0 +1,99 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/cache"
+	"github.com/lincx-911/lincxrpc/common/stats"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/transport"
+)
+
+// ServiceOption 注册服务时的选项，methods为服务中符合规则的方法
+type ServiceOption func(service string, methods map[string]*methodType) error
+
+// CacheMethod 将只读方法标记为可缓存，成功的响应保留ttl
+// 需要配合服务端的CacheWrapper使用，经过CacheWrapper的成功响应的元数据中会带有rpc_cache_ttl，客户端的CacheWrapper据此缓存
+func CacheMethod(method string, ttl time.Duration) ServiceOption {
+	return func(service string, methods map[string]*methodType) error {
+		mtype, ok := methods[method]
+		if !ok {
+			return fmt.Errorf("rpc: can not find method %s.%s to cache", service, method)
+		}
+		if ttl <= 0 {
+			return fmt.Errorf("rpc: cache ttl of %s.%s must be positive", service, method)
+		}
+		mtype.cacheTTL = ttl
+		return nil
+	}
+}
+
+// CacheWrapper 缓存通过CacheMethod标记的方法的成功响应，键由服务、方法、调用方、序列化方式和请求参数的编码组成
+// 调用方和拦截器的顺序无关，鉴权通过时为调用方名称，否则为凭证的摘要；
+// 配置了AuthWrapper但是请求还没有鉴权时不使用缓存，避免未鉴权的请求读到缓存的响应
+type CacheWrapper struct {
+	defaultServerInterceptor
+	cache *cache.Cache
+}
+
+// NewCacheWrapper 创建响应缓存拦截器，c为空时使用cache.DefaultOption创建
+func NewCacheWrapper(c *cache.Cache) *CacheWrapper {
+	if c == nil {
+		c = cache.New(cache.DefaultOption)
+	}
+	return &CacheWrapper{cache: c}
+}
+
+// Cache 拦截器使用的缓存，可以用于观察命中率
+func (w *CacheWrapper) Cache() *cache.Cache {
+	return w.cache
+}
+
+// Invalidate 删除方法的所有缓存，method为空时删除整个服务的缓存
+func (w *CacheWrapper) Invalidate(service, method string) int {
+	if method == "" {
+		return w.cache.DeletePrefix(service + ".")
+	}
+	return w.cache.DeletePrefix(service + "." + method + "\x00")
+}
+
+// Purge 清空所有缓存
+func (w *CacheWrapper) Purge() {
+	w.cache.Purge()
+}
+
+func (w *CacheWrapper) WrapHandleRequest(s *SGServer, requestFunc HandleRequestFunc) HandleRequestFunc {
+	return func(ctx context.Context, request *protocol.Message, response *protocol.Message, tr transport.Transport) {
+		if request.MessageType != protocol.MessageTypeRequest {
+			requestFunc(ctx, request, response, tr)
+			return
+		}
+		mtype := s.methodOf(request.ServiceName, request.MethodName)
+		if mtype == nil || mtype.cacheTTL <= 0 || s.authPending(ctx, request) {
+			requestFunc(ctx, request, response, tr)
+			return
+		}
+		key := request.ServiceName + "." + request.MethodName + "\x00" + callerKey(ctx, request) + "\x00" +
+			string([]byte{byte(request.SerializeType)}) + string(request.Data)
+		if data, ttl, ok := w.cache.Get(key); ok {
+			response.Data = data
+			meta := make(map[string]interface{}, len(response.MetaData)+1)
+			for k, v := range response.MetaData {
+				meta[k] = v
+			}
+			// 返回剩余的有效时间，客户端缓存的时间不会超过服务端
+			meta[protocol.CacheTTLKey] = int64(ttl)
+			response.MetaData = meta
+			s.writeResponse(ctx, tr, response)
+			return
+		}
+		// 成功的响应中会带上ttl，只有经过CacheWrapper的请求才会告诉客户端可以缓存
+		stats.ServerFromContext(ctx).SetCacheTTL(mtype.cacheTTL)
+		requestFunc(ctx, request, response, tr)
+		if response.StatusCode == protocol.StatusOK {
+			w.cache.Set(key, append([]byte(nil), response.Data...), mtype.cacheTTL)
+		}
+	}
+}
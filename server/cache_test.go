@@ -0,0 +1,70 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/common/metadata"
+	"github.com/lincx-911/lincxrpc/logger"
+	"github.com/lincx-911/lincxrpc/protocol"
+)
+
+// responseCacheTTL 网关响应中的rpc_cache_ttl
+func responseCacheTTL(t *testing.T, w *httptest.ResponseRecorder) (time.Duration, bool) {
+	meta := make(map[string]interface{})
+	if err := json.Unmarshal([]byte(w.Header().Get(HEADER_META_DATA)), &meta); err != nil {
+		t.Fatal(err)
+	}
+	ttl, ok := metadata.Int(meta, protocol.CacheTTLKey)
+	return time.Duration(ttl), ok
+}
+
+func newCacheTestServer(t *testing.T, wrappers ...Wrapper) *SGServer {
+	option := DefaultOption
+	option.Logger = logger.Nop()
+	option.Wrappers = wrappers
+	s := NewRPCServer(option).(*SGServer)
+	if err := s.RegisterName("Arith", gatewayArith{}, CacheMethod("Add", time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestCacheTTLRequiresCacheWrapper(t *testing.T) {
+	s := newCacheTestServer(t)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, gatewayRequest(t, [2]string{"Arith", "Add"}, "", []int{1, 2}))
+	if w.Code != 200 {
+		t.Fatalf("code = %d", w.Code)
+	}
+	if ttl, ok := responseCacheTTL(t, w); ok {
+		t.Fatalf("cache ttl %v advertised without a CacheWrapper", ttl)
+	}
+}
+
+func TestCacheWrapperRemainingTTL(t *testing.T) {
+	cw := NewCacheWrapper(nil)
+	s := newCacheTestServer(t, cw)
+
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, gatewayRequest(t, [2]string{"Arith", "Add"}, "", []int{1, 2}))
+	if ttl, ok := responseCacheTTL(t, w); !ok || ttl != time.Minute {
+		t.Fatalf("miss ttl = %v, %v, want %v", ttl, ok, time.Minute)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	w = httptest.NewRecorder()
+	s.ServeHTTP(w, gatewayRequest(t, [2]string{"Arith", "Add"}, "", []int{1, 2}))
+	if w.Body.String() != "3" {
+		t.Fatalf("body = %q, want 3", w.Body.String())
+	}
+	ttl, ok := responseCacheTTL(t, w)
+	if !ok || ttl >= time.Minute || ttl < time.Minute-time.Second {
+		t.Fatalf("hit ttl = %v, %v, want the remaining lifetime", ttl, ok)
+	}
+	if st := cw.Cache().Stats(); st.Hits != 1 || st.Misses != 1 {
+		t.Fatalf("stats = %+v, want 1 hit and 1 miss", st)
+	}
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/status"
+)
+
+func TestRequestDeadline(t *testing.T) {
+	received := time.Unix(1000, 0)
+	// 客户端时钟比服务端快一个小时，截止时间只作为没有剩余时间时的后备
+	skewed := received.Add(time.Hour)
+	tests := []struct {
+		name string
+		meta map[string]interface{}
+		want time.Time
+		ok   bool
+	}{
+		{"none", nil, time.Time{}, false},
+		{"relative", map[string]interface{}{protocol.RequestTimeoutKey: int64(time.Second)}, received.Add(time.Second), true},
+		{"relative decoded as uint32", map[string]interface{}{protocol.RequestTimeoutKey: uint32(time.Second)}, received.Add(time.Second), true},
+		{"relative wins over deadline", map[string]interface{}{
+			protocol.RequestTimeoutKey:  int64(time.Second),
+			protocol.RequestDeadlineKey: skewed.UnixNano(),
+		}, received.Add(time.Second), true},
+		{"deadline fallback", map[string]interface{}{protocol.RequestDeadlineKey: skewed.UnixNano()}, skewed, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request := protocol.NewMessage(protocol.Default)
+			request.MetaData = tt.meta
+			got, ok := requestDeadline(request, received)
+			if ok != tt.ok || !got.Equal(tt.want) {
+				t.Fatalf("requestDeadline() = %v, %v, want %v, %v", got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAdmit(t *testing.T) {
+	s := &SGServer{Option: Option{MinRequestBudget: 50 * time.Millisecond}}
+	tests := []struct {
+		name      string
+		remaining time.Duration
+		admitted  bool
+	}{
+		{"expired", -time.Second, false},
+		{"below budget", 10 * time.Millisecond, false},
+		{"enough budget", time.Second, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := s.admit(time.Now().Add(tt.remaining))
+			if tt.admitted {
+				if err != nil {
+					t.Fatalf("admit() = %v", err)
+				}
+				return
+			}
+			if status.Code(err) != protocol.StatusDeadlineExceeded {
+				t.Fatalf("admit() = %v, want DeadlineExceeded", err)
+			}
+		})
+	}
+
+	// 没有设置MinRequestBudget时只拒绝已经过期的请求
+	s.Option.MinRequestBudget = 0
+	if err := s.admit(time.Now().Add(time.Millisecond)); err != nil {
+		t.Fatalf("admit() = %v without a budget", err)
+	}
+}
@@ -1,20 +1,28 @@
 package server
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
 	"encoding/json"
+	"errors"
+	"io"
 	"io/ioutil"
-	"log"
 	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/lincx-911/lincxrpc/codec"
-	"github.com/lincx-911/lincxrpc/common/metadata"
+	"github.com/lincx-911/lincxrpc/common/peer"
+	"github.com/lincx-911/lincxrpc/health"
+	"github.com/lincx-911/lincxrpc/logger"
 	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/reflection"
+	"github.com/lincx-911/lincxrpc/status"
+	"github.com/lincx-911/lincxrpc/transport"
 )
 
 const (
@@ -26,12 +34,15 @@ const (
 	HEADER_SERVICE_NAME   = "rpc-header-service_name"   //服务名
 	HEADER_METHOD_NAME    = "rpc-header-method_name"    //方法名
 	HEADER_ERROR          = "rpc-header-error"          //方法调用发生的异常
+	HEADER_ERROR_DETAILS  = "rpc-header-error_details"  //异常的详细信息，json格式
 	HEADER_META_DATA      = "rpc-header-meta_data"      //其他元数据
 
 )
 
 var(
 	HttpSeverUrl string = "/lincxrpc/invoke" // http服务的路由,
+	HttpHealthUrl string = "/lincxrpc/health" // 健康检查的路由
+	HttpReflectionUrl string = "/lincxrpc/reflection" // 反射服务的路由
 	HttpPort int = 5080 // http服务监听的端口号
 )
 
@@ -43,18 +54,41 @@ func (s *SGServer) StartGateway() {
 		ln, err = net.Listen("tcp", ":"+strconv.Itoa(port))
 	}
 	if err != nil {
-		log.Printf("error listening gateway: %s", err.Error())
+		s.log().Error("error listening gateway", logger.Err(err))
 		return
 	}
-	log.Printf("gateway http listenning on " + strconv.Itoa(port))
+	s.log().Info("gateway http listening", logger.F("port", port))
+	gateway := &http.Server{Handler: s}
+	s.addGateway(gateway)
 	go func() {
-		err := http.Serve(ln, s)
-		if err != nil {
-			log.Printf("error serving http %s", err.Error())
+		err := gateway.Serve(ln)
+		if err != nil && err != http.ErrServerClosed {
+			s.log().Error("error serving http", logger.Err(err))
 		}
 	}()
 	go s.StartHttps()
 }
+
+// addGateway 记录网关，Shutdown时关闭
+func (s *SGServer) addGateway(gateway *http.Server) {
+	s.mutex.Lock()
+	s.gateways = append(s.gateways, gateway)
+	s.mutex.Unlock()
+}
+
+// shutdownGateways 停止接受网关的请求并等待处理中的请求完成，ctx结束时直接关闭
+func (s *SGServer) shutdownGateways(ctx context.Context) {
+	s.mutex.Lock()
+	gateways := append([]*http.Server(nil), s.gateways...)
+	s.mutex.Unlock()
+	for _, gateway := range gateways {
+		if err := gateway.Shutdown(ctx); err != nil {
+			s.log().Warn("shutdown gateway error", logger.Err(err))
+			_ = gateway.Close()
+		}
+	}
+}
+
 // StartHttps 启动https
 func (s *SGServer)StartHttps(){
 	if !s.Option.HttpsConf.On{
@@ -64,7 +98,7 @@ func (s *SGServer)StartHttps(){
 	pool := x509.NewCertPool()
 	caCrt,err:=ioutil.ReadFile(caCerPath)
 	if err!=nil{
-		log.Printf("error serving https %s",err.Error())
+		s.log().Error("error serving https", logger.Err(err))
 		return
 	}
 	pool.AppendCertsFromPEM(caCrt)
@@ -79,15 +113,24 @@ func (s *SGServer)StartHttps(){
 	}
 	svrcrtPath := s.Option.HttpsConf.ServerCrtPath
 	svrkeyPath := s.Option.HttpsConf.ServerKeyPath
-	if err = server.ListenAndServeTLS(svrcrtPath,svrkeyPath);err!=nil{
-		log.Printf("error serving https ListenAndServeTLS %v",err)
+	s.addGateway(server)
+	if err = server.ListenAndServeTLS(svrcrtPath,svrkeyPath);err!=nil && err != http.ErrServerClosed{
+		s.log().Error("error serving https", logger.Err(err))
 		return
 	}
-	log.Printf("https server listening on %d",port)
+	s.log().Info("https server stopped", logger.F("port", port))
 }
 
 // ServeHTTP 处理请求
 func (s *SGServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == HttpHealthUrl {
+		s.serveHealth(w, r)
+		return
+	}
+	if r.URL.Path == HttpReflectionUrl && !s.Option.DisableReflection {
+		s.serveReflection(w, r)
+		return
+	}
 	if r.URL.Path != HttpSeverUrl {
 		w.WriteHeader(404)
 		return
@@ -97,6 +140,7 @@ func (s *SGServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(405)
 		return
 	}
+	received := time.Now()
 	request := protocol.NewMessage(s.Option.ProtocolType)
 	request, err := parseHeader(request, r)
 	if err != nil {
@@ -108,11 +152,132 @@ func (s *SGServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(400)
 		return
 	}
-	ctx := metadata.WithMeta(context.Background(), request.MetaData)
+	if !s.startRequest() {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	s.gatewayOnce.Do(func() {
+		s.gatewayHandle = s.wrapHandleRequest(s.doHandleRequest)
+	})
 	response := request.Clone()
 	response.MessageType = protocol.MessageTypeResponse
-	response = s.process(ctx, request, response)
-	s.writeHttpResponse(response, w, r)
+	// 和连接上的请求一样经过截止时间检查以及鉴权、限流等拦截器，请求的ctx在http连接断开时取消
+	p := httpPeer(r)
+	tr := &httpTransport{protocolType: s.Option.ProtocolType, peer: p}
+	s.handleRequest(peer.NewContext(r.Context(), p), s.gatewayHandle, request, response, tr, received)
+	if tr.response == nil {
+		// 超过截止时间等原因没有写入响应
+		tr.response = errorResponse(response, status.New(protocol.StatusDeadlineExceeded, "no response before the deadline"))
+	}
+	s.writeHttpResponse(tr.response, w, r)
+}
+
+// httpTransport 网关请求的传输层，拦截器和服务端写入的响应被保存下来，再转换为http响应
+type httpTransport struct {
+	protocolType protocol.ProtocolType
+	peer         *peer.Peer
+	response     *protocol.Message
+}
+
+func (t *httpTransport) Dial(network, addr string, option transport.DialOption) error {
+	return errors.New("rpc: gateway transport can not dial")
+}
+
+func (t *httpTransport) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
+
+// Write 解码写入的响应，只保留第一个
+func (t *httpTransport) Write(p []byte) (int, error) {
+	if t.response == nil {
+		response, err := protocol.DecodeMessage(t.protocolType, bytes.NewReader(p))
+		if err != nil {
+			return 0, err
+		}
+		t.response = response
+	}
+	return len(p), nil
+}
+
+func (t *httpTransport) Close() error {
+	return nil
+}
+
+func (t *httpTransport) RemoteAddr() net.Addr {
+	return t.peer.Addr
+}
+
+func (t *httpTransport) LocalAddr() net.Addr {
+	return t.peer.LocalAddr
+}
+
+// ConnectionState https网关的TLS连接状态
+func (t *httpTransport) ConnectionState() (tls.ConnectionState, bool) {
+	if t.peer.TLSState == nil {
+		return tls.ConnectionState{}, false
+	}
+	return *t.peer.TLSState, true
+}
+
+// serveHealth 查询健康状态，?service=指定服务，不指定时返回整个服务端以及所有服务的状态
+// 状态为SERVING时返回200，否则返回503
+func (s *SGServer) serveHealth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(405)
+		return
+	}
+	result := make(map[string]interface{})
+	service := r.URL.Query().Get("service")
+	status := s.health.Status(service)
+	result["status"] = status.String()
+	if service != "" {
+		result["service"] = service
+	} else {
+		services := make(map[string]string)
+		for name, st := range s.health.Statuses() {
+			services[name] = st.String()
+		}
+		result["services"] = services
+	}
+	data, _ := json.Marshal(result)
+	w.Header().Set("Content-Type", "application/json")
+	if status != health.StatusServing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_, _ = w.Write(data)
+}
+
+// serveReflection 查询服务描述，?service=指定服务，不指定时返回所有服务
+func (s *SGServer) serveReflection(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		w.WriteHeader(405)
+		return
+	}
+	services, err := s.Describe(r.URL.Query().Get("service"))
+	if err != nil {
+		w.WriteHeader(404)
+		_, _ = w.Write([]byte(err.Error()))
+		return
+	}
+	data, err := json.Marshal(reflection.DescribeResponse{Services: services})
+	if err != nil {
+		w.WriteHeader(500)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// httpPeer http请求的对端信息
+func httpPeer(r *http.Request) *peer.Peer {
+	p := &peer.Peer{TLSState: r.TLS}
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		p.Addr = addr
+	}
+	if addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr); ok {
+		p.LocalAddr = addr
+	}
+	return p
 }
 
 func parseHeader(message *protocol.Message, request *http.Request) (*protocol.Message, error) {
@@ -192,8 +357,16 @@ func (s *SGServer) writeHttpResponse(message *protocol.Message, rw http.Response
 	header.Set(HEADER_SERVICE_NAME, message.ServiceName)
 	header.Set(HEADER_METHOD_NAME, message.MethodName)
 	header.Set(HEADER_ERROR, message.Error)
+	if len(message.ErrorDetails) > 0 {
+		detailsJson, _ := json.Marshal(reflection.JSONValue(message.ErrorDetails))
+		header.Set(HEADER_ERROR_DETAILS, string(detailsJson))
+	}
 	metaDataJson, _ := json.Marshal(message.MetaData)
 	header.Set(HEADER_META_DATA, string(metaDataJson))
 
+	if err := status.FromMessage(message); err != nil {
+		// 根据状态码返回对应的http状态
+		rw.WriteHeader(status.HTTPStatus(err.Code))
+	}
 	_, _ = rw.Write(message.Data)
 }
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/lincx-911/lincxrpc/auth"
+	"github.com/lincx-911/lincxrpc/codec"
+	"github.com/lincx-911/lincxrpc/logger"
+	"github.com/lincx-911/lincxrpc/protocol"
+)
+
+type gatewayArith struct{}
+
+func (gatewayArith) Add(ctx context.Context, arg []int, reply *int) error {
+	for _, v := range arg {
+		*reply += v
+	}
+	return nil
+}
+
+// gatewayRequest 构造网关的调用请求，token为空时不带凭证
+func gatewayRequest(t *testing.T, serviceMethod [2]string, token string, arg interface{}) *http.Request {
+	data, err := codec.GetCodec(codec.JsonType).Encode(arg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := map[string]interface{}{}
+	if token != "" {
+		meta[protocol.AuthKey] = token
+	}
+	metaJSON, _ := json.Marshal(meta)
+	r := httptest.NewRequest("POST", HttpSeverUrl, bytes.NewReader(data))
+	r.Header.Set(HEADER_SEQ, "1")
+	r.Header.Set(HEADER_MESSAGE_TYPE, protocol.MessageTypeRequest.String())
+	r.Header.Set(HEADER_COMPRESS_TYPE, protocol.CompressTypeNone.String())
+	r.Header.Set(HEADER_SERIALIZE_TYPE, codec.JsonType.String())
+	r.Header.Set(HEADER_STATUS_CODE, protocol.StatusOK.String())
+	r.Header.Set(HEADER_SERVICE_NAME, serviceMethod[0])
+	r.Header.Set(HEADER_METHOD_NAME, serviceMethod[1])
+	r.Header.Set(HEADER_META_DATA, string(metaJSON))
+	return r
+}
+
+func TestGatewayRunsAuthWrapper(t *testing.T) {
+	policy, err := auth.NewPolicy(auth.Rule{Principals: []string{"alice"}, Methods: []string{"Arith.*"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	option := DefaultOption
+	option.Logger = logger.Nop()
+	option.Wrappers = []Wrapper{NewAuthWrapper(AuthOption{
+		Authenticator: auth.NewAPIKeyAuthenticator(map[string]*auth.Principal{
+			"alice-key": {Name: "alice"},
+			"bob-key":   {Name: "bob"},
+		}),
+		Authorizer: policy,
+	})}
+	s := NewRPCServer(option).(*SGServer)
+	if err := s.RegisterName("Arith", gatewayArith{}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		code  int
+		reply string
+	}{
+		{"missing token", "", http.StatusUnauthorized, ""},
+		{"invalid token", "nobody", http.StatusUnauthorized, ""},
+		{"not authorized", "bob-key", http.StatusForbidden, ""},
+		{"authorized", "alice-key", http.StatusOK, "3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, gatewayRequest(t, [2]string{"Arith", "Add"}, tt.token, []int{1, 2}))
+			if w.Code != tt.code {
+				t.Fatalf("code = %d, want %d, error = %q", w.Code, tt.code, w.Header().Get(HEADER_ERROR))
+			}
+			if got := w.Body.String(); got != tt.reply {
+				t.Fatalf("body = %q, want %q", got, tt.reply)
+			}
+			if seq, _ := strconv.Atoi(w.Header().Get(HEADER_SEQ)); seq != 1 {
+				t.Fatalf("seq = %d, want 1", seq)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"context"
+	"sync"
+
+	"github.com/lincx-911/lincxrpc/health"
+)
+
+// HealthServer 内置的健康检查服务，维护整个服务端以及各个服务的状态
+// 应用可以在预热缓存等场景下将状态设置为NOT_SERVING
+type HealthServer struct {
+	mu       sync.RWMutex
+	shutdown bool
+	statuses map[string]health.ServingStatus //服务名 -> 状态，空字符串表示整个服务端
+	saved    map[string]health.ServingStatus //Shutdown之前的状态，Resume时恢复
+}
+
+// NewHealthServer 创建健康检查服务，整个服务端默认为SERVING
+func NewHealthServer() *HealthServer {
+	return &HealthServer{
+		statuses: map[string]health.ServingStatus{"": health.StatusServing},
+	}
+}
+
+// SetServingStatus 设置服务状态，service为空时设置整个服务端的状态
+// 服务端关闭后设置不再生效
+func (h *HealthServer) SetServingStatus(service string, status health.ServingStatus) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.shutdown {
+		return
+	}
+	h.statuses[service] = status
+}
+
+// Status 获取服务状态，整个服务端不可用时所有服务都视为不可用
+func (h *HealthServer) Status(service string) health.ServingStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	status, ok := h.statuses[service]
+	if !ok {
+		return health.StatusServiceUnknown
+	}
+	if service != "" && h.statuses[""] != health.StatusServing {
+		return h.statuses[""]
+	}
+	return status
+}
+
+// Statuses 获取所有服务的状态
+func (h *HealthServer) Statuses() map[string]health.ServingStatus {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	statuses := make(map[string]health.ServingStatus, len(h.statuses))
+	for service := range h.statuses {
+		if service == "" {
+			continue
+		}
+		statuses[service] = h.statuses[service]
+		if h.statuses[""] != health.StatusServing {
+			statuses[service] = h.statuses[""]
+		}
+	}
+	return statuses
+}
+
+// Shutdown 将所有服务设置为NOT_SERVING，之后的状态设置会被忽略
+func (h *HealthServer) Shutdown() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.shutdown {
+		return
+	}
+	h.shutdown = true
+	h.saved = make(map[string]health.ServingStatus, len(h.statuses))
+	for service, status := range h.statuses {
+		h.saved[service] = status
+		h.statuses[service] = health.StatusNotServing
+	}
+}
+
+// Resume 恢复Shutdown之前的状态，包括应用设置的NOT_SERVING
+func (h *HealthServer) Resume() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.shutdown {
+		return
+	}
+	h.shutdown = false
+	for service, status := range h.saved {
+		h.statuses[service] = status
+	}
+	h.saved = nil
+}
+
+// healthService 通过rpc暴露的健康检查服务
+type healthService struct {
+	h *HealthServer
+}
+
+// Check 查询整个服务端或者单个服务的状态
+func (hs *healthService) Check(ctx context.Context, req health.CheckRequest, resp *health.CheckResponse) error {
+	resp.Status = hs.h.Status(req.Service)
+	return nil
+}
+
+// List 查询所有服务的状态
+func (hs *healthService) List(ctx context.Context, req health.ListRequest, resp *health.ListResponse) error {
+	resp.Status = hs.h.Status("")
+	resp.Services = hs.h.Statuses()
+	return nil
+}
@@ -0,0 +1,73 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lincx-911/lincxrpc/health"
+)
+
+func TestHealthServerStatus(t *testing.T) {
+	h := NewHealthServer()
+	h.SetServingStatus("Arith", health.StatusServing)
+	h.SetServingStatus("Cache", health.StatusNotServing)
+
+	tests := []struct {
+		service string
+		want    health.ServingStatus
+	}{
+		{"", health.StatusServing},
+		{"Arith", health.StatusServing},
+		{"Cache", health.StatusNotServing},
+		{"Unknown", health.StatusServiceUnknown},
+	}
+	for _, tt := range tests {
+		if got := h.Status(tt.service); got != tt.want {
+			t.Errorf("Status(%q) = %s, want %s", tt.service, got, tt.want)
+		}
+	}
+
+	// 整个服务端不可用时所有服务都视为不可用
+	h.SetServingStatus("", health.StatusNotServing)
+	if got := h.Status("Arith"); got != health.StatusNotServing {
+		t.Fatalf("Status(Arith) = %s, want NOT_SERVING", got)
+	}
+	want := map[string]health.ServingStatus{"Arith": health.StatusNotServing, "Cache": health.StatusNotServing}
+	if got := h.Statuses(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("Statuses() = %v, want %v", got, want)
+	}
+}
+
+func TestHealthServerSuspendResume(t *testing.T) {
+	h := NewHealthServer()
+	h.SetServingStatus("Arith", health.StatusServing)
+	h.SetServingStatus("Cache", health.StatusNotServing)
+	before := h.Statuses()
+
+	h.Shutdown()
+	for _, service := range []string{"", "Arith", "Cache"} {
+		if got := h.Status(service); got != health.StatusNotServing {
+			t.Fatalf("Status(%q) = %s after Shutdown", service, got)
+		}
+	}
+	// 关闭期间的设置被忽略
+	h.SetServingStatus("Arith", health.StatusServing)
+	if got := h.Status("Arith"); got != health.StatusNotServing {
+		t.Fatalf("Status(Arith) = %s, set after Shutdown", got)
+	}
+	h.Shutdown()
+
+	// 恢复关闭之前的状态，包括应用设置的NOT_SERVING
+	h.Resume()
+	if got := h.Status(""); got != health.StatusServing {
+		t.Fatalf("Status() = %s after Resume", got)
+	}
+	if got := h.Statuses(); !reflect.DeepEqual(got, before) {
+		t.Fatalf("Statuses() = %v after Resume, want %v", got, before)
+	}
+	h.Resume()
+	h.SetServingStatus("Arith", health.StatusNotServing)
+	if got := h.Status("Arith"); got != health.StatusNotServing {
+		t.Fatalf("Status(Arith) = %s, set after Resume", got)
+	}
+}
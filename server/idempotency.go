@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/lincx-911/lincxrpc/idempotency"
+	"github.com/lincx-911/lincxrpc/logger"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/status"
+	"github.com/lincx-911/lincxrpc/transport"
+)
+
+// ReasonIdempotencyKeyReused 同一个幂等key被用于不同的请求时错误详细信息中的原因
+const ReasonIdempotencyKeyReused = "idempotency_key_reused"
+
+// IdempotencyWrapper 按客户端通过client.WithIdempotencyKey携带的幂等key去重，同一个key只执行一次
+// 成功以及不可重试的结果会保存在Store中，重复的请求直接返回保存的结果，响应元数据中带有rpc_idempotent_replay
+// 相同key的请求正在处理时等待它完成；可重试的错误、超时和取消的结果不保存，重试时会重新执行
+// key按服务、方法和调用方区分，调用方为鉴权得到的名称，在AuthWrapper外层执行时为凭证的摘要
+type IdempotencyWrapper struct {
+	defaultServerInterceptor
+	store idempotency.Store
+}
+
+// NewIdempotencyWrapper 创建幂等拦截器，store为空时使用进程内的存储
+func NewIdempotencyWrapper(store idempotency.Store) *IdempotencyWrapper {
+	if store == nil {
+		store = idempotency.NewMemoryStore(idempotency.DefaultTTL)
+	}
+	return &IdempotencyWrapper{store: store}
+}
+
+func (w *IdempotencyWrapper) WrapHandleRequest(s *SGServer, requestFunc HandleRequestFunc) HandleRequestFunc {
+	return func(ctx context.Context, request *protocol.Message, response *protocol.Message, tr transport.Transport) {
+		key, _ := request.MetaData[protocol.IdempotencyKey].(string)
+		if key == "" || request.MessageType != protocol.MessageTypeRequest {
+			requestFunc(ctx, request, response, tr)
+			return
+		}
+		key = request.ServiceName + "." + request.MethodName + "/" + callerKey(ctx, request) + "/" + key
+		sum := sha256.Sum256(request.Data)
+		fingerprint := hex.EncodeToString(sum[:])
+
+		result, acquired, err := w.store.Acquire(ctx, key)
+		if err != nil {
+			if ctx.Err() != nil {
+				err = status.New(protocol.StatusAborted, "request with the same idempotency key is still in progress")
+			} else {
+				logger.FromContext(ctx).Error("idempotency store error", logger.Err(err))
+				err = status.New(protocol.StatusUnavailable, "idempotency store is unavailable")
+			}
+			s.writeResponse(ctx, tr, errorResponse(response, err))
+			return
+		}
+		if !acquired {
+			if result.Fingerprint != fingerprint {
+				err := status.New(protocol.StatusFailedPrecondition, "idempotency key was used for a different request").WithDetails(map[string]interface{}{
+					status.DetailReason: ReasonIdempotencyKeyReused,
+				})
+				s.writeResponse(ctx, tr, errorResponse(response, err))
+				return
+			}
+			s.writeResponse(ctx, tr, replayResponse(response, result))
+			return
+		}
+
+		completed := false
+		defer func() {
+			// requestFunc panic或者结果不需要保存时放弃占用，让重试重新执行
+			if !completed {
+				if err := w.store.Release(key); err != nil {
+					logger.FromContext(ctx).Warn("release idempotency key error", logger.Err(err))
+				}
+			}
+		}()
+		requestFunc(ctx, request, response, tr)
+		if se := status.FromMessage(response); se != nil {
+			switch {
+			case status.IsRetryable(se), se.Code == protocol.StatusDeadlineExceeded, se.Code == protocol.StatusCanceled:
+				return
+			}
+		}
+		err = w.store.Complete(key, &idempotency.Result{
+			StatusCode:    response.StatusCode,
+			Error:         response.Error,
+			ErrorDetails:  response.ErrorDetails,
+			SerializeType: response.SerializeType,
+			Data:          append([]byte(nil), response.Data...),
+			Fingerprint:   fingerprint,
+		})
+		if err != nil {
+			logger.FromContext(ctx).Error("save idempotency result error", logger.Err(err))
+			return
+		}
+		completed = true
+	}
+}
+
+// replayResponse 用保存的结果构造响应
+func replayResponse(response *protocol.Message, result *idempotency.Result) *protocol.Message {
+	response.StatusCode = result.StatusCode
+	response.Error = result.Error
+	response.ErrorDetails = result.ErrorDetails
+	response.SerializeType = result.SerializeType
+	response.Data = result.Data
+	meta := make(map[string]interface{}, len(response.MetaData)+1)
+	for k, v := range response.MetaData {
+		meta[k] = v
+	}
+	meta[protocol.IdempotentReplayKey] = true
+	response.MetaData = meta
+	return response
+}
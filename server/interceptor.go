@@ -2,14 +2,14 @@ package server
 
 import (
 	"context"
-	"log"
 	"os"
 	"os/signal"
-	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/lincx-911/lincxrpc/common"
 	"github.com/lincx-911/lincxrpc/common/metadata"
+	"github.com/lincx-911/lincxrpc/logger"
 	"github.com/lincx-911/lincxrpc/protocol"
 	"github.com/lincx-911/lincxrpc/registry"
 	"github.com/lincx-911/lincxrpc/transport"
@@ -21,16 +21,23 @@ type DefaultServerWrapper struct {
 
 func (w *DefaultServerWrapper) WrapServe(s *SGServer, serveFunc ServeFunc) ServeFunc {
 	return func(network, addr string, meta map[string]interface{}) error {
-		// 注册shutdownHook
+		// 管理端口启动失败时不注册提供者，直接返回错误
+		if s.Option.AdminAddr != "" {
+			if err := s.StartAdmin(); err != nil {
+				return err
+			}
+		}
+		// 收到SIGTERM后执行hook，默认的hook会优雅关闭服务端，Serve随后返回
 		go func(s *SGServer) {
 			ch := make(chan os.Signal, 1)
 			signal.Notify(ch, syscall.SIGTERM)
-			sig := <-ch
-			if sig.String() == "terminated" {
+			defer signal.Stop(ch)
+			select {
+			case <-ch:
 				for _, hook := range s.Option.ShutDownHooks {
 					hook(s)
 				}
-				os.Exit(0)
+			case <-s.shutdownDone:
 			}
 		}(s)
 		//服务端注册时，将我们设置的tags作为元数据注册到注册中心
@@ -42,6 +49,16 @@ func (w *DefaultServerWrapper) WrapServe(s *SGServer, serveFunc ServeFunc) Serve
 			meta["tags"] = s.Option.Tags
 		}
 		meta["services"] = s.Services()
+		if s.Option.Weight > 0 {
+			meta[protocol.ProviderWeightKey] = s.Option.Weight
+		}
+		if s.Option.WarmUp > 0 {
+			// 预热已经进行的时间和预热时长，单位为毫秒，客户端按照自己的时钟换算开始时间，不受时钟偏差影响
+			// 刚开始预热时进行的时间为0，之后由warmUp定期更新
+			meta[protocol.ProviderWarmUpAge] = int64(0)
+			meta[protocol.ProviderWarmUpKey] = int64(s.Option.WarmUp / time.Millisecond)
+			go s.warmUp(time.Now())
+		}
 		// TODO registry
 		if addr[0]==':'{
 			addr = common.LocalIPV4()+addr
@@ -58,7 +75,7 @@ func (w *DefaultServerWrapper) WrapServe(s *SGServer, serveFunc ServeFunc) Serve
 		r := s.Option.Registry
 		rOpt := s.Option.RegisterOption
 		r.Register(rOpt, provider)
-		log.Printf("registered provider %v for app %s", provider, rOpt)
+		s.log().Info("registered provider", logger.F("provider", provider.ProviderKey), logger.F("app", rOpt.AppKey))
 		//启动http serve
 		s.StartGateway()
 		return serveFunc(network, addr, meta)
@@ -67,26 +84,18 @@ func (w *DefaultServerWrapper) WrapServe(s *SGServer, serveFunc ServeFunc) Serve
 
 func (w *DefaultServerWrapper) WrapHandleRequest(s *SGServer, requestFunc HandleRequestFunc) HandleRequestFunc {
 	return func(ctx context.Context, request *protocol.Message, response *protocol.Message, tr transport.Transport) {
-		ctx = metadata.WithMeta(ctx, request.MetaData)
-		// 正在处理的请求加1
-		atomic.AddInt64(&s.requestInProcess, 1)
+		ctx = metadata.NewIncomingContext(ctx, request.MetaData)
 		requestFunc(ctx, request, response, tr)
-		atomic.AddInt64(&s.requestInProcess, -1)
 	}
 }
 
 func (w *DefaultServerWrapper) WrapClose(s *SGServer, closeFunc CloseFunc) CloseFunc {
 	return func() error {
-		
-		provider := registry.Provider{
-			ProviderKey: s.network + "@" + s.addr,
-			Network:     s.network,
-			Addr:        s.addr,
-		}
+		provider := s.provider(nil)
 		r := s.Option.Registry
 		rOpt := s.Option.RegisterOption
 		r.Unregister(rOpt, provider)
-		log.Printf("unregistered provider %v for app %s", provider, rOpt)
+		s.log().Info("unregistered provider", logger.F("provider", provider.ProviderKey), logger.F("app", rOpt.AppKey))
 		return closeFunc()
 	}
 }
@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/common/metadata"
+	"github.com/lincx-911/lincxrpc/health"
+	"github.com/lincx-911/lincxrpc/loadshed"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/status"
+	"github.com/lincx-911/lincxrpc/transport"
+)
+
+// ReasonOverloaded 过载被拒绝时错误详细信息中的原因
+const ReasonOverloaded = "overloaded"
+
+// LoadShedWrapper 使用loadshed.Limiter限制并发，超过上限的请求立即返回StatusUnavailable，详细信息中reason为overloaded，
+// retry_after_ms为请求耗时的移动平均，客户端重试同一个提供者前会等待这段时间
+// 优先级从请求元数据的rpc_priority中读取，客户端通过client.WithPriority设置，没有时为PriorityNormal，超出范围时取最近的优先级
+// 请求超时会被视为过载的信号
+type LoadShedWrapper struct {
+	defaultServerInterceptor
+	limiter *loadshed.Limiter
+}
+
+// NewLoadShedWrapper 创建过载保护拦截器，limiter为空时使用默认的梯度算法
+func NewLoadShedWrapper(limiter *loadshed.Limiter) *LoadShedWrapper {
+	if limiter == nil {
+		limiter = loadshed.NewLimiter(nil)
+	}
+	return &LoadShedWrapper{limiter: limiter}
+}
+
+// Limiter 拦截器使用的并发限制，可以用于观察当前的上限和并发数
+func (w *LoadShedWrapper) Limiter() *loadshed.Limiter {
+	return w.limiter
+}
+
+func (w *LoadShedWrapper) WrapHandleRequest(s *SGServer, requestFunc HandleRequestFunc) HandleRequestFunc {
+	return func(ctx context.Context, request *protocol.Message, response *protocol.Message, tr transport.Transport) {
+		if request.MessageType == protocol.MessageTypeHeartbeat || request.ServiceName == health.ServiceName {
+			requestFunc(ctx, request, response, tr)
+			return
+		}
+		priority := loadshed.PriorityNormal
+		if p, ok := metadata.Int(request.MetaData, protocol.PriorityKey); ok {
+			priority = loadshed.PriorityOf(p)
+		}
+		token, ok := w.limiter.Acquire(priority)
+		if !ok {
+			// 大约一个请求的耗时之后才会有空闲的并发，客户端重试同一个提供者前等待这段时间
+			retryAfter := int64(w.limiter.Latency()/time.Millisecond) + 1
+			err := status.New(protocol.StatusUnavailable, "server is overloaded").WithDetails(map[string]interface{}{
+				status.DetailReason:     ReasonOverloaded,
+				status.DetailRetryAfter: retryAfter,
+			})
+			s.writeResponse(ctx, tr, errorResponse(response, err))
+			return
+		}
+		requestFunc(ctx, request, response, tr)
+		dropped := ctx.Err() == context.DeadlineExceeded
+		if se := status.FromMessage(response); se != nil && se.Code == protocol.StatusDeadlineExceeded {
+			dropped = true
+		}
+		token.Release(dropped)
+	}
+}
@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/metrics"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/transport"
+)
+
+// MetricsWrapper 记录请求数、耗时、处理中的请求数以及请求和响应的大小
+type MetricsWrapper struct {
+	defaultServerInterceptor
+	requests      *metrics.CounterVec
+	duration      *metrics.HistogramVec
+	inFlight      *metrics.GaugeVec
+	requestBytes  *metrics.HistogramVec
+	responseBytes *metrics.HistogramVec
+}
+
+// NewMetricsWrapper 创建指标拦截器，r为空时使用metrics.DefaultRegistry
+// 同一个注册表上的多个服务端共用同一组指标
+func NewMetricsWrapper(r *metrics.Registry) *MetricsWrapper {
+	if r == nil {
+		r = metrics.DefaultRegistry
+	}
+	return &MetricsWrapper{
+		requests: r.GetOrRegister(metrics.NewCounterVec("lincxrpc_server_requests_total",
+			"Total number of requests handled by the server.", "service", "method", "status")).(*metrics.CounterVec),
+		duration: r.GetOrRegister(metrics.NewHistogramVec("lincxrpc_server_request_duration_seconds",
+			"Time spent handling requests.", metrics.DefBuckets, "service", "method")).(*metrics.HistogramVec),
+		inFlight: r.GetOrRegister(metrics.NewGaugeVec("lincxrpc_server_in_flight_requests",
+			"Number of requests currently being handled.", "service", "method")).(*metrics.GaugeVec),
+		requestBytes: r.GetOrRegister(metrics.NewHistogramVec("lincxrpc_server_request_bytes",
+			"Size of request payloads.", metrics.SizeBuckets, "service", "method")).(*metrics.HistogramVec),
+		responseBytes: r.GetOrRegister(metrics.NewHistogramVec("lincxrpc_server_response_bytes",
+			"Size of response payloads.", metrics.SizeBuckets, "service", "method")).(*metrics.HistogramVec),
+	}
+}
+
+func (w *MetricsWrapper) WrapHandleRequest(s *SGServer, requestFunc HandleRequestFunc) HandleRequestFunc {
+	return func(ctx context.Context, request *protocol.Message, response *protocol.Message, tr transport.Transport) {
+		if request.MessageType != protocol.MessageTypeRequest {
+			requestFunc(ctx, request, response, tr)
+			return
+		}
+		service, method := request.ServiceName, request.MethodName
+		if s.methodOf(service, method) == nil {
+			// 不存在的服务名和方法名由调用方决定，避免标签无限增长
+			service, method = "unknown", "unknown"
+		}
+		inFlight := w.inFlight.With(service, method)
+		inFlight.Inc()
+		start := time.Now()
+		requestFunc(ctx, request, response, tr)
+		inFlight.Dec()
+		w.duration.With(service, method).Observe(time.Since(start).Seconds())
+		w.requests.With(service, method, response.StatusCode.String()).Inc()
+		w.requestBytes.With(service, method).Observe(float64(len(request.Data)))
+		w.responseBytes.With(service, method).Observe(float64(len(response.Data)))
+	}
+}
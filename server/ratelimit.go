@@ -0,0 +1,68 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/common/stats"
+	"github.com/lincx-911/lincxrpc/health"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/ratelimit"
+	"github.com/lincx-911/lincxrpc/status"
+	"github.com/lincx-911/lincxrpc/transport"
+)
+
+// ReasonRateLimited 被限流时错误详细信息中的原因
+const ReasonRateLimited = "rate_limited"
+
+// CallerFunc 获取请求的调用方
+type CallerFunc func(ctx context.Context, request *protocol.Message) string
+
+// DefaultCaller 鉴权通过的调用方；鉴权还没有执行时为请求中凭证的摘要，每个凭证单独限流；
+// 没有凭证时使用客户端在元数据中携带的AppKey
+func DefaultCaller(ctx context.Context, request *protocol.Message) string {
+	if principal := stats.ServerFromContext(ctx).Principal(); principal != "" {
+		return principal
+	}
+	if key := callerKey(ctx, request); key != "" {
+		return key
+	}
+	appKey, _ := request.MetaData[protocol.CallerAppKey].(string)
+	return appKey
+}
+
+// RateLimitWrapper 按ratelimit.Limiter的规则限流，被拒绝的请求返回StatusResourceExhausted
+// 详细信息中reason为rate_limited，retry_after_ms为建议的等待时间，客户端可以通过status.RetryAfter获取
+// 规则中按名称指定Caller时，需要放在AuthWrapper之前，使它在AuthWrapper内层执行
+type RateLimitWrapper struct {
+	defaultServerInterceptor
+	limiter *ratelimit.Limiter
+	caller  CallerFunc
+}
+
+// NewRateLimitWrapper 创建限流拦截器，caller为空时使用DefaultCaller，规则可以通过limiter.Update重新加载
+func NewRateLimitWrapper(limiter *ratelimit.Limiter, caller CallerFunc) *RateLimitWrapper {
+	if caller == nil {
+		caller = DefaultCaller
+	}
+	return &RateLimitWrapper{limiter: limiter, caller: caller}
+}
+
+func (w *RateLimitWrapper) WrapHandleRequest(s *SGServer, requestFunc HandleRequestFunc) HandleRequestFunc {
+	return func(ctx context.Context, request *protocol.Message, response *protocol.Message, tr transport.Transport) {
+		if request.MessageType == protocol.MessageTypeHeartbeat || request.ServiceName == health.ServiceName {
+			requestFunc(ctx, request, response, tr)
+			return
+		}
+		ok, rule, wait := w.limiter.Allow(request.ServiceName, request.MethodName, w.caller(ctx, request))
+		if ok {
+			requestFunc(ctx, request, response, tr)
+			return
+		}
+		err := status.Errorf(protocol.StatusResourceExhausted, "rate limit exceeded: %s", rule).WithDetails(map[string]interface{}{
+			status.DetailReason:     ReasonRateLimited,
+			status.DetailRetryAfter: int64(wait/time.Millisecond) + 1,
+		})
+		s.writeResponse(ctx, tr, errorResponse(response, err))
+	}
+}
@@ -0,0 +1,55 @@
+package server
+
+import (
+	"context"
+	"sort"
+
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/reflection"
+	"github.com/lincx-911/lincxrpc/status"
+)
+
+// Describe 描述服务的方法以及参数和返回值的类型，serviceName为空时描述所有服务
+func (s *SGServer) Describe(serviceName string) ([]reflection.ServiceDescriptor, error) {
+	var descriptors []reflection.ServiceDescriptor
+	s.serviceMap.Range(func(key, value interface{}) bool {
+		srv, ok := value.(*service)
+		if !ok || (serviceName != "" && srv.name != serviceName) {
+			return true
+		}
+		sd := reflection.ServiceDescriptor{Name: srv.name}
+		srv.methods.Range(func(key, value interface{}) bool {
+			if m, ok := value.(*methodType); ok {
+				sd.Methods = append(sd.Methods, reflection.DescribeMethodType(m.method.Name, m.ArgType, m.ReplyType))
+			}
+			return true
+		})
+		sort.Slice(sd.Methods, func(i, j int) bool {
+			return sd.Methods[i].Name < sd.Methods[j].Name
+		})
+		descriptors = append(descriptors, sd)
+		return true
+	})
+	if serviceName != "" && len(descriptors) == 0 {
+		return nil, status.Errorf(protocol.StatusNotFound, "can not find service %s", serviceName)
+	}
+	sort.Slice(descriptors, func(i, j int) bool {
+		return descriptors[i].Name < descriptors[j].Name
+	})
+	return descriptors, nil
+}
+
+// reflectionService 通过rpc暴露的反射服务
+type reflectionService struct {
+	s *SGServer
+}
+
+// Describe 查询服务描述
+func (rs *reflectionService) Describe(ctx context.Context, req reflection.DescribeRequest, resp *reflection.DescribeResponse) error {
+	services, err := rs.s.Describe(req.Service)
+	if err != nil {
+		return err
+	}
+	resp.Services = services
+	return nil
+}
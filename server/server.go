@@ -4,8 +4,9 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"log"
+	"net/http"
 	"reflect"
+	"runtime/debug"
 	"strings"
 	"sync"
 	"time"
@@ -14,16 +15,24 @@ import (
 
 	"github.com/lincx-911/lincxrpc/codec"
 	"github.com/lincx-911/lincxrpc/common/metadata"
+	"github.com/lincx-911/lincxrpc/common/peer"
+	"github.com/lincx-911/lincxrpc/common/stats"
+	"github.com/lincx-911/lincxrpc/health"
+	"github.com/lincx-911/lincxrpc/logger"
 	"github.com/lincx-911/lincxrpc/protocol"
-	"github.com/lincx-911/lincxrpc/registry"
+	"github.com/lincx-911/lincxrpc/reflection"
+	"github.com/lincx-911/lincxrpc/status"
 	"github.com/lincx-911/lincxrpc/transport"
 )
 
 // RPCServer rpc接口
 type RPCServer interface {
-	Register(rcvr interface{}) error
+	Register(rcvr interface{}, opts ...ServiceOption) error
+	RegisterName(name string, rcvr interface{}, opts ...ServiceOption) error
 	Serve(network string, addr string, metaData map[string]interface{}) error
 	Services() []ServiceInfo
+	SetServingStatus(service string, status health.ServingStatus)
+	Shutdown(ctx context.Context) error
 	Close() error
 }
 
@@ -38,11 +47,22 @@ type SGServer struct {
 	serviceMap sync.Map                  // 保存服务
 	tr         transport.ServerTransport //传输层
 	mutex      sync.Mutex
-	shutdown   bool
 
-	requestInProcess int64  //当前正在处理中的请求数
-	network          string //网络类型 tcp.....
-	addr             string // 端口地址
+	shutdownStarted  int32                            //是否调用了Shutdown
+	inShutdown       int32                            //是否已经开始关闭，不再处理新的请求
+	shutdownDone     chan struct{}                    //关闭完成
+	connsMu          sync.Mutex                       //保护conns
+	conns            map[transport.Transport]struct{} //当前的连接
+	requestInProcess int64                            //当前正在处理中的请求数
+	idle             chan struct{}                    //处理中的请求数降为0时通知
+	network          string                           //网络类型 tcp.....
+	addr             string                           // 端口地址
+	meta             map[string]interface{}           //注册到注册中心的元数据
+	health           *HealthServer
+	admin            *http.Server
+	gateways         []*http.Server //http和https网关
+	gatewayOnce      sync.Once
+	gatewayHandle    HandleRequestFunc //网关请求经过的拦截器链，和连接上的请求相同
 
 	Option Option // 配置选项
 }
@@ -52,6 +72,7 @@ type methodType struct {
 	method    reflect.Method
 	ArgType   reflect.Type
 	ReplyType reflect.Type
+	cacheTTL  time.Duration // 大于0时响应可以缓存，通过CacheMethod设置
 }
 
 // service 服务
@@ -69,24 +90,51 @@ func NewRPCServer(option Option) RPCServer {
 	s.Option.Wrappers = append(s.Option.Wrappers,
 		&DefaultServerWrapper{},
 	)
+	s.shutdownDone = make(chan struct{})
+	s.conns = make(map[transport.Transport]struct{})
+	s.idle = make(chan struct{}, 1)
 	s.AddShutdownHook(func(s *SGServer) {
-		provider := registry.Provider{
-			ProviderKey: s.network + "@" + s.addr,
-			Network:     s.network,
-			Addr:        s.addr,
+		if err := s.Close(); err != nil {
+			s.log().Error("close server error", logger.Err(err))
 		}
-		s.Option.Registry.Unregister(s.Option.RegisterOption, provider)
-		s.Close()
 	})
 	s.codec = codec.GetCodec(option.SerializeType)
+	s.health = NewHealthServer()
+	// 内置健康检查服务
+	if err := s.RegisterName(health.ServiceName, &healthService{s.health}); err != nil {
+		s.log().Error("register health service error", logger.Err(err))
+	}
+	if !option.DisableReflection {
+		// 反射服务，用于描述服务的方法以及参数类型
+		if err := s.RegisterName(reflection.ServiceName, &reflectionService{s}); err != nil {
+			s.log().Error("register reflection service error", logger.Err(err))
+		}
+	}
 	return s
 }
 
-// Register 注册服务
+// Register 注册服务，服务名为rcvr的类型名
 // rvcr
-func (s *SGServer) Register(rcvr interface{}) error {
+// opts 设置方法的选项，比如CacheMethod
+func (s *SGServer) Register(rcvr interface{}, opts ...ServiceOption) error {
+	return s.register(rcvr, "", opts)
+}
+
+// RegisterName 使用指定的服务名注册服务
+func (s *SGServer) RegisterName(name string, rcvr interface{}, opts ...ServiceOption) error {
+	return s.register(rcvr, name, opts)
+}
+
+func (s *SGServer) register(rcvr interface{}, name string, opts []ServiceOption) error {
 	typ := reflect.TypeOf(rcvr)
-	name := typ.Name()
+	if name == "" {
+		name = reflect.Indirect(reflect.ValueOf(rcvr)).Type().Name()
+	}
+	if name == "" {
+		errStr := "Register: no service name for type " + typ.String()
+		s.log().Error(errStr)
+		return fmt.Errorf(errStr)
+	}
 	srv := new(service)
 	srv.name = name
 	srv.rcvr = reflect.ValueOf(rcvr)
@@ -102,20 +150,36 @@ func (s *SGServer) Register(rcvr interface{}) error {
 		} else {
 			errStr = "Register: type " + name + " has no exported methods of suitable type"
 		}
-		log.Println(errStr)
+		s.log().Error(errStr)
 		return fmt.Errorf(errStr)
 	}
 
+	for _, opt := range opts {
+		if err := opt(name, methods); err != nil {
+			return err
+		}
+	}
 	for k, v := range methods {
 		srv.methods.Store(k, v)
 	}
 	if _, duplicate := s.serviceMap.LoadOrStore(name, srv); duplicate {
 		return fmt.Errorf("rpc: service already defined: %s", name)
 	}
+	s.health.SetServingStatus(name, health.StatusServing)
 
 	return nil
 }
 
+// Health 内置的健康检查服务，可以用来修改服务状态
+func (s *SGServer) Health() *HealthServer {
+	return s.health
+}
+
+// SetServingStatus 设置服务状态，service为空时设置整个服务端的状态
+func (s *SGServer) SetServingStatus(service string, status health.ServingStatus) {
+	s.health.SetServingStatus(service, status)
+}
+
 // Precompute the reflect type for error. Can't use error directly
 // because Typeof takes an empty interface value. This is annoying.
 var typeOfError = reflect.TypeOf((*error)(nil)).Elem()
@@ -136,7 +200,7 @@ func suitableMethods(typ reflect.Type, reportErr bool) map[string]*methodType {
 		// 需要有四个参数: receiver, Context, args, *reply.
 		if mtype.NumIn() != 4 {
 			if reportErr {
-				log.Println("method", mname, "has wrong number of ins:", mtype.NumIn())
+				logger.Warn("method has wrong number of ins", logger.F("method", mname), logger.F("ins", mtype.NumIn()))
 			}
 			continue
 		}
@@ -144,7 +208,7 @@ func suitableMethods(typ reflect.Type, reportErr bool) map[string]*methodType {
 		ctxType := mtype.In(1)
 		if !ctxType.Implements(typeOfContext) {
 			if reportErr {
-				log.Println("method", mname, " must use context.Context as the first parameter")
+				logger.Warn("method must use context.Context as the first parameter", logger.F("method", mname))
 			}
 			continue
 		}
@@ -153,7 +217,7 @@ func suitableMethods(typ reflect.Type, reportErr bool) map[string]*methodType {
 		argType := mtype.In(2)
 		if !isExportedOrBuiltinType(argType) {
 			if reportErr {
-				log.Println(mname, "parameter type not exported:", argType)
+				logger.Warn("method parameter type not exported", logger.F("method", mname), logger.F("type", argType))
 			}
 			continue
 		}
@@ -161,28 +225,28 @@ func suitableMethods(typ reflect.Type, reportErr bool) map[string]*methodType {
 		replyType := mtype.In(3)
 		if replyType.Kind() != reflect.Ptr {
 			if reportErr {
-				log.Println("method", mname, "reply type not a pointer:", replyType)
+				logger.Warn("method reply type not a pointer", logger.F("method", mname), logger.F("type", replyType))
 			}
 			continue
 		}
 		// 返回值的类型必须是可导出的
 		if !isExportedOrBuiltinType(replyType) {
 			if reportErr {
-				log.Println("method", mname, "reply type not exported:", replyType)
+				logger.Warn("method reply type not exported", logger.F("method", mname), logger.F("type", replyType))
 			}
 			continue
 		}
 		// 必须有一个返回值
 		if mtype.NumOut() != 1 {
 			if reportErr {
-				log.Println("method", mname, "has wrong number of outs:", mtype.NumOut())
+				logger.Warn("method has wrong number of outs", logger.F("method", mname), logger.F("outs", mtype.NumOut()))
 			}
 			continue
 		}
 		// 返回值类型必须是error
 		if returnType := mtype.Out(0); returnType != typeOfError {
 			if reportErr {
-				log.Println("method", mname, "returns", returnType.String(), "not error")
+				logger.Warn("method does not return error", logger.F("method", mname), logger.F("type", returnType))
 			}
 			continue
 		}
@@ -224,28 +288,35 @@ func (s *SGServer) wrapServe(serveFunc ServeFunc) ServeFunc {
 
 // serve 注册新的服务端主要逻辑
 func (s *SGServer) serve(network string, addr string, metaData map[string]interface{}) error {
-	if s.shutdown {
+	if s.isShutdown() {
 		return nil
 	}
-	s.tr = transport.NewServerTransport(s.Option.TransportType)
-	err := s.tr.Listen(network, addr)
+	s.mutex.Lock()
+	s.meta = metaData
+	s.mutex.Unlock()
+	tr := transport.NewServerTransport(s.Option.TransportType)
+	err := tr.Listen(network, addr, transport.ListenOption{TLSConfig: s.Option.TLSConfig})
 	if err != nil {
-		log.Printf("server listen on %s@%s error:%s", network, addr, err)
+		s.log().Error("server listen error", logger.F("network", network), logger.F("addr", addr), logger.Err(err))
 		return err
 	}
+	s.mutex.Lock()
+	s.tr = tr
+	s.mutex.Unlock()
+	if s.isShutdown() {
+		// Listen期间开始了关闭
+		return tr.Close()
+	}
 	for {
-		if s.shutdown {
-			continue
-		}
-		conn, err := s.tr.Accept()
+		conn, err := tr.Accept()
 		if err != nil {
-			if strings.Contains(err.Error(), "use of closed network connection") && s.shutdown {
+			if s.isShutdown() {
 				return nil
 			}
-			log.Printf("server accept on %s@%s error:%s", network, addr, err)
+			s.log().Error("server accept error", logger.F("network", network), logger.F("addr", addr), logger.Err(err))
 			return err
 		}
-		go s.serveTransport(conn)
+		go s.wrapServeTransport(s.serveTransport)(conn)
 	}
 }
 
@@ -272,40 +343,6 @@ func (s *SGServer) Services() []ServiceInfo {
 	return srvs
 }
 
-func (s *SGServer) Close() error {
-	closeFunc := s.close
-
-	for _, w := range s.Option.Wrappers {
-		closeFunc = w.WrapClose(s, closeFunc)
-	}
-
-	return closeFunc()
-}
-
-func (s *SGServer) close() error {
-	s.mutex.Lock()
-	defer s.mutex.Unlock()
-
-	s.shutdown = true
-
-	//等待当前请求处理完或者直到指定的时间
-	ticker := time.NewTicker(s.Option.ShutDownWait)
-	defer ticker.Stop()
-	for {
-		if s.requestInProcess <= 0 {
-			break
-		}
-		select {
-		case <-ticker.C:
-			break
-		}
-	}
-	if s.tr != nil {
-		return s.tr.Close()
-	}
-	return nil
-}
-
 // Request 请求
 type Request struct {
 	Seq   uint32
@@ -313,36 +350,126 @@ type Request struct {
 	Data  []byte
 }
 
+func (s *SGServer) wrapServeTransport(transportFunc ServeTransportFunc) ServeTransportFunc {
+	for _, w := range s.Option.Wrappers {
+		transportFunc = w.WrapServeTransport(s, transportFunc)
+	}
+	return transportFunc
+}
+
+// serveTransport 读取连接上的请求并发处理
+// 连接的ctx在读取循环退出(连接断开或者关闭)时取消，请求的ctx都由它派生
 func (s *SGServer) serveTransport(tr transport.Transport) {
+	s.trackConn(tr, true)
+	defer s.trackConn(tr, false)
+	connCtx, cancel := context.WithCancel(peer.NewContext(context.Background(), peerOf(tr)))
+	defer cancel()
+	handleFunc := s.wrapHandleRequest(s.doHandleRequest)
+	// 限制连接上同时处理的请求数，达到上限时暂停读取，由TCP的流量控制反压给客户端
+	var sem chan struct{}
+	if s.Option.MaxConnRequests > 0 {
+		sem = make(chan struct{}, s.Option.MaxConnRequests)
+	}
 	for {
-		if s.shutdown {
-			tr.Close()
-			continue
-		}
 		request, err := protocol.DecodeMessage(s.Option.ProtocolType, tr)
+		received := time.Now()
 		if err != nil {
 			if err == io.EOF {
-				log.Printf("client has closed this connection: %s", tr.RemoteAddr().String())
+				s.log().Debug("client has closed this connection", logger.F("peer", tr.RemoteAddr()))
 			} else if strings.Contains(err.Error(), "use of closed network connection") {
-				log.Printf("rpc: connection %s is closed", tr.RemoteAddr().String())
+				s.log().Debug("connection is closed", logger.F("peer", tr.RemoteAddr()))
 			} else {
-				log.Printf("rpc: failed to read request: %v", err)
+				s.log().Warn("failed to read request", logger.F("peer", tr.RemoteAddr()), logger.Err(err))
 			}
 			return
 		}
 		response := request.Clone()
 		response.MessageType = protocol.MessageTypeResponse
 
-		deadline, ok := response.Deadline()
-		ctx := metadata.WithMeta(context.Background(), response.MetaData)
-		if ok {
-			ctx, _ = context.WithDeadline(ctx, deadline)
+		if !s.startRequest() {
+			// 已经开始关闭，拒绝新的请求，客户端可以重试其他提供者
+			s.writeResponse(connCtx, tr, errorResponse(response, status.New(protocol.StatusUnavailable, "server is shutting down")))
+			continue
 		}
-		handleFunc := s.doHandleRequest
+		if sem != nil {
+			sem <- struct{}{}
+		}
+		// 并发处理，读取循环不会被耗时的请求阻塞，响应按照处理完成的顺序写入，客户端通过Seq对应请求
+		go func() {
+			s.handleRequest(connCtx, handleFunc, request, response, tr, received)
+			if sem != nil {
+				<-sem
+			}
+		}()
+	}
+}
+
+// handleRequest 在连接的ctx上附加元数据和截止时间后处理请求
+// 剩余时间不够的请求在进入拦截器之前直接拒绝，拒绝的响应总是会写入，客户端据此快速失败
+func (s *SGServer) handleRequest(connCtx context.Context, handleFunc HandleRequestFunc, request *protocol.Message, response *protocol.Message, tr transport.Transport, received time.Time) {
+	defer s.finishRequest()
+	deadline, hasDeadline := requestDeadline(request, received)
+	if hasDeadline && request.MessageType == protocol.MessageTypeRequest {
+		if err := s.admit(deadline); err != nil {
+			s.writeErrorResponse(response, tr, err)
+			return
+		}
+	}
+	ctx := metadata.NewIncomingContext(connCtx, request.MetaData)
+	// 拦截器和服务端共享的本次请求的记录
+	ctx = stats.NewServerContext(ctx, new(stats.RPCStats))
+	ctx = logger.NewContext(ctx, s.log().With(
+		logger.F("seq", request.Seq),
+		logger.F("service", request.ServiceName),
+		logger.F("method", request.MethodName),
+		logger.F("peer", tr.RemoteAddr()),
+	))
+	if hasDeadline {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	handleFunc(ctx, request, response, tr)
+}
+
+// requestDeadline 请求的截止时间，由客户端传递的剩余时间(rpc_request_timeout)加上收到请求的时间得到，
+// 不受客户端和服务端时钟偏差的影响；没有剩余时间时使用客户端传递的截止时间
+func requestDeadline(request *protocol.Message, received time.Time) (time.Time, bool) {
+	if timeout, ok := metadata.Int(request.MetaData, protocol.RequestTimeoutKey); ok {
+		return received.Add(time.Duration(timeout)), true
+	}
+	return request.Deadline()
+}
+
+// admit 已经过期或者剩余时间少于MinRequestBudget的请求返回StatusDeadlineExceeded，不再解码和执行
+func (s *SGServer) admit(deadline time.Time) error {
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		return status.New(protocol.StatusDeadlineExceeded, "deadline exceeded before processing")
+	}
+	if remaining < s.Option.MinRequestBudget {
+		return status.Errorf(protocol.StatusDeadlineExceeded, "insufficient deadline budget: %v left, need %v", remaining, s.Option.MinRequestBudget)
+	}
+	return nil
+}
 
-		s.wrapHandleRequest(handleFunc)(ctx, request, response, tr)
+// log 服务端的日志，没有设置Option.Logger时使用全局日志
+func (s *SGServer) log() logger.Logger {
+	if s.Option.Logger != nil {
+		return s.Option.Logger
 	}
+	return logger.Default()
+}
 
+// peerOf 连接的对端信息
+func peerOf(tr transport.Transport) *peer.Peer {
+	p := &peer.Peer{Addr: tr.RemoteAddr(), LocalAddr: tr.LocalAddr()}
+	if stater, ok := tr.(transport.ConnectionStater); ok {
+		if state, ok := stater.ConnectionState(); ok {
+			p.TLSState = &state
+		}
+	}
+	return p
 }
 
 func (s *SGServer) wrapHandleRequest(handleFunc HandleRequestFunc) HandleRequestFunc {
@@ -355,31 +482,65 @@ func (s *SGServer) wrapHandleRequest(handleFunc HandleRequestFunc) HandleRequest
 // 处理请求
 func (s *SGServer) doHandleRequest(ctx context.Context, request *protocol.Message, response *protocol.Message, tr transport.Transport) {
 	response = s.process(ctx, request, response)
+	st := stats.ServerFromContext(ctx)
+	received, timed := st.Time(stats.RequestReceived)
+	var cacheTTL time.Duration
+	if response.StatusCode == protocol.StatusOK {
+		// 由CacheWrapper设置，没有使用CacheWrapper时不告诉客户端可以缓存
+		cacheTTL = st.CacheTTL()
+	}
+	if timed || cacheTTL > 0 {
+		meta := make(map[string]interface{}, len(response.MetaData)+2)
+		for k, v := range response.MetaData {
+			meta[k] = v
+		}
+		if timed {
+			// 把服务端的处理时间告诉客户端，客户端据此计算网络耗时
+			meta[protocol.ServerTimeKey] = int64(time.Since(received))
+		}
+		if cacheTTL > 0 {
+			// 告诉客户端响应可以缓存的时间
+			meta[protocol.CacheTTLKey] = int64(cacheTTL)
+		}
+		response.MetaData = meta
+	}
 	s.writeResponse(ctx, tr, response)
 }
 
+// methodOf 查找服务方法，不存在时返回nil
+func (s *SGServer) methodOf(serviceName, methodName string) *methodType {
+	srvInterface, _ := s.serviceMap.Load(serviceName)
+	srv, ok := srvInterface.(*service)
+	if !ok {
+		return nil
+	}
+	mtype, _ := srv.methods.Load(methodName)
+	m, _ := mtype.(*methodType)
+	return m
+}
+
 //处理请求的主要逻辑
 func (s *SGServer) process(ctx context.Context, request *protocol.Message, response *protocol.Message) *protocol.Message {
 	// 心跳信息直接返回响应
 	if request.MessageType == protocol.MessageTypeHeartbeat {
-		response.MessageType = protocol.MessageTypeResponse
+		response.MessageType = protocol.MessageTypeHeartbeat
 		return response
 	}
 	sname := request.ServiceName
 	mname := request.MethodName
 	srvInterface, ok := s.serviceMap.Load(sname) //获取服务
 	if !ok {
-		return errorResponse(response, "can not find service")
+		return errorResponse(response, status.Errorf(protocol.StatusUnimplemented, "can not find service %s", sname))
 	}
 	srv, ok := srvInterface.(*service)
 	if !ok {
-		return errorResponse(response, "not *service type")
+		return errorResponse(response, status.New(protocol.StatusInternal, "not *service type"))
 
 	}
 	mtypeInterface, _ := srv.methods.Load(mname)
 	mtype, ok := mtypeInterface.(*methodType)
 	if !ok {
-		return errorResponse(response, "can not find method")
+		return errorResponse(response, status.Errorf(protocol.StatusUnimplemented, "can not find method %s.%s", sname, mname))
 	}
 
 	argv := newValue(mtype.ArgType)
@@ -389,11 +550,44 @@ func (s *SGServer) process(ctx context.Context, request *protocol.Message, respo
 	if request.SerializeType != s.Option.SerializeType {
 		actualCodec = codec.GetCodec(request.SerializeType)
 	}
+	st := stats.ServerFromContext(ctx)
+	st.SetRequestBytes(len(request.Data))
+	st.Mark(stats.DecodeStart)
 	err := actualCodec.Decode(request.Data, argv)
+	st.Mark(stats.DecodeEnd)
 	if err != nil {
-		return errorResponse(response, "decode arg error:"+err.Error())
+		return errorResponse(response, status.New(protocol.StatusInvalidArgument, "decode arg error:"+err.Error()))
 	}
 
+	if err = s.call(ctx, request, srv, mtype, argv, replyv); err != nil {
+		return errorResponse(response, err)
+	}
+	st.Mark(stats.EncodeStart)
+	responseData, err := actualCodec.Encode(replyv)
+	st.Mark(stats.EncodeEnd)
+	st.SetResponseBytes(len(responseData))
+	if err != nil {
+		return errorResponse(response, status.New(protocol.StatusInternal, "encode reply error:"+err.Error()))
+	}
+
+	response.StatusCode = protocol.StatusOK
+	response.Data = responseData
+	return response
+
+}
+
+// call 调用服务方法，方法中的panic会被恢复并转换为StatusInternal错误
+func (s *SGServer) call(ctx context.Context, request *protocol.Message, srv *service, mtype *methodType, argv, replyv interface{}) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			stack := debug.Stack()
+			logger.FromContext(ctx).Error("panic in service method", logger.F("panic", p), logger.F("stack", string(stack)))
+			if s.Option.PanicHandler != nil {
+				s.Option.PanicHandler(ctx, request, p, stack)
+			}
+			err = status.Errorf(protocol.StatusInternal, "panic in %s.%s: %v", request.ServiceName, request.MethodName, p)
+		}
+	}()
 	var returns []reflect.Value
 	if mtype.ArgType.Kind() != reflect.Ptr {
 		returns = mtype.method.Func.Call([]reflect.Value{srv.rcvr,
@@ -408,24 +602,14 @@ func (s *SGServer) process(ctx context.Context, request *protocol.Message, respo
 			reflect.ValueOf(replyv)})
 	}
 	if len(returns) > 0 && returns[0].Interface() != nil {
-		err = returns[0].Interface().(error)
-		return errorResponse(response, err.Error())
-	}
-	responseData, err := actualCodec.Encode(replyv)
-	if err != nil {
-		return errorResponse(response, err.Error())
+		return returns[0].Interface().(error)
 	}
-
-	response.StatusCode = protocol.StatusOK
-	response.Data = responseData
-	return response
-
+	return nil
 }
 
-// errorResponse 出错的响应
-func errorResponse(message *protocol.Message, err string) *protocol.Message {
-	message.Error = err
-	message.StatusCode = protocol.StatusError
+// errorResponse 出错的响应，不带状态码的错误为StatusError
+func errorResponse(message *protocol.Message, err error) *protocol.Message {
+	status.SetMessage(message, err)
 	message.Data = message.Data[:0]
 	return message
 }
@@ -439,10 +623,8 @@ func newValue(t reflect.Type) interface{} {
 }
 
 // writeErrorResonse 写入出错响应
-func (s *SGServer) writeErrorResponse(response *protocol.Message, w io.Writer, err string) {
-	response.Error = err
-	response.StatusCode = protocol.StatusError
-	response.Data = response.Data[:0]
+func (s *SGServer) writeErrorResponse(response *protocol.Message, w io.Writer, err error) {
+	errorResponse(response, err)
 	_, _ = w.Write(protocol.EncodeMessage(s.Option.ProtocolType, response))
 }
 
@@ -450,12 +632,12 @@ func (s *SGServer) writeErrorResponse(response *protocol.Message, w io.Writer, e
 func (s *SGServer) writeResponse(ctx context.Context, tr transport.Transport, response *protocol.Message) {
 	deadline, ok := ctx.Deadline()
 	if ok && time.Now().After(deadline) {
-		log.Println("pass deadline,give up write response")
+		logger.FromContext(ctx).Warn("pass deadline, give up write response")
 		return
 	}
 	_, err := tr.Write(protocol.EncodeMessage(s.Option.ProtocolType, response))
 	if err != nil {
-		log.Println("write response error:" + err.Error())
+		logger.FromContext(ctx).Warn("write response error", logger.Err(err))
 	}
 }
 
@@ -2,26 +2,121 @@ package server
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"github.com/lincx-911/lincxrpc/auth"
+	"github.com/lincx-911/lincxrpc/common/stats"
+	"github.com/lincx-911/lincxrpc/health"
 	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/status"
 	"github.com/lincx-911/lincxrpc/transport"
 )
 
+// ServerAuthInterceptor 使用AuthFunc校验请求元数据中的凭证，需要调用方信息和授权时使用AuthWrapper
 type ServerAuthInterceptor struct {
 	defaultServerInterceptor
 	authFunc AuthFunc
 }
 
+// NewServerAuthInterceptor 创建鉴权拦截器
+func NewServerAuthInterceptor(authFunc AuthFunc) *ServerAuthInterceptor {
+	return &ServerAuthInterceptor{authFunc: authFunc}
+}
+
 func (sai *ServerAuthInterceptor) WrapHandleRequest(s *SGServer, requestFunc HandleRequestFunc) HandleRequestFunc {
 	return func(ctx context.Context, request *protocol.Message, response *protocol.Message, tr transport.Transport) {
-		if auth, ok := ctx.Value(protocol.AuthKey).(string); ok {
+		if request.MessageType == protocol.MessageTypeHeartbeat {
+			requestFunc(ctx, request, response, tr)
+			return
+		}
+		if token, ok := request.MetaData[protocol.AuthKey].(string); ok {
 			//鉴权通过则执行业务逻辑
-			if sai.authFunc(auth) {
-				requestFunc(ctx, response, response, tr)
+			if sai.authFunc(token) {
+				requestFunc(ctx, request, response, tr)
 				return
 			}
 		}
 		//鉴权失败则返回异常
-		s.writeErrorResponse(response, tr, "auth failed")
+		s.writeResponse(ctx, tr, errorResponse(response, status.New(protocol.StatusUnauthenticated, "auth failed")))
 	}
 }
 
+// AuthOption 鉴权拦截器配置项
+type AuthOption struct {
+	Authenticator auth.Authenticator // 必须设置
+	Authorizer    auth.Authorizer    // 为空时鉴权通过即可调用所有方法
+	Public        []string           // 不需要鉴权的方法，Service.Method的模式，健康检查服务总是不需要鉴权
+}
+
+// AuthWrapper 校验请求元数据中的凭证，通过后将调用方放入ctx，服务方法中可以通过auth.FromContext获取
+// 缺少或者无效的凭证返回StatusUnauthenticated，授权失败返回StatusPermissionDenied
+type AuthWrapper struct {
+	defaultServerInterceptor
+	option AuthOption
+}
+
+// NewAuthWrapper 创建鉴权拦截器
+func NewAuthWrapper(option AuthOption) *AuthWrapper {
+	return &AuthWrapper{option: option}
+}
+
+func (w *AuthWrapper) WrapHandleRequest(s *SGServer, requestFunc HandleRequestFunc) HandleRequestFunc {
+	return func(ctx context.Context, request *protocol.Message, response *protocol.Message, tr transport.Transport) {
+		if !w.requiresAuth(request) {
+			requestFunc(ctx, request, response, tr)
+			return
+		}
+		serviceMethod := request.ServiceName + "." + request.MethodName
+		token, _ := request.MetaData[protocol.AuthKey].(string)
+		if token == "" {
+			s.writeResponse(ctx, tr, errorResponse(response, status.New(protocol.StatusUnauthenticated, auth.ErrMissingCredentials.Error())))
+			return
+		}
+		principal, err := w.option.Authenticator.Authenticate(ctx, token)
+		if err != nil {
+			s.writeResponse(ctx, tr, errorResponse(response, status.New(protocol.StatusUnauthenticated, err.Error())))
+			return
+		}
+		if w.option.Authorizer != nil {
+			if err := w.option.Authorizer.Authorize(ctx, principal, serviceMethod); err != nil {
+				s.writeResponse(ctx, tr, errorResponse(response, status.New(protocol.StatusPermissionDenied, err.Error())))
+				return
+			}
+		}
+		stats.ServerFromContext(ctx).SetPrincipal(principal.Name)
+		requestFunc(auth.NewContext(ctx, principal), request, response, tr)
+	}
+}
+
+// requiresAuth 请求是否需要鉴权，心跳、健康检查和公开的方法不需要
+func (w *AuthWrapper) requiresAuth(request *protocol.Message) bool {
+	return request.MessageType != protocol.MessageTypeHeartbeat && request.ServiceName != health.ServiceName &&
+		!auth.MatchMethod(w.option.Public, request.ServiceName+"."+request.MethodName)
+}
+
+// authPending 配置了AuthWrapper且请求需要鉴权，但是还没有鉴权通过，说明调用方在AuthWrapper的外层
+func (s *SGServer) authPending(ctx context.Context, request *protocol.Message) bool {
+	if stats.ServerFromContext(ctx).Principal() != "" {
+		return false
+	}
+	for _, w := range s.Option.Wrappers {
+		if aw, ok := w.(*AuthWrapper); ok && aw.requiresAuth(request) {
+			return true
+		}
+	}
+	return false
+}
+
+// callerKey 用于区分调用方的key，和拦截器的顺序无关：
+// 鉴权通过时为调用方的名称，鉴权还没有执行时为请求中凭证的摘要，没有凭证时为空
+func callerKey(ctx context.Context, request *protocol.Message) string {
+	if principal := stats.ServerFromContext(ctx).Principal(); principal != "" {
+		return "principal:" + principal
+	}
+	if token, _ := request.MetaData[protocol.AuthKey].(string); token != "" {
+		sum := sha256.Sum256([]byte(token))
+		return "token:" + hex.EncodeToString(sum[:16])
+	}
+	return ""
+}
@@ -1,9 +1,13 @@
 package server
 
 import (
+	"context"
+	"crypto/tls"
 	"time"
 
 	"github.com/lincx-911/lincxrpc/codec"
+	"github.com/lincx-911/lincxrpc/logger"
+	"github.com/lincx-911/lincxrpc/metrics"
 	"github.com/lincx-911/lincxrpc/protocol"
 	"github.com/lincx-911/lincxrpc/registry"
 	"github.com/lincx-911/lincxrpc/transport"
@@ -11,6 +15,9 @@ import (
 
 type ShutDownHook func(s *SGServer)
 
+// PanicHandler 服务方法panic时调用，p为recover得到的值，stack为panic时的调用栈
+type PanicHandler func(ctx context.Context, request *protocol.Message, p interface{}, stack []byte)
+
 // Option server配置项
 type Option struct {
 	AppKey         string
@@ -25,6 +32,17 @@ type Option struct {
 	CompressType   protocol.CompressType
 	TransportType  transport.TransportType
 	HttpsConf HttpsOption
+	DisableReflection bool // 不注册反射服务
+	PanicHandler PanicHandler // 服务方法panic时的回调，无论是否设置都会打印调用栈并返回StatusInternal
+	Weight    int           // 负载均衡的权重，0时使用selector.DefaultWeight，只对RandomSelector和RoundRobinSelector生效
+	WarmUp    time.Duration // 预热时间，启动后权重在这段时间内从很小逐渐增加到Weight
+	DrainWait time.Duration // 关闭时在注册中心标记draining后等待客户端感知的时间，之后才停止接受连接
+	AdminAddr        string            // 管理端口的监听地址，比如":9090"，为空时不启动
+	MetricsRegistry  *metrics.Registry // 管理端口暴露的指标，为空时使用metrics.DefaultRegistry
+	Logger           logger.Logger     // 服务端的日志，为空时使用全局日志
+	MinRequestBudget time.Duration     // 请求剩余时间少于该值时直接返回StatusDeadlineExceeded，不再处理
+	TLSConfig        *tls.Config       // 不为空时rpc端口只接受TLS连接，设置ClientAuth后可以通过peer.Identity获取客户端证书的CommonName
+	MaxConnRequests  int               // 每个连接同时处理的最大请求数，达到后暂停读取该连接的请求，0表示不限制
 }
 
 // HttpsOption 配置https
@@ -0,0 +1,235 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/logger"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/registry"
+	"github.com/lincx-911/lincxrpc/transport"
+)
+
+const (
+	warmUpRefreshes  = 10          // 预热期间更新预热进度的次数
+	minWarmUpRefresh = time.Second // 更新预热进度的最小间隔
+)
+
+// Shutdown 优雅关闭服务端：
+// 在注册中心把提供者标记为draining并等待DrainWait，停止接受新连接，通知已连接的客户端不再发送新请求，
+// 等待网关和处理中的请求完成或者ctx结束，最后关闭所有连接并从注册中心卸载。
+// 重复调用会等待第一次调用完成
+func (s *SGServer) Shutdown(ctx context.Context) error {
+	if !atomic.CompareAndSwapInt32(&s.shutdownStarted, 0, 1) {
+		select {
+		case <-s.shutdownDone:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	defer close(s.shutdownDone)
+
+	s.health.Shutdown()
+	s.markDraining()
+	if s.Option.DrainWait > 0 {
+		// 等待客户端从注册中心感知到draining，期间仍然正常处理请求
+		timer := time.NewTimer(s.Option.DrainWait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+		timer.Stop()
+	}
+	// 之后到达的请求都会被拒绝
+	atomic.StoreInt32(&s.inShutdown, 1)
+
+	s.mutex.Lock()
+	if s.tr != nil {
+		if err := s.tr.Close(); err != nil {
+			s.log().Warn("close listener error", logger.Err(err))
+		}
+	}
+	s.mutex.Unlock()
+
+	s.goAway()
+	s.shutdownGateways(ctx)
+	err := s.waitRequests(ctx)
+	if err != nil {
+		s.log().Warn("shutdown: requests still in process", logger.F("requests", atomic.LoadInt64(&s.requestInProcess)), logger.Err(err))
+	}
+
+	closeFunc := s.close
+	for _, w := range s.Option.Wrappers {
+		closeFunc = w.WrapClose(s, closeFunc)
+	}
+	if closeErr := closeFunc(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Close 关闭服务端，最多等待ShutDownWait
+func (s *SGServer) Close() error {
+	ctx := context.Background()
+	if s.Option.ShutDownWait > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.Option.ShutDownWait)
+		defer cancel()
+	}
+	return s.Shutdown(ctx)
+}
+
+// close 关闭管理端口以及所有连接
+func (s *SGServer) close() error {
+	s.mutex.Lock()
+	if s.admin != nil {
+		_ = s.admin.Close()
+	}
+	s.mutex.Unlock()
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	for tr := range s.conns {
+		_ = tr.Close()
+	}
+	return nil
+}
+
+func (s *SGServer) isShutdown() bool {
+	return atomic.LoadInt32(&s.inShutdown) == 1
+}
+
+// provider 当前服务端在注册中心中的提供者
+func (s *SGServer) provider(meta map[string]interface{}) registry.Provider {
+	return registry.Provider{
+		ProviderKey: s.network + "@" + s.addr,
+		Network:     s.network,
+		Addr:        s.addr,
+		Meta:        meta,
+	}
+}
+
+// markDraining 在注册中心的元数据中标记draining，客户端不会再选择该提供者
+func (s *SGServer) markDraining() {
+	if s.Option.Registry == nil || s.network == "" {
+		return
+	}
+	s.mutex.Lock()
+	meta := make(map[string]interface{}, len(s.meta)+1)
+	for k, v := range s.meta {
+		meta[k] = v
+	}
+	s.mutex.Unlock()
+	meta[protocol.ProviderDrainingKey] = true
+	s.Option.Registry.Register(s.Option.RegisterOption, s.provider(meta))
+}
+
+// warmUp 预热期间定期在注册中心更新预热已经进行的时间，之后发现该提供者的客户端从实际的进度开始增加权重；
+// 预热结束后去掉预热信息，客户端直接使用完整的权重
+func (s *SGServer) warmUp(start time.Time) {
+	interval := s.Option.WarmUp / warmUpRefreshes
+	if interval < minWarmUpRefresh {
+		interval = minWarmUpRefresh
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.shutdownDone:
+			return
+		}
+		elapsed := time.Since(start)
+		finished := elapsed >= s.Option.WarmUp
+		if !s.updateWarmUp(elapsed, finished) || finished {
+			return
+		}
+	}
+}
+
+// updateWarmUp 更新注册中心元数据中的预热已进行时间，finished时去掉预热信息，已经开始关闭时返回false
+func (s *SGServer) updateWarmUp(elapsed time.Duration, finished bool) bool {
+	// 已经开始关闭时不再注册，避免覆盖draining标记
+	if s.Option.Registry == nil || s.network == "" || atomic.LoadInt32(&s.shutdownStarted) == 1 {
+		return false
+	}
+	s.mutex.Lock()
+	if s.meta == nil {
+		// 还没有开始监听
+		s.mutex.Unlock()
+		return true
+	}
+	meta := make(map[string]interface{}, len(s.meta))
+	for k, v := range s.meta {
+		if k != protocol.ProviderWarmUpAge && k != protocol.ProviderWarmUpKey {
+			meta[k] = v
+		}
+	}
+	if !finished {
+		meta[protocol.ProviderWarmUpAge] = int64(elapsed / time.Millisecond)
+		meta[protocol.ProviderWarmUpKey] = int64(s.Option.WarmUp / time.Millisecond)
+	}
+	s.meta = meta
+	s.mutex.Unlock()
+	s.Option.Registry.Register(s.Option.RegisterOption, s.provider(meta))
+	return true
+}
+
+// goAway 通知所有连接上的客户端不要再发送新的请求
+func (s *SGServer) goAway() {
+	msg := protocol.NewMessage(s.Option.ProtocolType)
+	msg.MessageType = protocol.MessageTypeGoAway
+	data := protocol.EncodeMessage(s.Option.ProtocolType, msg)
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	for tr := range s.conns {
+		if _, err := tr.Write(data); err != nil {
+			s.log().Warn("send goaway error", logger.F("peer", tr.RemoteAddr()), logger.Err(err))
+		}
+	}
+}
+
+// trackConn 记录或者移除连接
+func (s *SGServer) trackConn(tr transport.Transport, add bool) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	if add {
+		s.conns[tr] = struct{}{}
+	} else {
+		delete(s.conns, tr)
+	}
+}
+
+// startRequest 开始处理请求，已经开始关闭时返回false
+// 先计数再检查关闭标记，保证Shutdown要么等待这个请求，要么这个请求被拒绝
+func (s *SGServer) startRequest() bool {
+	atomic.AddInt64(&s.requestInProcess, 1)
+	if s.isShutdown() {
+		s.finishRequest()
+		return false
+	}
+	return true
+}
+
+// finishRequest 请求处理完成，处理中的请求数降为0时通知waitRequests
+func (s *SGServer) finishRequest() {
+	if atomic.AddInt64(&s.requestInProcess, -1) == 0 {
+		select {
+		case s.idle <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// waitRequests 等待处理中的请求完成
+func (s *SGServer) waitRequests(ctx context.Context) error {
+	for atomic.LoadInt64(&s.requestInProcess) > 0 {
+		select {
+		case <-s.idle:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/logger"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/registry/memory"
+	"github.com/lincx-911/lincxrpc/transport"
+)
+
+// recordConn 记录服务端写入的数据的连接
+type recordConn struct {
+	transport.Transport
+	mu     sync.Mutex
+	buf    bytes.Buffer
+	closed bool
+}
+
+func (c *recordConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.buf.Write(p)
+}
+
+func (c *recordConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+func (c *recordConn) RemoteAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 9000}
+}
+
+func (c *recordConn) messages(t *testing.T) []*protocol.Message {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var msgs []*protocol.Message
+	r := bytes.NewReader(c.buf.Bytes())
+	for r.Len() > 0 {
+		msg, err := protocol.DecodeMessage(protocol.Default, r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs
+}
+
+func newShutdownServer() *SGServer {
+	option := DefaultOption
+	option.Logger = logger.Nop()
+	option.Registry = memory.NewInMemoryRegistry()
+	option.DrainWait = 0
+	return NewRPCServer(option).(*SGServer)
+}
+
+func TestShutdownDrainsRequests(t *testing.T) {
+	s := newShutdownServer()
+	conn := &recordConn{}
+	s.trackConn(conn, true)
+	if !s.startRequest() {
+		t.Fatal("request rejected before shutdown")
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- s.Shutdown(context.Background()) }()
+
+	// 等待Shutdown开始拒绝新请求
+	deadline := time.Now().Add(time.Second)
+	for !s.isShutdown() {
+		if time.Now().After(deadline) {
+			t.Fatal("shutdown did not start")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if s.startRequest() {
+		t.Fatal("request accepted during shutdown")
+	}
+	select {
+	case err := <-done:
+		t.Fatalf("Shutdown returned %v with a request in process", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	s.finishRequest()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Shutdown did not return after the request finished")
+	}
+
+	msgs := conn.messages(t)
+	if len(msgs) != 1 || msgs[0].MessageType != protocol.MessageTypeGoAway {
+		t.Fatalf("messages = %v, want a single goaway", msgs)
+	}
+	if !conn.closed {
+		t.Fatal("connection not closed after shutdown")
+	}
+}
+
+func TestShutdownDeadline(t *testing.T) {
+	tests := []struct {
+		name     string
+		requests int
+		want     error
+	}{
+		{"idle", 0, nil},
+		{"in process", 1, context.DeadlineExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newShutdownServer()
+			for i := 0; i < tt.requests; i++ {
+				s.startRequest()
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			if err := s.Shutdown(ctx); err != tt.want {
+				t.Fatalf("Shutdown() = %v, want %v", err, tt.want)
+			}
+			// 重复调用等待第一次调用完成
+			if err := s.Shutdown(context.Background()); err != nil {
+				t.Fatalf("second Shutdown() = %v", err)
+			}
+		})
+	}
+}
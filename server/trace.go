@@ -0,0 +1,74 @@
+package server
+
+import (
+	"context"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/common/peer"
+	"github.com/lincx-911/lincxrpc/common/stats"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/status"
+	"github.com/lincx-911/lincxrpc/trace"
+	"github.com/lincx-911/lincxrpc/transport"
+)
+
+// TraceWrapper 从请求的元数据中读取上游的span上下文，为每个请求创建server span
+// 反序列化和序列化的耗时记录为子span，服务方法中可以通过trace.SpanFromContext获取当前span
+type TraceWrapper struct {
+	defaultServerInterceptor
+	tracer *trace.Tracer
+}
+
+// NewTraceWrapper 创建追踪拦截器
+func NewTraceWrapper(tracer *trace.Tracer) *TraceWrapper {
+	return &TraceWrapper{tracer: tracer}
+}
+
+func (w *TraceWrapper) WrapHandleRequest(s *SGServer, requestFunc HandleRequestFunc) HandleRequestFunc {
+	return func(ctx context.Context, request *protocol.Message, response *protocol.Message, tr transport.Transport) {
+		if request.MessageType == protocol.MessageTypeHeartbeat {
+			requestFunc(ctx, request, response, tr)
+			return
+		}
+		if sc, ok := trace.Extract(request.MetaData); ok {
+			ctx = trace.ContextWithRemote(ctx, sc)
+		}
+		ctx, span := w.tracer.Start(ctx, request.ServiceName+"."+request.MethodName, trace.SpanKindServer)
+		span.SetAttribute("rpc.system", "lincxrpc")
+		span.SetAttribute("rpc.service", request.ServiceName)
+		span.SetAttribute("rpc.method", request.MethodName)
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			span.SetAttribute("net.peer.addr", p.Addr.String())
+		}
+		st := stats.ServerFromContext(ctx)
+		st.Mark(stats.RequestReceived)
+
+		requestFunc(ctx, request, response, tr)
+		end := time.Now()
+
+		w.phase(ctx, "decode", st, stats.DecodeStart, stats.DecodeEnd)
+		w.phase(ctx, "encode", st, stats.EncodeStart, stats.EncodeEnd)
+		span.SetAttribute("rpc.request_bytes", st.RequestBytes())
+		span.SetAttribute("rpc.response_bytes", st.ResponseBytes())
+		code := protocol.StatusOK
+		if se := status.FromMessage(response); se != nil {
+			code = se.Code
+			span.SetError(se, code)
+		}
+		span.SetAttribute("rpc.status_code", code.String())
+		span.FinishAt(end)
+	}
+}
+
+func (w *TraceWrapper) phase(ctx context.Context, name string, st *stats.RPCStats, from, to stats.Mark) {
+	start, ok := st.Time(from)
+	if !ok {
+		return
+	}
+	end, ok := st.Time(to)
+	if !ok {
+		return
+	}
+	_, span := w.tracer.StartAt(ctx, name, trace.SpanKindInternal, start)
+	span.FinishAt(end)
+}
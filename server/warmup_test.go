@@ -0,0 +1,60 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/common/metadata"
+	"github.com/lincx-911/lincxrpc/logger"
+	"github.com/lincx-911/lincxrpc/protocol"
+	"github.com/lincx-911/lincxrpc/registry/memory"
+)
+
+func TestUpdateWarmUp(t *testing.T) {
+	option := DefaultOption
+	option.Logger = logger.Nop()
+	option.Registry = memory.NewInMemoryRegistry()
+	option.WarmUp = 10 * time.Second
+	s := NewRPCServer(option).(*SGServer)
+	s.network, s.addr = "tcp", "127.0.0.1:8080"
+	s.meta = map[string]interface{}{"tags": "a", protocol.ProviderWarmUpAge: int64(0), protocol.ProviderWarmUpKey: int64(10000)}
+
+	providerMeta := func() map[string]interface{} {
+		for _, p := range option.Registry.GetServiceList(option.RegisterOption.AppKey) {
+			if p.ProviderKey == "tcp@127.0.0.1:8080" {
+				return p.Meta
+			}
+		}
+		t.Fatal("provider not registered")
+		return nil
+	}
+
+	if !s.updateWarmUp(4*time.Second, false) {
+		t.Fatal("updateWarmUp returned false")
+	}
+	meta := providerMeta()
+	if age, _ := metadata.ToInt(meta[protocol.ProviderWarmUpAge]); age != 4000 {
+		t.Fatalf("age = %d, want 4000", age)
+	}
+	if meta["tags"] != "a" {
+		t.Fatalf("other meta lost: %v", meta)
+	}
+
+	s.updateWarmUp(10*time.Second, true)
+	meta = providerMeta()
+	if _, ok := meta[protocol.ProviderWarmUpAge]; ok {
+		t.Fatalf("warm-up age still registered: %v", meta)
+	}
+	if _, ok := meta[protocol.ProviderWarmUpKey]; ok {
+		t.Fatalf("warm-up duration still registered: %v", meta)
+	}
+
+	// 开始关闭之后不再注册，避免覆盖draining标记
+	s.shutdownStarted = 1
+	if s.updateWarmUp(5*time.Second, false) {
+		t.Fatal("updateWarmUp registered after shutdown started")
+	}
+	if _, ok := providerMeta()[protocol.ProviderWarmUpAge]; ok {
+		t.Fatal("warm-up age registered after shutdown started")
+	}
+}
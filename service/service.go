@@ -5,6 +5,8 @@ import (
 	"errors"
 )
 
+//go:generate go run ../cmd/lincxrpc gen -type Arith
+
 type Arith struct{}
 
 type Args struct {
@@ -0,0 +1,73 @@
+// Code generated by lincxrpc gen. DO NOT EDIT.
+
+package servicerpc
+
+import (
+	"context"
+
+	"github.com/lincx-911/lincxrpc/client"
+	"github.com/lincx-911/lincxrpc/server"
+	"github.com/lincx-911/lincxrpc/service"
+)
+
+// ArithServiceName Arith的服务名
+const ArithServiceName = "Arith"
+
+// ArithClient Arith服务的客户端
+type ArithClient struct {
+	c client.SGClient
+}
+
+// NewArithClient 使用SGClient创建Arith服务的客户端
+func NewArithClient(c client.SGClient) *ArithClient {
+	return &ArithClient{c: c}
+}
+
+// Add 调用Arith.Add
+func (c *ArithClient) Add(ctx context.Context, arg service.Args) (*service.Reply, error) {
+	reply := new(service.Reply)
+	if err := c.c.Call(ctx, ArithServiceName+".Add", arg, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Divide 调用Arith.Divide
+func (c *ArithClient) Divide(ctx context.Context, arg *service.Args) (*service.Reply, error) {
+	reply := new(service.Reply)
+	if err := c.c.Call(ctx, ArithServiceName+".Divide", arg, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Minus 调用Arith.Minus
+func (c *ArithClient) Minus(ctx context.Context, arg service.Args) (*service.Reply, error) {
+	reply := new(service.Reply)
+	if err := c.c.Call(ctx, ArithServiceName+".Minus", arg, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// Mul 调用Arith.Mul
+func (c *ArithClient) Mul(ctx context.Context, arg service.Args) (*service.Reply, error) {
+	reply := new(service.Reply)
+	if err := c.c.Call(ctx, ArithServiceName+".Mul", arg, reply); err != nil {
+		return nil, err
+	}
+	return reply, nil
+}
+
+// ArithServer Arith服务需要实现的方法
+type ArithServer interface {
+	Add(ctx context.Context, arg service.Args, reply *service.Reply) error
+	Divide(ctx context.Context, arg *service.Args, reply *service.Reply) error
+	Minus(ctx context.Context, arg service.Args, reply *service.Reply) error
+	Mul(ctx context.Context, arg service.Args, reply *service.Reply) error
+}
+
+// RegisterArithServer 以ArithServiceName注册Arith服务
+func RegisterArithServer(s server.RPCServer, srv ArithServer) error {
+	return s.RegisterName(ArithServiceName, srv)
+}
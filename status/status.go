@@ -0,0 +1,197 @@
+// Package status 带状态码的错误，服务端返回的Error会连同状态码和详细信息一起传给客户端
+package status
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/common/metadata"
+	"github.com/lincx-911/lincxrpc/protocol"
+)
+
+// 通用的详细信息
+const (
+	DetailReason     = "reason"         // 错误原因，比如限流时为rate_limited
+	DetailRetryAfter = "retry_after_ms" // 建议等待多久之后重试，单位为毫秒
+)
+
+// Error 带状态码的错误
+type Error struct {
+	Code    protocol.StatusCode
+	Message string
+	Details map[string]interface{}
+}
+
+// New 创建错误
+func New(code protocol.StatusCode, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Errorf 使用格式化字符串创建错误
+func Errorf(code protocol.StatusCode, format string, a ...interface{}) *Error {
+	return New(code, fmt.Sprintf(format, a...))
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("rpc error: code = %s desc = %s", e.Code, e.Message)
+}
+
+// WithDetails 返回附带了详细信息的副本
+func (e *Error) WithDetails(details map[string]interface{}) *Error {
+	res := &Error{Code: e.Code, Message: e.Message, Details: make(map[string]interface{}, len(e.Details)+len(details))}
+	for k, v := range e.Details {
+		res.Details[k] = v
+	}
+	for k, v := range details {
+		res.Details[k] = v
+	}
+	return res
+}
+
+// Detail 获取详细信息
+func (e *Error) Detail(key string) (interface{}, bool) {
+	v, ok := e.Details[key]
+	return v, ok
+}
+
+// FromError 从错误链中找到*Error
+func FromError(err error) (*Error, bool) {
+	var se *Error
+	if errors.As(err, &se) {
+		return se, true
+	}
+	return nil, false
+}
+
+// Convert 转换成*Error，不带状态码的错误按Code的规则转换
+func Convert(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	if se, ok := FromError(err); ok {
+		return se
+	}
+	return New(Code(err), err.Error())
+}
+
+// Code 错误的状态码，nil为StatusOK，context的错误转换为对应的状态码，其他错误为StatusError
+func Code(err error) protocol.StatusCode {
+	if err == nil {
+		return protocol.StatusOK
+	}
+	if se, ok := FromError(err); ok {
+		return se.Code
+	}
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return protocol.StatusDeadlineExceeded
+	case errors.Is(err, context.Canceled):
+		return protocol.StatusCanceled
+	}
+	return protocol.StatusError
+}
+
+// IsRetryable 错误是否可以稍后重试
+func IsRetryable(err error) bool {
+	switch Code(err) {
+	case protocol.StatusUnavailable, protocol.StatusResourceExhausted, protocol.StatusAborted:
+		return true
+	}
+	return false
+}
+
+// IsCallerError 是否是调用方的问题导致的错误，这类错误不说明服务端异常
+// 调用方超过限额时的StatusResourceExhausted也属于这一类
+func IsCallerError(err error) bool {
+	switch Code(err) {
+	case protocol.StatusCanceled, protocol.StatusInvalidArgument, protocol.StatusNotFound,
+		protocol.StatusAlreadyExists, protocol.StatusPermissionDenied, protocol.StatusFailedPrecondition,
+		protocol.StatusOutOfRange, protocol.StatusUnimplemented, protocol.StatusUnauthenticated,
+		protocol.StatusResourceExhausted:
+		return true
+	}
+	return false
+}
+
+// Reason 错误详细信息中的原因，没有时为空
+func Reason(err error) string {
+	se, ok := FromError(err)
+	if !ok {
+		return ""
+	}
+	reason, _ := se.Details[DetailReason].(string)
+	return reason
+}
+
+// RetryAfter 服务端建议的重试等待时间
+func RetryAfter(err error) (time.Duration, bool) {
+	se, ok := FromError(err)
+	if !ok {
+		return 0, false
+	}
+	ms, ok := metadata.Int(se.Details, DetailRetryAfter)
+	if !ok {
+		return 0, false
+	}
+	return time.Duration(ms) * time.Millisecond, true
+}
+
+// HTTPStatus 状态码对应的http状态码
+func HTTPStatus(code protocol.StatusCode) int {
+	switch code {
+	case protocol.StatusOK:
+		return http.StatusOK
+	case protocol.StatusCanceled:
+		return 499
+	case protocol.StatusInvalidArgument, protocol.StatusFailedPrecondition, protocol.StatusOutOfRange:
+		return http.StatusBadRequest
+	case protocol.StatusDeadlineExceeded:
+		return http.StatusGatewayTimeout
+	case protocol.StatusNotFound:
+		return http.StatusNotFound
+	case protocol.StatusAlreadyExists, protocol.StatusAborted:
+		return http.StatusConflict
+	case protocol.StatusPermissionDenied:
+		return http.StatusForbidden
+	case protocol.StatusResourceExhausted:
+		return http.StatusTooManyRequests
+	case protocol.StatusUnimplemented:
+		return http.StatusNotImplemented
+	case protocol.StatusUnavailable:
+		return http.StatusServiceUnavailable
+	case protocol.StatusUnauthenticated:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// FromMessage 从响应中还原错误，成功的响应返回nil
+func FromMessage(message *protocol.Message) *Error {
+	if message.StatusCode == protocol.StatusOK && message.Error == "" {
+		return nil
+	}
+	code := message.StatusCode
+	if code == protocol.StatusOK {
+		code = protocol.StatusError
+	}
+	return &Error{Code: code, Message: message.Error, Details: message.ErrorDetails}
+}
+
+// SetMessage 把错误写入响应
+func SetMessage(message *protocol.Message, err error) {
+	se := Convert(err)
+	message.StatusCode = se.Code
+	if message.StatusCode == protocol.StatusOK {
+		message.StatusCode = protocol.StatusError
+	}
+	message.Error = se.Message
+	if message.Error == "" {
+		// 旧版本的客户端只通过Error判断是否出错
+		message.Error = message.StatusCode.String()
+	}
+	message.ErrorDetails = se.Details
+}
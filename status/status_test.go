@@ -0,0 +1,153 @@
+package status
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/protocol"
+)
+
+// allCodes 除StatusOK以外的所有状态码
+var allCodes = []protocol.StatusCode{
+	protocol.StatusError, protocol.StatusCanceled, protocol.StatusInvalidArgument, protocol.StatusDeadlineExceeded,
+	protocol.StatusNotFound, protocol.StatusAlreadyExists, protocol.StatusPermissionDenied, protocol.StatusResourceExhausted,
+	protocol.StatusFailedPrecondition, protocol.StatusAborted, protocol.StatusOutOfRange, protocol.StatusUnimplemented,
+	protocol.StatusInternal, protocol.StatusUnavailable, protocol.StatusDataLoss, protocol.StatusUnauthenticated,
+}
+
+// roundTrip 把错误写入响应，编码后再解码还原
+func roundTrip(t *testing.T, err error) *Error {
+	response := protocol.NewMessage(protocol.Default)
+	response.MessageType = protocol.MessageTypeResponse
+	SetMessage(response, err)
+	decoded, decodeErr := protocol.DecodeMessage(protocol.Default, bytes.NewReader(protocol.EncodeMessage(protocol.Default, response)))
+	if decodeErr != nil {
+		t.Fatal(decodeErr)
+	}
+	return FromMessage(decoded)
+}
+
+func TestStatusRoundTrip(t *testing.T) {
+	for _, code := range allCodes {
+		t.Run(code.String(), func(t *testing.T) {
+			got := roundTrip(t, Errorf(code, "failed with %s", code))
+			if got == nil || got.Code != code || got.Message != "failed with "+code.String() {
+				t.Fatalf("round trip = %+v, want code %s", got, code)
+			}
+			parsed, err := protocol.ParseStatusCode(code.String())
+			if err != nil || parsed != code {
+				t.Fatalf("ParseStatusCode(%q) = %v, %v", code.String(), parsed, err)
+			}
+		})
+	}
+}
+
+func TestStatusRoundTripDetails(t *testing.T) {
+	err := New(protocol.StatusResourceExhausted, "rate limited").WithDetails(map[string]interface{}{
+		DetailReason:     "rate_limited",
+		DetailRetryAfter: int64(150),
+	})
+	got := roundTrip(t, fmt.Errorf("call Arith.Add: %w", err))
+	if got.Code != protocol.StatusResourceExhausted || Reason(got) != "rate_limited" {
+		t.Fatalf("round trip = %+v", got)
+	}
+	// msgpack解码后整数的类型会变，RetryAfter仍然能读取
+	if d, ok := RetryAfter(got); !ok || d != 150*time.Millisecond {
+		t.Fatalf("RetryAfter = %v, %v, want 150ms", d, ok)
+	}
+}
+
+func TestStatusPlainErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		code protocol.StatusCode
+	}{
+		{"nil", nil, protocol.StatusOK},
+		{"plain", errors.New("boom"), protocol.StatusError},
+		{"deadline", context.DeadlineExceeded, protocol.StatusDeadlineExceeded},
+		{"wrapped deadline", fmt.Errorf("call: %w", context.DeadlineExceeded), protocol.StatusDeadlineExceeded},
+		{"canceled", context.Canceled, protocol.StatusCanceled},
+		{"wrapped status", fmt.Errorf("call: %w", New(protocol.StatusNotFound, "x")), protocol.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Code(tt.err); got != tt.code {
+				t.Fatalf("Code() = %s, want %s", got, tt.code)
+			}
+			if tt.err == nil {
+				return
+			}
+			if got := roundTrip(t, tt.err); got.Code != tt.code {
+				t.Fatalf("round trip code = %s, want %s", got.Code, tt.code)
+			}
+		})
+	}
+
+	// 没有消息的错误仍然写入Error，旧版本客户端据此判断失败
+	got := roundTrip(t, New(protocol.StatusOK, ""))
+	if got.Code != protocol.StatusError || got.Message != protocol.StatusError.String() {
+		t.Fatalf("empty error round trip = %+v", got)
+	}
+	ok := protocol.NewMessage(protocol.Default)
+	if FromMessage(ok) != nil {
+		t.Fatal("successful response converted to an error")
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		code protocol.StatusCode
+		want int
+	}{
+		{protocol.StatusOK, http.StatusOK},
+		{protocol.StatusError, http.StatusInternalServerError},
+		{protocol.StatusCanceled, 499},
+		{protocol.StatusInvalidArgument, http.StatusBadRequest},
+		{protocol.StatusDeadlineExceeded, http.StatusGatewayTimeout},
+		{protocol.StatusNotFound, http.StatusNotFound},
+		{protocol.StatusAlreadyExists, http.StatusConflict},
+		{protocol.StatusPermissionDenied, http.StatusForbidden},
+		{protocol.StatusResourceExhausted, http.StatusTooManyRequests},
+		{protocol.StatusFailedPrecondition, http.StatusBadRequest},
+		{protocol.StatusAborted, http.StatusConflict},
+		{protocol.StatusOutOfRange, http.StatusBadRequest},
+		{protocol.StatusUnimplemented, http.StatusNotImplemented},
+		{protocol.StatusInternal, http.StatusInternalServerError},
+		{protocol.StatusUnavailable, http.StatusServiceUnavailable},
+		{protocol.StatusDataLoss, http.StatusInternalServerError},
+		{protocol.StatusUnauthenticated, http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		if got := HTTPStatus(tt.code); got != tt.want {
+			t.Errorf("HTTPStatus(%s) = %d, want %d", tt.code, got, tt.want)
+		}
+	}
+}
+
+func TestRetryableAndCallerErrors(t *testing.T) {
+	tests := []struct {
+		code      protocol.StatusCode
+		retryable bool
+		caller    bool
+	}{
+		{protocol.StatusUnavailable, true, false},
+		{protocol.StatusResourceExhausted, true, true},
+		{protocol.StatusAborted, true, false},
+		{protocol.StatusInternal, false, false},
+		{protocol.StatusInvalidArgument, false, true},
+		{protocol.StatusUnauthenticated, false, true},
+		{protocol.StatusDeadlineExceeded, false, false},
+	}
+	for _, tt := range tests {
+		err := New(tt.code, "x")
+		if IsRetryable(err) != tt.retryable || IsCallerError(err) != tt.caller {
+			t.Errorf("%s: retryable = %v, caller = %v, want %v, %v", tt.code, IsRetryable(err), IsCallerError(err), tt.retryable, tt.caller)
+		}
+	}
+}
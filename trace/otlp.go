@@ -0,0 +1,321 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/logger"
+)
+
+// OTLPOption OTLPExporter配置项
+type OTLPOption struct {
+	Endpoint      string            // 比如 http://localhost:4318/v1/traces
+	ServiceName   string            // 作为resource的service.name
+	Headers       map[string]string // 附加的http头，比如鉴权信息
+	BatchSize     int               // 攒够这么多span就发送一次
+	FlushInterval time.Duration     // 最长的发送间隔
+	QueueSize     int               // 等待发送的span上限，超过后丢弃
+	Timeout       time.Duration     // 单次发送的超时时间
+	Client        *http.Client
+}
+
+// DefaultOTLPOption 默认
+var DefaultOTLPOption = OTLPOption{
+	Endpoint:      "http://localhost:4318/v1/traces",
+	BatchSize:     512,
+	FlushInterval: 5 * time.Second,
+	QueueSize:     2048,
+	Timeout:       10 * time.Second,
+}
+
+// OTLPExporter 以OTLP/HTTP JSON格式批量发送span
+type OTLPExporter struct {
+	option  OTLPOption
+	mu      sync.Mutex
+	queue   []*Span
+	dropped int
+	flushCh chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+	once    sync.Once
+}
+
+// NewOTLPExporter 创建OTLPExporter并启动后台发送
+func NewOTLPExporter(option OTLPOption) *OTLPExporter {
+	if option.Endpoint == "" {
+		option.Endpoint = DefaultOTLPOption.Endpoint
+	}
+	if option.BatchSize <= 0 {
+		option.BatchSize = DefaultOTLPOption.BatchSize
+	}
+	if option.FlushInterval <= 0 {
+		option.FlushInterval = DefaultOTLPOption.FlushInterval
+	}
+	if option.QueueSize <= 0 {
+		option.QueueSize = DefaultOTLPOption.QueueSize
+	}
+	if option.Timeout <= 0 {
+		option.Timeout = DefaultOTLPOption.Timeout
+	}
+	if option.Client == nil {
+		option.Client = &http.Client{}
+	}
+	e := &OTLPExporter{
+		option:  option,
+		flushCh: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go e.loop()
+	return e
+}
+
+// Export 放入队列，队列满时丢弃
+func (e *OTLPExporter) Export(span *Span) {
+	e.mu.Lock()
+	if len(e.queue) >= e.option.QueueSize {
+		e.dropped++
+		e.mu.Unlock()
+		return
+	}
+	e.queue = append(e.queue, span)
+	full := len(e.queue) >= e.option.BatchSize
+	e.mu.Unlock()
+	if full {
+		select {
+		case e.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Shutdown 停止后台发送并发送剩余的span
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.done) })
+	select {
+	case <-e.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return e.flush(ctx)
+}
+
+func (e *OTLPExporter) loop() {
+	defer close(e.stopped)
+	ticker := time.NewTicker(e.option.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.done:
+			return
+		case <-ticker.C:
+		case <-e.flushCh:
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), e.option.Timeout)
+		if err := e.flush(ctx); err != nil {
+			logger.Warn("export spans error", logger.F("endpoint", e.option.Endpoint), logger.Err(err))
+		}
+		cancel()
+	}
+}
+
+// flush 分批发送队列中所有的span
+func (e *OTLPExporter) flush(ctx context.Context) error {
+	for {
+		e.mu.Lock()
+		n := len(e.queue)
+		if n > e.option.BatchSize {
+			n = e.option.BatchSize
+		}
+		batch := e.queue[:n:n]
+		e.queue = e.queue[n:]
+		dropped := e.dropped
+		e.dropped = 0
+		e.mu.Unlock()
+		if dropped > 0 {
+			logger.Warn("otlp exporter queue is full, spans dropped", logger.F("dropped", dropped))
+		}
+		if len(batch) == 0 {
+			return nil
+		}
+		if err := e.send(ctx, batch); err != nil {
+			return err
+		}
+	}
+}
+
+func (e *OTLPExporter) send(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(e.encode(spans))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, e.option.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range e.option.Headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := e.option.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("otlp endpoint %s returned %s", e.option.Endpoint, resp.Status)
+	}
+	return nil
+}
+
+// 以下是OTLP/HTTP JSON的请求结构，字段名和opentelemetry-proto的JSON映射一致
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              SpanKind       `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"` // 0 unset, 1 ok, 2 error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (e *OTLPExporter) encode(spans []*Span) otlpRequest {
+	var resourceAttrs []otlpKeyValue
+	if e.option.ServiceName != "" {
+		resourceAttrs = otlpAttributes(map[string]interface{}{"service.name": e.option.ServiceName})
+	}
+	out := make([]otlpSpan, 0, len(spans))
+	for _, s := range spans {
+		s.mu.Lock()
+		span := otlpSpan{
+			TraceID:           s.Context.TraceID.String(),
+			SpanID:            s.Context.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes),
+			Status:            otlpStatus{Code: 1},
+		}
+		if s.Parent.IsValid() {
+			span.ParentSpanID = s.Parent.String()
+		}
+		for _, ev := range s.Events {
+			span.Events = append(span.Events, otlpEvent{
+				TimeUnixNano: strconv.FormatInt(ev.Time.UnixNano(), 10),
+				Name:         ev.Name,
+				Attributes:   otlpAttributes(ev.Attributes),
+			})
+		}
+		if s.Err != nil {
+			span.Status = otlpStatus{Code: 2, Message: s.Err.Error()}
+		}
+		s.mu.Unlock()
+		out = append(out, span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: resourceAttrs},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "lincxrpc"}, Spans: out}},
+	}}}
+}
+
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for k, v := range attrs {
+		kvs = append(kvs, otlpKeyValue{Key: k, Value: otlpValueOf(v)})
+	}
+	return kvs
+}
+
+func otlpValueOf(v interface{}) otlpValue {
+	switch x := v.(type) {
+	case string:
+		return otlpValue{StringValue: &x}
+	case bool:
+		return otlpValue{BoolValue: &x}
+	case int:
+		return otlpInt(int64(x))
+	case int32:
+		return otlpInt(int64(x))
+	case int64:
+		return otlpInt(x)
+	case uint32:
+		return otlpInt(int64(x))
+	case float64:
+		return otlpValue{DoubleValue: &x}
+	case float32:
+		f := float64(x)
+		return otlpValue{DoubleValue: &f}
+	case time.Duration:
+		return otlpInt(int64(x))
+	}
+	s := fmt.Sprint(v)
+	return otlpValue{StringValue: &s}
+}
+
+func otlpInt(n int64) otlpValue {
+	s := strconv.FormatInt(n, 10)
+	return otlpValue{IntValue: &s}
+}
@@ -0,0 +1,271 @@
+// Package trace 分布式追踪，span上下文通过Header.MetaData中的W3C traceparent在服务之间传递
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	mrand "math/rand"
+	"sync"
+	"time"
+
+	"github.com/lincx-911/lincxrpc/protocol"
+)
+
+// TraceID 16字节的trace id
+type TraceID [16]byte
+
+// SpanID 8字节的span id
+type SpanID [8]byte
+
+// IsValid 全零的id是无效的
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// String 小写十六进制
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+
+// IsValid 全零的id是无效的
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// String 小写十六进制
+func (s SpanID) String() string { return hex.EncodeToString(s[:]) }
+
+// SpanContext 需要在进程之间传递的span信息
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+	Remote  bool // 从对端传递过来的
+}
+
+// IsValid trace id和span id都有效
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent 编码为W3C traceparent，比如 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent 解析W3C traceparent
+func ParseTraceparent(s string) (SpanContext, error) {
+	var sc SpanContext
+	if len(s) < 55 || s[2] != '-' || s[35] != '-' || s[52] != '-' {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+	version, err := hex.DecodeString(s[:2])
+	if err != nil || version[0] == 0xff || (version[0] == 0 && len(s) != 55) {
+		return sc, fmt.Errorf("invalid traceparent version %q", s)
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(s[3:35])); err != nil {
+		return sc, fmt.Errorf("invalid trace id in traceparent %q", s)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(s[36:52])); err != nil {
+		return sc, fmt.Errorf("invalid span id in traceparent %q", s)
+	}
+	flags, err := hex.DecodeString(s[53:55])
+	if err != nil {
+		return sc, fmt.Errorf("invalid trace flags in traceparent %q", s)
+	}
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("invalid traceparent %q", s)
+	}
+	sc.Sampled = flags[0]&1 == 1
+	sc.Remote = true
+	return sc, nil
+}
+
+// Inject 将span上下文写入元数据
+func Inject(sc SpanContext, meta map[string]interface{}) {
+	if sc.IsValid() && meta != nil {
+		meta[protocol.TraceParentKey] = sc.Traceparent()
+	}
+}
+
+// Extract 从元数据中读取对端的span上下文
+func Extract(meta map[string]interface{}) (SpanContext, bool) {
+	s, ok := meta[protocol.TraceParentKey].(string)
+	if !ok {
+		return SpanContext{}, false
+	}
+	sc, err := ParseTraceparent(s)
+	if err != nil {
+		return SpanContext{}, false
+	}
+	return sc, true
+}
+
+// SpanKind span的类型，取值和OTLP一致
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Event span中的事件
+type Event struct {
+	Name       string
+	Time       time.Time
+	Attributes map[string]interface{}
+}
+
+// Span 一段被追踪的操作，结束后交给Exporter
+type Span struct {
+	mu         sync.Mutex
+	tracer     *Tracer
+	ended      bool
+	Name       string
+	Kind       SpanKind
+	Context    SpanContext
+	Parent     SpanID // 无效时表示根span
+	Start      time.Time
+	End        time.Time
+	Attributes map[string]interface{}
+	Events     []Event
+	Err        error               // 为空时状态为OK
+	StatusCode protocol.StatusCode // 出错时的状态码
+}
+
+// SetAttribute 设置属性
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.Attributes == nil {
+		s.Attributes = make(map[string]interface{})
+	}
+	s.Attributes[key] = value
+	s.mu.Unlock()
+}
+
+// AddEvent 添加事件
+func (s *Span) AddEvent(name string, attrs map[string]interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Events = append(s.Events, Event{Name: name, Time: time.Now(), Attributes: attrs})
+	s.mu.Unlock()
+}
+
+// SetError 记录错误和状态码
+func (s *Span) SetError(err error, code protocol.StatusCode) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.Err = err
+	s.StatusCode = code
+	s.mu.Unlock()
+}
+
+// Finish 以当前时间结束span
+func (s *Span) Finish() {
+	s.FinishAt(time.Now())
+}
+
+// FinishAt 以指定时间结束span，重复调用无效
+func (s *Span) FinishAt(t time.Time) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = t
+	s.mu.Unlock()
+	if s.Context.Sampled && s.tracer.exporter != nil {
+		s.tracer.exporter.Export(s)
+	}
+}
+
+// Option tracer配置项
+type Option struct {
+	Exporter   Exporter
+	SampleRate float64 // 没有上游时的采样率，有上游时跟随上游
+}
+
+// DefaultOption 全部采样
+var DefaultOption = Option{SampleRate: 1}
+
+// Tracer 创建span
+type Tracer struct {
+	exporter   Exporter
+	sampleRate float64
+	mu         sync.Mutex
+	rand       *mrand.Rand
+}
+
+// NewTracer 创建tracer
+func NewTracer(option Option) *Tracer {
+	var seed int64
+	var b [8]byte
+	if _, err := rand.Read(b[:]); err == nil {
+		seed = int64(binary.LittleEndian.Uint64(b[:]))
+	} else {
+		seed = time.Now().UnixNano()
+	}
+	return &Tracer{
+		exporter:   option.Exporter,
+		sampleRate: option.SampleRate,
+		rand:       mrand.New(mrand.NewSource(seed)),
+	}
+}
+
+// Start 创建span，ctx中有span或者对端的span上下文时作为父span，返回的ctx中携带新的span
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	return t.StartAt(ctx, name, kind, time.Now())
+}
+
+// StartAt 以指定的开始时间创建span
+func (t *Tracer) StartAt(ctx context.Context, name string, kind SpanKind, start time.Time) (context.Context, *Span) {
+	span := &Span{tracer: t, Name: name, Kind: kind, Start: start}
+	parent := SpanContextFromContext(ctx)
+	t.mu.Lock()
+	if parent.IsValid() {
+		span.Context.TraceID = parent.TraceID
+		span.Context.Sampled = parent.Sampled
+		span.Parent = parent.SpanID
+	} else {
+		t.rand.Read(span.Context.TraceID[:])
+		span.Context.Sampled = t.rand.Float64() < t.sampleRate
+	}
+	t.rand.Read(span.Context.SpanID[:])
+	t.mu.Unlock()
+	return context.WithValue(ctx, protocol.TraceSpanKey, span), span
+}
+
+// SpanFromContext 获取ctx中当前的span
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(protocol.TraceSpanKey).(*Span)
+	return span
+}
+
+// SpanContextFromContext 获取ctx中当前的span上下文，可能是本地的span也可能是对端传递过来的
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	switch v := ctx.Value(protocol.TraceSpanKey).(type) {
+	case *Span:
+		return v.Context
+	case SpanContext:
+		return v
+	}
+	return SpanContext{}
+}
+
+// ContextWithRemote 将对端传递过来的span上下文放入ctx，之后创建的span以它为父span
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, protocol.TraceSpanKey, sc)
+}
@@ -0,0 +1,82 @@
+package trace
+
+import (
+	"testing"
+
+	"github.com/lincx-911/lincxrpc/protocol"
+)
+
+const (
+	testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	testSpanID  = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		name    string
+		s       string
+		sampled bool
+		ok      bool
+	}{
+		{"sampled", "00-" + testTraceID + "-" + testSpanID + "-01", true, true},
+		{"not sampled", "00-" + testTraceID + "-" + testSpanID + "-00", false, true},
+		{"other flags", "00-" + testTraceID + "-" + testSpanID + "-03", true, true},
+		{"future version with extra fields", "01-" + testTraceID + "-" + testSpanID + "-01-future", true, true},
+		{"version 00 with extra fields", "00-" + testTraceID + "-" + testSpanID + "-01-future", false, false},
+		{"forbidden version", "ff-" + testTraceID + "-" + testSpanID + "-01", false, false},
+		{"too short", "00-" + testTraceID + "-" + testSpanID, false, false},
+		{"bad separator", "00_" + testTraceID + "-" + testSpanID + "-01", false, false},
+		{"bad trace id", "00-" + "zz" + testTraceID[2:] + "-" + testSpanID + "-01", false, false},
+		{"bad span id", "00-" + testTraceID + "-" + "zz" + testSpanID[2:] + "-01", false, false},
+		{"bad flags", "00-" + testTraceID + "-" + testSpanID + "-0x", false, false},
+		{"zero trace id", "00-00000000000000000000000000000000-" + testSpanID + "-01", false, false},
+		{"zero span id", "00-" + testTraceID + "-0000000000000000-01", false, false},
+		{"empty", "", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := ParseTraceparent(tt.s)
+			if !tt.ok {
+				if err == nil {
+					t.Fatalf("ParseTraceparent(%q) = %+v, want error", tt.s, sc)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if sc.TraceID.String() != testTraceID || sc.SpanID.String() != testSpanID {
+				t.Fatalf("ids = %s %s", sc.TraceID, sc.SpanID)
+			}
+			if sc.Sampled != tt.sampled || !sc.Remote {
+				t.Fatalf("sampled = %v, remote = %v, want %v, true", sc.Sampled, sc.Remote, tt.sampled)
+			}
+		})
+	}
+}
+
+func TestTraceparentRoundTrip(t *testing.T) {
+	for _, sampled := range []bool{true, false} {
+		sc := SpanContext{TraceID: TraceID{1, 2, 3}, SpanID: SpanID{4, 5, 6}, Sampled: sampled}
+		meta := map[string]interface{}{}
+		Inject(sc, meta)
+		got, ok := Extract(meta)
+		if !ok {
+			t.Fatalf("Extract(%v) failed", meta)
+		}
+		sc.Remote = true
+		if got != sc {
+			t.Fatalf("round trip = %+v, want %+v", got, sc)
+		}
+	}
+
+	// 无效的span上下文不写入
+	meta := map[string]interface{}{}
+	Inject(SpanContext{}, meta)
+	if len(meta) != 0 {
+		t.Fatalf("invalid span context injected: %v", meta)
+	}
+	if _, ok := Extract(map[string]interface{}{protocol.TraceParentKey: 1}); ok {
+		t.Fatal("non-string traceparent extracted")
+	}
+}
@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"crypto/tls"
 	"io"
 	"net"
 	"time"
@@ -30,6 +31,7 @@ var makeServerTransport = map[TransportType]serverTransportMaker{
 }
 
 // Transport 传输层的定义，用于读取数据
+// 服务端会并发地写入响应，Write需要支持并发调用并且每次调用完整地写入一个消息
 type Transport interface {
 	Dial(network, addr string, option DialOption) error
 	io.ReadWriteCloser
@@ -37,9 +39,14 @@ type Transport interface {
 	LocalAddr() net.Addr
 }
 
+// ConnectionStater 可以获取TLS连接状态的传输层
+type ConnectionStater interface {
+	ConnectionState() (tls.ConnectionState, bool)
+}
+
 // Server端
 type ServerTransport interface {
-	Listen(network, addr string) error
+	Listen(network, addr string, option ListenOption) error
 	Accept() (Transport, error)
 	io.Closer
 }
@@ -57,7 +64,13 @@ func NewTransport(t TransportType) Transport {
 }
 
 type DialOption struct {
-	Timeout time.Duration
+	Timeout   time.Duration
+	TLSConfig *tls.Config // 不为空时使用TLS连接
+}
+
+// ListenOption 服务端监听的配置
+type ListenOption struct {
+	TLSConfig *tls.Config // 不为空时只接受TLS连接，需要客户端证书时设置ClientAuth
 }
 
 func (s *Socket) Dial(network, addr string, option DialOption) error {
@@ -65,7 +78,13 @@ func (s *Socket) Dial(network, addr string, option DialOption) error {
 	if option.Timeout > time.Duration(0) {
 		dialer.Timeout = option.Timeout
 	}
-	conn, err := dialer.Dial(network, addr)
+	var conn net.Conn
+	var err error
+	if option.TLSConfig != nil {
+		conn, err = tls.DialWithDialer(&dialer, network, addr, option.TLSConfig)
+	} else {
+		conn, err = dialer.Dial(network, addr)
+	}
 	if err != nil {
 		return err
 	}
@@ -92,11 +111,26 @@ func (s Socket) LocalAddr() net.Addr {
 	return s.conn.LocalAddr()
 }
 
-func (s *ServerSocket) Listen(network, addr string) error {
+// ConnectionState TLS连接的状态，握手还没有完成时先完成握手，非TLS连接或者握手失败返回false
+func (s *Socket) ConnectionState() (tls.ConnectionState, bool) {
+	conn, ok := s.conn.(*tls.Conn)
+	if !ok {
+		return tls.ConnectionState{}, false
+	}
+	if err := conn.Handshake(); err != nil {
+		return tls.ConnectionState{}, false
+	}
+	return conn.ConnectionState(), true
+}
+
+func (s *ServerSocket) Listen(network, addr string, option ListenOption) error {
 	ln, err := net.Listen(network, addr)
 	if err != nil {
 		return err
 	}
+	if option.TLSConfig != nil {
+		ln = tls.NewListener(ln, option.TLSConfig)
+	}
 	s.ln = ln
 	return nil
 }